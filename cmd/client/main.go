@@ -2,203 +2,305 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
-	"fmt"
-	"io/ioutil"
-	"net"
-	"net/http"
-	"sync"
+	"flag"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/dmazine/poc-http/loadgen"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/net/http2"
 )
 
-type DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+func main() {
+	options := loadgen.DefaultOptions()
+
+	var scenarioFile, reportFile, expectedTrailers, signedComponents string
+	var recordsFile, recordsPolicy string
+	var recordsBuffer int
+	var benchmarkDir string
+	var retryStatusCodes, retryErrorClasses string
+	var sweepTimeouts string
+	var sweepTLSHandshake, sweepResponseHeader, sweepIdleConn string
+	var sweepRequests int
+
+	flag.StringVar(&options.BaseURL, "url", options.BaseURL, "base URL of the target (host:port for tcp)")
+	flag.StringVar(&options.Fallback.BaseURL, "fallback-url", options.Fallback.BaseURL, "base URL requests fail over to (empty disables the fallback)")
+	flag.StringVar(&options.Fallback.Mode, "fallback-mode", options.Fallback.Mode, "fail over on every failure or only while the circuit is open: failure or open-circuit")
+	flag.StringVar(&options.Protocol, "protocol", options.Protocol, "target protocol: http, grpc, websocket or tcp")
+	flag.StringVar(&options.RequestPath, "path", options.RequestPath, "path requested by every user")
+	flag.StringVar(&scenarioFile, "scenario", "", "JSON scenario executed by every user instead of a single request")
+	flag.StringVar(&reportFile, "report-json", "", "also write the report as JSON to this file")
+	flag.StringVar(&benchmarkDir, "benchmark-transports", "", "compare the CPU cost of the http and http2 transports in-process, writing profiles to this directory")
+	flag.StringVar(&sweepTimeouts, "sweep-timeouts", "", "comma-separated client timeouts (e.g. 100ms,250ms,500ms,1s) to run the same load test with, printing a table")
+	flag.StringVar(&sweepTLSHandshake, "sweep-tls-handshake", "", "comma-separated TLSHandshakeTimeout values of the transport timeout sweep")
+	flag.StringVar(&sweepResponseHeader, "sweep-response-header", "", "comma-separated ResponseHeaderTimeout values of the transport timeout sweep")
+	flag.StringVar(&sweepIdleConn, "sweep-idle-conn", "", "comma-separated IdleConnTimeout values of the transport timeout sweep")
+	flag.IntVar(&sweepRequests, "sweep-requests", loadgen.SweepRequestsPerUser, "requests per user in every cell of the transport timeout sweep")
+	flag.StringVar(&recordsFile, "records", "", "stream every attempt as JSON lines to this file")
+	flag.StringVar(&recordsPolicy, "records-policy", loadgen.SinkPolicyDrop, "when the records file falls behind: drop or block")
+	flag.IntVar(&recordsBuffer, "records-buffer", loadgen.SinkBuffer, "records buffered for the records file")
+	flag.DurationVar(&options.ClientTimeout, "client-timeout", options.ClientTimeout, "http.Client timeout covering the whole exchange (0 disables it)")
+	flag.DurationVar(&options.RequestTimeout, "request-timeout", options.RequestTimeout, "deadline of the context of every request (0 disables it)")
+	flag.DurationVar(&options.DrainTimeout, "drain-timeout", options.DrainTimeout, "longest wait for the requests in flight after SIGINT or SIGTERM")
+	flag.BoolVar(&options.PropagateDeadline, "propagate-deadline", options.PropagateDeadline, "send the time left before the request deadline in the X-Request-Deadline header")
+	flag.Float64Var(&options.Rate, "rate", options.Rate, "open-loop request rate per second (0 runs closed-loop users)")
+	flag.DurationVar(&options.MaxSchedulingLag, "max-lag", options.MaxSchedulingLag, "shed open-loop requests lagging more than this (0 never sheds)")
+	flag.StringVar(&options.AcceptEncoding, "accept-encoding", options.AcceptEncoding, "request compressed responses (gzip, deflate or br)")
+	flag.StringVar(&expectedTrailers, "expect-trailers", "", "comma-separated trailer names every response must carry")
+	flag.BoolVar(&options.RecordChunkTimings, "chunk-timings", options.RecordChunkTimings, "record the arrival time of every response body chunk")
+	flag.BoolVar(&options.AdaptiveTimeout.Enabled, "adaptive-timeout", options.AdaptiveTimeout.Enabled, "derive per-request deadlines from recent latencies instead of the client timeout")
+	flag.Float64Var(&options.AdaptiveTimeout.Percentile, "adaptive-percentile", options.AdaptiveTimeout.Percentile, "latency percentile the adaptive timeout is derived from")
+	flag.Float64Var(&options.AdaptiveTimeout.Factor, "adaptive-factor", options.AdaptiveTimeout.Factor, "multiplier applied to the latency percentile")
+	flag.DurationVar(&options.AdaptiveTimeout.Min, "adaptive-min", options.AdaptiveTimeout.Min, "lower bound of the adaptive timeout")
+	flag.DurationVar(&options.AdaptiveTimeout.Max, "adaptive-max", options.AdaptiveTimeout.Max, "upper bound of the adaptive timeout")
+	flag.IntVar(&options.AdaptiveTimeout.WindowSize, "adaptive-window", options.AdaptiveTimeout.WindowSize, "latencies kept in the rolling window")
+	flag.BoolVar(&options.Range.Enabled, "range", options.Range.Enabled, "fetch byte ranges of /payload/:size instead of the request path")
+	flag.BoolVar(&options.Range.Sequential, "range-sequential", options.Range.Sequential, "walk the payload sequentially instead of picking random ranges")
+	flag.BoolVar(&options.Retry.Enabled, "retry", options.Retry.Enabled, "retry failed round trips with exponential backoff")
+	flag.IntVar(&options.Retry.MaxAttempts, "retry-attempts", options.Retry.MaxAttempts, "attempts per request, including the first one")
+	flag.DurationVar(&options.Retry.BaseBackoff, "retry-backoff", options.Retry.BaseBackoff, "backoff before the first retry, doubled after every attempt")
+	flag.DurationVar(&options.Retry.MaxBackoff, "retry-max-backoff", options.Retry.MaxBackoff, "upper bound of the backoff")
+	flag.Float64Var(&options.Retry.Jitter, "retry-jitter", options.Retry.Jitter, "share of the backoff that is randomized, from 0 to 1")
+	flag.StringVar(&retryStatusCodes, "retry-status", joinInts(options.Retry.StatusCodes), "comma-separated status codes worth a retry")
+	flag.StringVar(&retryErrorClasses, "retry-errors", strings.Join(options.Retry.ErrorClasses, ","), "comma-separated error classes worth a retry: timeout, reset, refused, eof")
+	flag.BoolVar(&options.Retry.RetryNonIdempotent, "retry-non-idempotent", options.Retry.RetryNonIdempotent, "also retry POST and PATCH requests without an Idempotency-Key")
+	flag.Float64Var(&options.Retry.Budget, "retry-budget", options.Retry.Budget, "retries allowed per request over the budget window, e.g. 0.1 (0 disables the budget)")
+	flag.DurationVar(&options.Retry.BudgetWindow, "retry-budget-window", options.Retry.BudgetWindow, "sliding window of the retry budget")
+	flag.IntVar(&options.Retry.BudgetMinRetries, "retry-budget-min", options.Retry.BudgetMinRetries, "retries always allowed per budget window")
+	flag.IntVar(&options.Bulkhead.MaxInFlight, "bulkhead", options.Bulkhead.MaxInFlight, "round trips in flight per host (0 disables the bulkhead)")
+	flag.Float64Var(&options.Chaos.CancelRatio, "chaos-cancel", options.Chaos.CancelRatio, "share of the requests cancelled while in flight, from 0 to 1")
+	flag.DurationVar(&options.Chaos.CancelMaxDelay, "chaos-cancel-max-delay", options.Chaos.CancelMaxDelay, "cancellations happen at a random point within this delay of the send")
+	flag.DurationVar(&options.Bulkhead.QueueTimeout, "bulkhead-queue-timeout", options.Bulkhead.QueueTimeout, "longest wait for a bulkhead slot")
+	flag.BoolVar(&options.Hedge.Enabled, "hedge", options.Hedge.Enabled, "send a backup request when the first one is slower than the hedging delay")
+	flag.DurationVar(&options.Hedge.Delay, "hedge-delay", options.Hedge.Delay, "hedging delay until enough latencies were observed")
+	flag.Float64Var(&options.Hedge.Percentile, "hedge-percentile", options.Hedge.Percentile, "percentile of recent latencies used as hedging delay (0 keeps the static delay)")
+	flag.BoolVar(&options.CircuitBreaker.Enabled, "circuit-breaker", options.CircuitBreaker.Enabled, "fail fast once too many round trips failed")
+	flag.Float64Var(&options.CircuitBreaker.FailureRatio, "breaker-failure-ratio", options.CircuitBreaker.FailureRatio, "share of failed round trips opening the circuit")
+	flag.IntVar(&options.CircuitBreaker.MinRequests, "breaker-min-requests", options.CircuitBreaker.MinRequests, "round trips needed in a window before the circuit can open")
+	flag.DurationVar(&options.CircuitBreaker.Window, "breaker-window", options.CircuitBreaker.Window, "window over which failures are counted")
+	flag.DurationVar(&options.CircuitBreaker.OpenDuration, "breaker-open", options.CircuitBreaker.OpenDuration, "time the circuit stays open before probing")
+	flag.IntVar(&options.CircuitBreaker.HalfOpenProbes, "breaker-probes", options.CircuitBreaker.HalfOpenProbes, "successful probes needed to close the circuit")
+	flag.BoolVar(&options.LogRoundTrips, "log-round-trips", options.LogRoundTrips, "log every round trip made by the transport")
+	flag.StringVar(&options.Signing.Secret, "sign-secret", "", "sign every request with HMAC-SHA256 using this secret")
+	flag.StringVar(&options.Signing.KeyID, "sign-key-id", "", "key id advertised in the signature header")
+	flag.StringVar(&signedComponents, "sign-components", strings.Join(options.Signing.Components, ","), "comma-separated components covered by the signature")
+	flag.StringVar(&options.Signing.SignatureHeader, "sign-header", options.Signing.SignatureHeader, "header carrying the signature")
+	flag.StringVar(&options.Socket.NoDelay, "tcp-nodelay", options.Socket.NoDelay, "TCP_NODELAY: on, off or empty for the default")
+	flag.IntVar(&options.Socket.SendBuffer, "so-sndbuf", options.Socket.SendBuffer, "SO_SNDBUF in bytes (0 keeps the default)")
+	flag.IntVar(&options.Socket.ReceiveBuffer, "so-rcvbuf", options.Socket.ReceiveBuffer, "SO_RCVBUF in bytes (0 keeps the default)")
+	flag.IntVar(&options.Socket.Linger, "so-linger", options.Socket.Linger, "SO_LINGER in seconds (negative keeps the default)")
+	flag.DurationVar(&options.Dialer.KeepAlive, "keep-alive", options.Dialer.KeepAlive, "TCP keep-alive interval (0 uses the Go default, negative disables)")
+	flag.BoolVar(&options.KeepAlive.Enabled, "keep-alive-probe", options.KeepAlive.Enabled, "report dead connections and the requests which ran into them")
+	flag.DurationVar(&options.KeepAlive.IdleHold, "idle-hold", options.KeepAlive.IdleHold, "hold connections idle this long between requests of a user")
+	flag.BoolVar(&options.Transport.DisableKeepAlives, "disable-keep-alives", options.Transport.DisableKeepAlives, "dial a new connection for every request")
+	flag.StringVar(&options.TLS.MinVersion, "tls-min", options.TLS.MinVersion, "minimum TLS version: 1.0 to 1.3")
+	flag.StringVar(&options.TLS.MaxVersion, "tls-max", options.TLS.MaxVersion, "maximum TLS version: 1.0 to 1.3")
+	flag.BoolVar(&options.TLS.SessionResumption, "tls-resume", options.TLS.SessionResumption, "resume TLS sessions with session tickets")
+	flag.BoolVar(&options.TLS.RecordHandshakes, "tls-handshakes", options.TLS.RecordHandshakes, "report TLS handshake durations, full versus resumed")
+	flag.BoolVar(&options.PerWorkerTransport, "per-worker-transport", options.PerWorkerTransport, "give every user its own transport and connection pool")
+	flag.BoolVar(&options.TracePool, "trace-pool", options.TracePool, "report whether requests reused, dialed or raced for their connection")
+	flag.BoolVar(&options.HTTP2, "http2", options.HTTP2, "use the golang.org/x/net/http2 transport")
+	flag.DurationVar(&options.HTTP2Transport.ReadIdleTimeout, "read-idle-timeout", options.HTTP2Transport.ReadIdleTimeout, "send a health check PING after this long without frames (0 disables)")
+	flag.DurationVar(&options.HTTP2Transport.PingTimeout, "ping-timeout", options.HTTP2Transport.PingTimeout, "close the connection when the health check PING is not answered in time")
+	flag.Parse()
 
-// Server settings
-const (
-	ServerBaseURL = "https://localhost:8443"
-)
+	log.SetFormatter(&log.TextFormatter{
+		FullTimestamp: true,
+	})
 
-// HTTP client settings
-const (
-	HTTPClientTimeout = 1000 * time.Millisecond
-)
+	options.ExpectedTrailers = splitList(expectedTrailers)
+	options.Signing.Components = splitList(signedComponents)
+	options.Signing.Enabled = options.Signing.Secret != ""
+	options.Retry.ErrorClasses = splitList(retryErrorClasses)
 
-// HTTP transport settings
-const (
-	HTTPTransportTLSHandshakeTimeout    = 0 * time.Millisecond
-	HTTPTransportDisableKeepAlives      = false
-	HTTPTransportMaxIdleConns           = 0
-	HTTPTransportMaxIdleConnsPerHost    = 1000
-	HTTPTransportMaxConnsPerHost        = 0
-	HTTPTransportIdleConnTimeout        = 60 * time.Second
-	HTTPTransportResponseHeaderTimeout  = 0 * time.Millisecond
-	HTTPTransportExpectContinueTimeout  = 0 * time.Millisecond
-	HTTPTransportMaxResponseHeaderBytes = 0
-	HTTPTransportWriteBufferSize        = 0
-	HTTPTransportReadBufferSize         = 0
-)
+	statusCodes, err := splitInts(retryStatusCodes)
+	if err != nil {
+		log.Fatal("Parsing retry status codes failed with error: ", err.Error())
+	}
 
-// HTTP2 transport settings
-const (
-	AllowHTTP                  = true
-	StrictMaxConcurrentStreams = false
-	ReadIdleTimeout            = 0 * time.Millisecond
-	PingTimeout                = 0 * time.Millisecond
-)
+	options.Retry.StatusCodes = statusCodes
 
-// Dialer settings
-const (
-	DialerTimeout   = 0 * time.Millisecond
-	DialerKeepAlive = 0 * time.Millisecond
-)
+	ctx := withSignals(context.Background())
 
-// TLS client settings
-const (
-	TLSClientInsecureSkipVerify = true
-)
+	if benchmarkDir != "" {
+		benchmark := loadgen.DefaultBenchmarkOptions()
+		benchmark.ProfileDir = benchmarkDir
 
-// Load test settings
-const (
-	ConcurrentUsers = 100
-	RequestsPerUser = 100000
-)
+		report, err := loadgen.BenchmarkTransports(ctx, options, benchmark)
+		if err != nil {
+			log.Fatal("Transport benchmark failed with error: ", err.Error())
+		}
 
-func main() {
-	log.SetFormatter(&log.TextFormatter{
-		FullTimestamp: true,
-	})
+		report.Print()
+		return
+	}
 
-	client := newHTTPClient()
-	//client := newHTTP2Client()
+	var scenario loadgen.Scenario
 
-	var waitGroup sync.WaitGroup
+	if scenarioFile != "" {
+		loaded, err := loadgen.LoadScenario(scenarioFile)
+		if err != nil {
+			log.Fatal("Loading scenario failed with error: ", err.Error())
+		}
 
-	for user := 0; user < ConcurrentUsers; user++ {
-		waitGroup.Add(1)
+		scenario = *loaded
+	}
 
-		contextLogger := log.WithFields(log.Fields{
-			"user": user,
-		})
+	if sweepTimeouts != "" {
+		timeouts, err := splitDurations(sweepTimeouts)
+		if err != nil {
+			log.Fatal("Parsing sweep timeouts failed with error: ", err.Error())
+		}
 
-		go func(logger *log.Entry) {
-			defer waitGroup.Done()
+		report, err := loadgen.SweepTimeouts(ctx, scenario, options, timeouts)
+		if err != nil {
+			log.Fatal("Timeout sweep failed with error: ", err.Error())
+		}
 
-			for requestCount := 0; requestCount < RequestsPerUser; requestCount++ {
-				startTime := time.Now()
+		report.WriteTable(os.Stdout)
+		return
+	}
+
+	if sweepTLSHandshake != "" || sweepResponseHeader != "" || sweepIdleConn != "" {
+		grid := loadgen.DefaultTransportTimeoutGrid()
+		grid.RequestsPerUser = sweepRequests
+
+		for _, axis := range []struct {
+			value  string
+			values *[]time.Duration
+		}{
+			{sweepTLSHandshake, &grid.TLSHandshakeTimeouts},
+			{sweepResponseHeader, &grid.ResponseHeaderTimeouts},
+			{sweepIdleConn, &grid.IdleConnTimeouts},
+		} {
+			if *axis.values, err = splitDurations(axis.value); err != nil {
+				log.Fatal("Parsing sweep timeouts failed with error: ", err.Error())
+			}
+		}
 
-				//statusCode, body, err := ping(client)
-				_, _, err := ping(client)
+		report, err := loadgen.SweepTransportTimeouts(ctx, scenario, options, grid)
+		if err != nil {
+			log.Fatal("Transport timeout sweep failed with error: ", err.Error())
+		}
 
-				stopTime := time.Now()
-				elapsedTime := stopTime.Sub(startTime)
+		report.WriteTable(os.Stdout)
+		return
+	}
 
-				if err != nil {
-					logger.WithFields(log.Fields{
-						"Start":   startTime,
-						"Stop":    stopTime,
-						"Elapsed": elapsedTime,
-					}).Printf("Request failed with error [%v]\n", err)
+	if recordsFile != "" {
+		file, err := os.Create(recordsFile)
+		if err != nil {
+			log.Fatal("Creating records file failed with error: ", err.Error())
+		}
 
-					continue
-				}
+		defer file.Close()
 
-				//logger.WithFields(log.Fields{
-				//	"Start":   startTime,
-				//	"Stop":    stopTime,
-				//	"Elapsed": elapsedTime,
-				//}).Printf("Request finished with statusCode [%v] and body [%v]\n", statusCode, *body)
-			}
+		options.Sinks = append(options.Sinks, loadgen.SinkConfig{
+			Name:   "records",
+			Sink:   loadgen.NewJSONLinesSink(file),
+			Buffer: recordsBuffer,
+			Policy: recordsPolicy,
+		})
+	}
 
-			logger.Print("All requests executed")
-		}(contextLogger)
+	report, err := loadgen.Run(ctx, scenario, options)
+	if err != nil {
+		log.Fatal("Load test failed with error: ", err.Error())
 	}
 
-	waitGroup.Wait()
-}
+	report.Print()
 
-func newHTTPClient() *http.Client {
-	return &http.Client{
-		Transport: newHTTPTransport(),
-		Timeout:   HTTPClientTimeout,
+	if reportFile != "" {
+		if err := writeReport(reportFile, &report); err != nil {
+			log.Error("Writing report failed with error: ", err.Error())
+		}
 	}
 }
 
-func newHTTPTransport() http.RoundTripper {
-	httpTransport := &http.Transport{
-		Proxy:                  http.ProxyFromEnvironment,
-		DialContext:            newDialContext(),
-		TLSClientConfig:        newTLSClientConfig(),
-		TLSHandshakeTimeout:    HTTPTransportTLSHandshakeTimeout,
-		DisableKeepAlives:      HTTPTransportDisableKeepAlives,
-		MaxIdleConns:           HTTPTransportMaxIdleConns,
-		MaxIdleConnsPerHost:    HTTPTransportMaxIdleConnsPerHost,
-		MaxConnsPerHost:        HTTPTransportMaxConnsPerHost,
-		IdleConnTimeout:        HTTPTransportIdleConnTimeout,
-		ResponseHeaderTimeout:  HTTPTransportResponseHeaderTimeout,
-		ExpectContinueTimeout:  HTTPTransportExpectContinueTimeout,
-		MaxResponseHeaderBytes: HTTPTransportMaxResponseHeaderBytes,
-		WriteBufferSize:        HTTPTransportWriteBufferSize,
-		ReadBufferSize:         HTTPTransportReadBufferSize,
-	}
+// Context done on the first SIGINT or SIGTERM, letting the load test stop
+// and report. A second signal kills the process.
+func withSignals(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		received := <-signals
+		signal.Stop(signals)
 
-	//err := http2.ConfigureTransport(httpTransport)
-	//if err != nil {
-	//	panic(err)
-	//}
+		log.Warn("Received ", received, ", waiting for the requests in flight")
+		cancel()
+	}()
 
-	return httpTransport
+	return ctx
 }
 
-func newHTTP2Client() *http.Client {
-	return &http.Client{
-		Transport: newHTTP2Transport(),
-		Timeout:   HTTPClientTimeout,
+func writeReport(path string, report *loadgen.Report) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
 	}
+
+	defer file.Close()
+
+	return report.WriteJSON(file)
 }
 
-func newHTTP2Transport() *http2.Transport {
-	return &http2.Transport{
-		TLSClientConfig:            newTLSClientConfig(),
-		AllowHTTP:                  AllowHTTP,
-		StrictMaxConcurrentStreams: StrictMaxConcurrentStreams,
-		ReadIdleTimeout:            ReadIdleTimeout,
-		PingTimeout:                PingTimeout,
+// Splits a comma-separated flag value, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-}
 
-func newDialContext() DialContext {
-	return (&net.Dialer{
-		Timeout:   DialerTimeout,
-		KeepAlive: DialerKeepAlive,
-	}).DialContext
+	return items
 }
 
-func newTLSClientConfig() *tls.Config {
-	cfg := &tls.Config{
-		InsecureSkipVerify: TLSClientInsecureSkipVerify,
+// Splits a comma-separated flag value of integers
+func splitInts(value string) ([]int, error) {
+	var ints []int
+
+	for _, item := range splitList(value) {
+		i, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, err
+		}
+
+		ints = append(ints, i)
 	}
-	return cfg
+
+	return ints, nil
 }
 
-func ping(client *http.Client) (int, *string, error) {
-	url := fmt.Sprintf("%s/ping", ServerBaseURL)
+// Splits a comma-separated flag value of durations
+func splitDurations(value string) ([]time.Duration, error) {
+	var durations []time.Duration
 
-	resp, err := client.Get(url)
-	if err != nil {
-		return 0, nil, err
+	for _, item := range splitList(value) {
+		duration, err := time.ParseDuration(item)
+		if err != nil {
+			return nil, err
+		}
+
+		durations = append(durations, duration)
 	}
 
-	defer resp.Body.Close()
+	return durations, nil
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, nil, err
-	}
+func joinInts(ints []int) string {
+	items := make([]string, len(ints))
 
-	data := string(body)
+	for i, value := range ints {
+		items[i] = strconv.Itoa(value)
+	}
 
-	return resp.StatusCode, &data, nil
+	return strings.Join(items, ",")
 }
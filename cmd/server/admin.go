@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+func handleGetSettings(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, settings.Get())
+	}
+}
+
+// Updates the settings given, the others keeping their value, and returns
+// the resulting settings
+func handleUpdateSettings(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request UpdateSettingsRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		updated, err := settings.Update(newAuditEntry(c), request.apply)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		requestLog(c).WithFields(log.Fields{
+			"RateLimitRate":  updated.RateLimitRate,
+			"RateLimitBurst": updated.RateLimitBurst,
+			"Timeout":        updated.Timeout,
+			"MaxConcurrent":  updated.MaxConcurrent,
+			"MaxQueue":       updated.MaxQueue,
+			"QueueTimeout":   updated.QueueTimeout,
+			"MinimumDelay":   updated.MinimumDelay,
+			"MaximumDelay":   updated.MaximumDelay,
+			"StickyMode":     updated.StickyMode,
+			"SlowShare":      updated.SlowShare,
+			"SlowDelay":      updated.SlowDelay,
+			"Faults":         updated.Faults,
+			"CullIdleAfter":  updated.CullIdleAfter,
+			"CullIdleRandom": updated.CullIdleRandom,
+			"Handshake":      updated.HandshakeFaults,
+			"CloseRatio":     updated.CloseRatio,
+			"LatencySpikes":  updated.LatencySpikes,
+			"GRPC":           updated.GRPCFaults,
+			"Compression":    updated.Compression,
+			"Middlewares":    updated.Middlewares,
+		}).Info("Settings updated")
+
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// Restores all settings to the values of the configuration
+func handleResetSettings(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reset, err := settings.Reset(newAuditEntry(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, buildError(c, err.Error()))
+			return
+		}
+
+		requestLog(c).Info("Settings reset")
+
+		c.JSON(http.StatusOK, reset)
+	}
+}
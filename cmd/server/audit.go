@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit log settings
+const (
+	// Changes kept, the oldest being dropped first
+	AuditLogSize = 1000
+)
+
+// Change of the settings made through the API
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+
+	// Endpoint and client which made the change
+	Endpoint string `json:"endpoint"`
+	Caller   string `json:"caller"`
+
+	Old Settings `json:"old"`
+	New Settings `json:"new"`
+}
+
+// Who and what changed the settings, so the configuration at any point of an
+// experiment can be reconstructed
+type AuditLog struct {
+	mutex   sync.Mutex
+	entries []AuditEntry
+}
+
+func NewAuditLog() *AuditLog {
+	return &AuditLog{}
+}
+
+func (l *AuditLog) record(entry AuditEntry) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.entries) == AuditLogSize {
+		l.entries = append(l.entries[:0], l.entries[1:]...)
+	}
+
+	l.entries = append(l.entries, entry)
+}
+
+// Entries from the oldest to the most recent
+func (l *AuditLog) Entries() []AuditEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entries := make([]AuditEntry, len(l.entries))
+	copy(entries, l.entries)
+
+	return entries
+}
+
+// Change being made by the request, to be completed with the settings
+func newAuditEntry(c *gin.Context) AuditEntry {
+	caller := c.ClientIP()
+
+	if user, _, ok := c.Request.BasicAuth(); ok {
+		caller = user + "@" + caller
+	}
+
+	return AuditEntry{
+		Endpoint: c.Request.Method + " " + c.Request.URL.Path,
+		Caller:   caller,
+	}
+}
+
+func handleGetAuditLog(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, settings.audit.Entries())
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Credentials of the admin and config endpoints, either a bearer token or
+// basic auth. Both empty leaves the endpoints open.
+type AuthConfig struct {
+	Token string `yaml:"token"`
+
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+func (c *AuthConfig) enabled() bool {
+	return c.Token != "" || c.User != ""
+}
+
+// Rejects requests without the configured token or basic auth credentials
+func WithAuth(config AuthConfig) gin.HandlerFunc {
+	if !config.enabled() {
+		log.Warn("Admin and config endpoints are not protected")
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		if !config.authorized(c.Request) {
+			if config.User != "" {
+				c.Header("WWW-Authenticate", `Basic realm="admin"`)
+			}
+
+			c.AbortWithStatusJSON(http.StatusUnauthorized, buildError(c, "unauthorized"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (c *AuthConfig) authorized(req *http.Request) bool {
+	if c.Token != "" {
+		header := req.Header.Get("Authorization")
+
+		if token := strings.TrimPrefix(header, "Bearer "); token != header && equal(token, c.Token) {
+			return true
+		}
+	}
+
+	if c.User != "" {
+		if user, password, ok := req.BasicAuth(); ok && equal(user, c.User) && equal(password, c.Password) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Constant-time comparison, so response times don't leak the credentials
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Connection churn forced on HTTP/1.1 clients
+type ConnectionChurn struct {
+	// Share of the responses sent with Connection: close, from 0 to 1
+	CloseRatio float64 `json:"closeRatio"`
+}
+
+func (c *ConnectionChurn) validate() error {
+	if c.CloseRatio < 0 || c.CloseRatio > 1 {
+		return errors.New("CloseRatio must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// Closes the connection after a share of the HTTP/1.1 responses, on all
+// routes. HTTP/2 connections are left alone, the GOAWAY fault covering them.
+func WithConnectionClose(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ratio := settings.Get().CloseRatio
+
+		if ratio > 0 && c.Request.ProtoMajor == 1 && rand.Float64() < ratio {
+			c.Header("Connection", "close")
+		}
+
+		c.Next()
+	}
+}
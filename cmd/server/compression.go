@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Encodings of the compressed responses, in order of preference
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// Compression of the responses of clients accepting it. Brotli is left out,
+// having no encoder in the standard library.
+type Compression struct {
+	// gzip or deflate level, from 1 (fastest) to 9 (smallest), 0 disables
+	// compression
+	CompressionLevel int `json:"compressionLevel"`
+
+	// Bodies shorter than that many bytes are sent as is
+	CompressionMinSize int `json:"compressionMinSize"`
+}
+
+func (c *Compression) validate() error {
+	if c.CompressionLevel < 0 || c.CompressionLevel > 9 {
+		return errors.New("CompressionLevel must be between 0 and 9")
+	}
+
+	if c.CompressionMinSize < 0 {
+		return errors.New("CompressionMinSize can not be negative")
+	}
+
+	return nil
+}
+
+// Outcome of the compression since startup
+type CompressionStats struct {
+	responses int64
+	bytesIn   int64
+	bytesOut  int64
+
+	// Time spent compressing
+	nanos int64
+}
+
+type CompressionStatsResponse struct {
+	Responses int64 `json:"responses"`
+	BytesIn   int64 `json:"bytesIn"`
+	BytesOut  int64 `json:"bytesOut"`
+
+	// Compressed size over the original one
+	Ratio float64 `json:"ratio"`
+
+	// Time spent compressing, in milliseconds, in total and per response
+	CPUTime            float64 `json:"cpuTime"`
+	CPUTimePerResponse float64 `json:"cpuTimePerResponse"`
+}
+
+func (s *CompressionStats) snapshot() CompressionStatsResponse {
+	response := CompressionStatsResponse{
+		Responses: atomic.LoadInt64(&s.responses),
+		BytesIn:   atomic.LoadInt64(&s.bytesIn),
+		BytesOut:  atomic.LoadInt64(&s.bytesOut),
+		CPUTime:   float64(atomic.LoadInt64(&s.nanos)) / float64(time.Millisecond),
+	}
+
+	if response.BytesIn > 0 {
+		response.Ratio = float64(response.BytesOut) / float64(response.BytesIn)
+	}
+
+	if response.Responses > 0 {
+		response.CPUTimePerResponse = response.CPUTime / float64(response.Responses)
+	}
+
+	return response
+}
+
+func handleGetCompressionStats(stats *CompressionStats) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, stats.snapshot())
+	}
+}
+
+// Compresses the responses of the clients accepting gzip or deflate, on all
+// routes but /admin, once their body reached the minimum size. Bodies
+// flushed before are sent as is, so streams are never held back.
+func WithCompression(settings *SettingsStore, stats *CompressionStats) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		compression := settings.Get().Compression
+
+		if compression.CompressionLevel == 0 || strings.HasPrefix(c.Request.URL.Path, "/admin") {
+			c.Next()
+			return
+		}
+
+		encoding := acceptedEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{
+			ResponseWriter: c.Writer,
+			encoding:       encoding,
+			level:          compression.CompressionLevel,
+			minSize:        compression.CompressionMinSize,
+			stats:          stats,
+		}
+		c.Writer = writer
+
+		c.Next()
+
+		writer.finish()
+		c.Writer = writer.ResponseWriter
+	}
+}
+
+// gzip or deflate when accepted, gzip first, or empty
+func acceptedEncoding(header string) string {
+	accepted := make(map[string]bool)
+
+	for _, value := range strings.Split(header, ",") {
+		parts := strings.Split(value, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+
+		accepted[name] = true
+
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					accepted[name] = false
+				}
+			}
+		}
+	}
+
+	for _, encoding := range []string{EncodingGzip, EncodingDeflate} {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+
+	return ""
+}
+
+// Response writer holding the body back until it reaches the minimum
+// size, then compressing it, or sending it as is when flushed or complete
+// before, or when it can not be compressed
+type compressWriter struct {
+	gin.ResponseWriter
+
+	encoding string
+	level    int
+	minSize  int
+	stats    *CompressionStats
+
+	buffer      bytes.Buffer
+	encoder     compressEncoder
+	passthrough bool
+}
+
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	if w.passthrough || w.encoder != nil {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	switch {
+	case w.passthrough:
+		return w.ResponseWriter.Write(data)
+
+	case w.encoder != nil:
+		return w.compress(data)
+	}
+
+	w.buffer.Write(data)
+
+	if w.buffer.Len() >= w.minSize {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Flush() {
+	if w.encoder != nil {
+		w.encoder.Flush()
+	} else {
+		w.sendAsIs()
+	}
+
+	w.ResponseWriter.Flush()
+}
+
+// Starts compressing the body held back, unless the response can not be
+// compressed
+func (w *compressWriter) start() error {
+	if !w.compressible() {
+		w.sendAsIs()
+		return nil
+	}
+
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+
+	output := &countingWriter{writer: w.ResponseWriter, count: &w.stats.bytesOut}
+
+	// Levels are validated with the settings
+	if w.encoding == EncodingGzip {
+		w.encoder, _ = gzip.NewWriterLevel(output, w.level)
+	} else {
+		// HTTP deflate is the zlib format, not raw DEFLATE
+		w.encoder, _ = zlib.NewWriterLevel(output, w.level)
+	}
+
+	w.ResponseWriter.WriteHeaderNow()
+
+	_, err := w.compress(w.buffer.Bytes())
+	w.buffer.Reset()
+
+	return err
+}
+
+func (w *compressWriter) compressible() bool {
+	header := w.ResponseWriter.Header()
+
+	switch w.ResponseWriter.Status() {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+
+	// Compressed messages of gRPC are flagged in the message itself
+	return header.Get("Content-Encoding") == "" && header.Get("Content-Range") == "" &&
+		!strings.HasPrefix(header.Get("Content-Type"), "application/grpc")
+}
+
+func (w *compressWriter) compress(data []byte) (int, error) {
+	start := time.Now()
+	n, err := w.encoder.Write(data)
+
+	atomic.AddInt64(&w.stats.nanos, int64(time.Since(start)))
+	atomic.AddInt64(&w.stats.bytesIn, int64(n))
+
+	return n, err
+}
+
+func (w *compressWriter) sendAsIs() {
+	if w.passthrough {
+		return
+	}
+
+	w.passthrough = true
+
+	if w.buffer.Len() > 0 {
+		w.ResponseWriter.Write(w.buffer.Bytes())
+		w.buffer.Reset()
+	}
+}
+
+// Sends the rest of the body once the handler returned
+func (w *compressWriter) finish() {
+	if w.encoder == nil {
+		w.sendAsIs()
+		return
+	}
+
+	start := time.Now()
+	w.encoder.Close()
+
+	atomic.AddInt64(&w.stats.nanos, int64(time.Since(start)))
+	atomic.AddInt64(&w.stats.responses, 1)
+}
+
+// Writer adding the bytes written to count
+type countingWriter struct {
+	writer io.Writer
+	count  *int64
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	n, err := w.writer.Write(data)
+	atomic.AddInt64(w.count, int64(n))
+
+	return n, err
+}
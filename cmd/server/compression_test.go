@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"br", ""},
+		{"gzip", EncodingGzip},
+		{"deflate", EncodingDeflate},
+		{"deflate, gzip", EncodingGzip},
+		{"GZIP", EncodingGzip},
+		{"br;q=1.0, gzip;q=0.8", EncodingGzip},
+		{"gzip;q=0", ""},
+		{"gzip; q=0, deflate", EncodingDeflate},
+		{"gzip;q=0.0, deflate;q=0", ""},
+		{"gzip;q=0.001", EncodingGzip},
+	}
+
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			if encoding := acceptedEncoding(test.header); encoding != test.encoding {
+				t.Errorf("acceptedEncoding() returned [%s], expected [%s]", encoding, test.encoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reasons a request did not get a handler slot
+var (
+	errQueueFull    = errors.New("concurrency limit queue is full")
+	errQueueTimeout = errors.New("concurrency limit queue timeout")
+)
+
+// Handlers running at once, with a bounded queue of requests waiting for a
+// slot
+type concurrencyLimit struct {
+	slots        chan struct{}
+	queue        chan struct{}
+	queueTimeout time.Duration
+}
+
+func newConcurrencyLimit(settings *Settings) *concurrencyLimit {
+	if settings.MaxConcurrent == 0 {
+		return nil
+	}
+
+	return &concurrencyLimit{
+		slots:        make(chan struct{}, settings.MaxConcurrent),
+		queue:        make(chan struct{}, settings.MaxQueue),
+		queueTimeout: time.Duration(settings.QueueTimeout) * time.Millisecond,
+	}
+}
+
+// Takes a slot, waiting in the queue up to the queue timeout
+func (l *concurrencyLimit) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	select {
+	case l.queue <- struct{}{}:
+	default:
+		return errQueueFull
+	}
+
+	defer func() { <-l.queue }()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errQueueTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *concurrencyLimit) release() {
+	<-l.slots
+}
+
+// Applies the current concurrency limit of the settings, rejecting requests
+// which can't get a slot with 503
+func WithConcurrencyLimit(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := settings.state()
+
+		limit := state.concurrency
+		if limit == nil || !state.settings.Middlewares.ConcurrencyLimit {
+			c.Next()
+			return
+		}
+
+		if err := limit.acquire(c.Request.Context()); err != nil {
+			requestLog(c).Warn("ConcurrencyLimit - ", err.Error())
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, buildError(c, err.Error()))
+			return
+		}
+
+		// The limit the slot was taken from, even if the settings changed
+		defer limit.release()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Server configuration, defaulting to the settings in main.go. It can be
+// loaded from a YAML file, flags given on the command line taking
+// precedence over the file.
+type Config struct {
+	Listeners []ListenerConfig `yaml:"listeners"`
+
+	// TLS certificate, shared by all TLS listeners
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`
+
+	// Also serve HTTP/3 over QUIC on the UDP port of every TLS listener
+	HTTP3 bool `yaml:"http3"`
+
+	// OTLP/gRPC collector the request spans are exported to, e.g.
+	// localhost:4317 (empty disables tracing)
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+
+	// Longest wait for the requests in flight on SIGINT or SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// Requests per second allowed on /pong (0 disables the rate limit)
+	RateLimitRate  float64 `yaml:"rate_limit_rate"`
+	RateLimitBurst int     `yaml:"rate_limit_burst"`
+
+	// Context timeout of /pong requests (0 disables it)
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Initial delay of /pong in milliseconds, until changed with PUT /delay
+	MinimumDelay int64 `yaml:"minimum_delay"`
+	MaximumDelay int64 `yaml:"maximum_delay"`
+
+	// Longest delay a single request can ask for through the delay query
+	// parameter or X-Delay header (0 disables overrides)
+	MaxDelayOverride time.Duration `yaml:"max_delay_override"`
+
+	// Protection of PUT /delay and the /admin endpoints
+	Auth AuthConfig `yaml:"auth"`
+
+	// File the settings changed at runtime are saved to and restored from
+	// at startup, taking precedence over the configuration (empty disables
+	// it)
+	StateFile string `yaml:"state_file"`
+
+	// Named sets of settings switched to with PUT /admin/profile, in the
+	// units of the admin API, the settings left out keeping the values
+	// above
+	Profiles map[string]UpdateSettingsRequest `yaml:"profiles,omitempty"`
+}
+
+// Address served over TLS, unless Plaintext is set. Timeouts left out use
+// the ones of the server.
+type ListenerConfig struct {
+	Addr      string `yaml:"addr"`
+	Plaintext bool   `yaml:"plaintext"`
+
+	// Also serve HTTP/2 over cleartext (h2c) on a plaintext listener
+	H2C bool `yaml:"h2c"`
+
+	// Addr is the path of a Unix domain socket
+	Unix bool `yaml:"unix"`
+
+	ReadTimeout       *time.Duration `yaml:"read_timeout,omitempty"`
+	ReadHeaderTimeout *time.Duration `yaml:"read_header_timeout,omitempty"`
+	WriteTimeout      *time.Duration `yaml:"write_timeout,omitempty"`
+	IdleTimeout       *time.Duration `yaml:"idle_timeout,omitempty"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Listeners:      []ListenerConfig{{Addr: ServerAddr}},
+		CertFile:       ServerCertFile,
+		KeyFile:        ServerKeyFile,
+		ReadTimeout:    ServerReadTimeout,
+		WriteTimeout:   ServerWriteTimeout,
+		IdleTimeout:    ServerIdleTimeout,
+		MaxHeaderBytes: ServerMaxHeaderBytes,
+		RateLimitRate:  RateLimitRate,
+		RateLimitBurst: RateLimitBurst,
+		Timeout:        Timeout,
+		MinimumDelay:   MinimumDelay,
+		MaximumDelay:   MaximumDelay,
+
+		MaxDelayOverride: MaxDelayOverride,
+		ShutdownTimeout:  ServerShutdownTimeout,
+	}
+}
+
+// Loads the YAML file over the defaults, then applies the flags set on the
+// command line
+func LoadConfig(path string, flags *flag.FlagSet) (Config, error) {
+	config := DefaultConfig()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("parsing [%s] failed: %v", path, err)
+	}
+
+	overrides := flag.NewFlagSet("overrides", flag.ContinueOnError)
+	config.RegisterFlags(overrides)
+
+	flags.Visit(func(f *flag.Flag) {
+		if override := overrides.Lookup(f.Name); override != nil && err == nil {
+			err = override.Value.Set(f.Value.String())
+		}
+	})
+
+	return config, err
+}
+
+// Registers one flag per setting, defaulting to the current values
+func (c *Config) RegisterFlags(flags *flag.FlagSet) {
+	flags.Var(&listenersValue{listeners: &c.Listeners}, "addr", "comma-separated addresses the server listens on over TLS")
+	flags.Var(&listenersValue{&c.Listeners, ListenerConfig{Plaintext: true, H2C: true}}, "plaintext-addr", "comma-separated addresses the server also listens on over cleartext HTTP/1.1 and h2c")
+	flags.Var(&listenersValue{&c.Listeners, ListenerConfig{Plaintext: true}}, "http-addr", "comma-separated addresses the server also listens on over cleartext HTTP/1.1 only")
+	flags.Var(&listenersValue{&c.Listeners, ListenerConfig{Plaintext: true, H2C: true, Unix: true}}, "unix-socket", "comma-separated Unix domain socket paths the server also listens on over cleartext HTTP/1.1 and h2c")
+	flags.StringVar(&c.CertFile, "cert", c.CertFile, "TLS certificate file")
+	flags.StringVar(&c.KeyFile, "key", c.KeyFile, "TLS private key file")
+	flags.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "http.Server ReadTimeout (0 disables it)")
+	flags.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", c.ReadHeaderTimeout, "http.Server ReadHeaderTimeout (0 uses ReadTimeout)")
+	flags.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "http.Server WriteTimeout, must cover ReadTimeout plus the processing time (0 disables it)")
+	flags.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "http.Server IdleTimeout (0 uses ReadTimeout)")
+	flags.IntVar(&c.MaxHeaderBytes, "max-header-bytes", c.MaxHeaderBytes, "http.Server MaxHeaderBytes")
+	flags.BoolVar(&c.HTTP3, "http3", c.HTTP3, "also serve HTTP/3 over QUIC on the UDP port of every TLS listener, advertised in Alt-Svc")
+	flags.StringVar(&c.OTLPEndpoint, "otlp-endpoint", c.OTLPEndpoint, "OTLP/gRPC collector the request spans are exported to, e.g. localhost:4317 (empty disables tracing)")
+	flags.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "longest wait for the requests in flight on SIGINT or SIGTERM")
+	flags.Float64Var(&c.RateLimitRate, "rate-limit", c.RateLimitRate, "requests per second allowed on /pong (0 disables the rate limit)")
+	flags.IntVar(&c.RateLimitBurst, "rate-limit-burst", c.RateLimitBurst, "burst of the /pong rate limit")
+	flags.DurationVar(&c.Timeout, "timeout", c.Timeout, "context timeout of /pong requests (0 disables it)")
+	flags.Int64Var(&c.MinimumDelay, "min-delay", c.MinimumDelay, "initial minimum delay of /pong in milliseconds")
+	flags.Int64Var(&c.MaximumDelay, "max-delay", c.MaximumDelay, "initial maximum delay of /pong in milliseconds")
+	flags.DurationVar(&c.MaxDelayOverride, "max-delay-override", c.MaxDelayOverride, "longest delay a request can ask for with ?delay= or X-Delay (0 disables overrides)")
+	flags.StringVar(&c.StateFile, "state-file", c.StateFile, "file the delay and other runtime settings are saved to and restored from")
+	flags.StringVar(&c.Auth.Token, "admin-token", c.Auth.Token, "bearer token required by the admin and config endpoints")
+	flags.StringVar(&c.Auth.User, "admin-user", c.Auth.User, "basic auth user of the admin and config endpoints")
+	flags.StringVar(&c.Auth.Password, "admin-password", c.Auth.Password, "basic auth password of the admin and config endpoints")
+}
+
+func (c *Config) Validate() error {
+	if len(c.Listeners) == 0 {
+		return errors.New("Listeners can not be empty")
+	}
+
+	tls := false
+
+	for _, listener := range c.Listeners {
+		if listener.Addr == "" {
+			return errors.New("listener Addr can not be empty")
+		}
+
+		if listener.H2C && !listener.Plaintext {
+			return fmt.Errorf("listener [%s] can only serve h2c in plaintext", listener.Addr)
+		}
+
+		for _, timeout := range []*time.Duration{listener.ReadTimeout, listener.ReadHeaderTimeout, listener.WriteTimeout, listener.IdleTimeout} {
+			if timeout != nil && *timeout < 0 {
+				return fmt.Errorf("listener [%s] timeouts can not be negative", listener.Addr)
+			}
+		}
+
+		tls = tls || !listener.Plaintext
+	}
+
+	if tls && (c.CertFile == "" || c.KeyFile == "") {
+		return errors.New("CertFile and KeyFile can not be empty")
+	}
+
+	if c.ReadTimeout < 0 || c.ReadHeaderTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		return errors.New("server timeouts can not be negative")
+	}
+
+	if c.ShutdownTimeout < 0 {
+		return errors.New("ShutdownTimeout can not be negative")
+	}
+
+	if c.MaxHeaderBytes < 0 {
+		return errors.New("MaxHeaderBytes can not be negative")
+	}
+
+	if c.RateLimitRate < 0 {
+		return errors.New("RateLimitRate can not be negative")
+	}
+
+	if c.RateLimitRate > 0 && c.RateLimitBurst < 1 {
+		return errors.New("RateLimitBurst must be at least 1")
+	}
+
+	if c.Timeout < 0 {
+		return errors.New("Timeout can not be negative")
+	}
+
+	if c.MaxDelayOverride < 0 {
+		return errors.New("MaxDelayOverride can not be negative")
+	}
+
+	if c.Auth.User == "" && c.Auth.Password != "" {
+		return errors.New("auth Password requires a User")
+	}
+
+	delay := UpdateDelayRequest{MinimumDelay: c.MinimumDelay, MaximumDelay: c.MaximumDelay}
+
+	return delay.Validate()
+}
+
+// Effective configuration as YAML, for the startup log, without credentials
+func (c *Config) String() string {
+	redacted := *c
+
+	if redacted.Auth.Token != "" {
+		redacted.Auth.Token = "REDACTED"
+	}
+
+	if redacted.Auth.Password != "" {
+		redacted.Auth.Password = "REDACTED"
+	}
+
+	data, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(data)
+}
+
+// Listeners of one kind set from a comma-separated list of addresses,
+// replacing the listeners of that kind configured
+type listenersValue struct {
+	listeners *[]ListenerConfig
+
+	// Listener of the kind, without address
+	kind ListenerConfig
+}
+
+func (v *listenersValue) String() string {
+	if v == nil || v.listeners == nil {
+		return ""
+	}
+
+	var addrs []string
+
+	for _, listener := range *v.listeners {
+		if v.sameKind(listener) {
+			addrs = append(addrs, listener.Addr)
+		}
+	}
+
+	return strings.Join(addrs, ",")
+}
+
+func (v *listenersValue) Set(value string) error {
+	var listeners []ListenerConfig
+
+	for _, listener := range *v.listeners {
+		if !v.sameKind(listener) {
+			listeners = append(listeners, listener)
+		}
+	}
+
+	for _, addr := range strings.Split(value, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			listener := v.kind
+			listener.Addr = addr
+			listeners = append(listeners, listener)
+		}
+	}
+
+	*v.listeners = listeners
+
+	return nil
+}
+
+func (v *listenersValue) sameKind(listener ListenerConfig) bool {
+	return listener.Plaintext == v.kind.Plaintext && listener.H2C == v.kind.H2C && listener.Unix == v.kind.Unix
+}
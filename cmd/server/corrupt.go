@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/rand"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header declaring the SHA-256 of the body, as in RFC 3230
+const DigestHeader = "Digest"
+
+// Response writer holding the body back, so it can be corrupted once
+// complete
+type corruptWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *corruptWriter) WriteHeaderNow() {}
+
+func (w *corruptWriter) Flush() {}
+
+func (w *corruptWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *corruptWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// Runs the handler, then sends its body with count bytes flipped, declaring
+// the Digest and ETag of the original body, or broken ones when
+// corruptDigest is set
+func corruptResponse(c *gin.Context, count int, corruptDigest bool) {
+	writer := &corruptWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+
+	c.Next()
+
+	c.Writer = writer.ResponseWriter
+
+	body := writer.body.Bytes()
+	sum := sha256.Sum256(body)
+
+	if corruptDigest {
+		sum[0] ^= 0xff
+	}
+
+	for i := 0; i < count && len(body) > 0; i++ {
+		body[rand.Intn(len(body))] ^= 0xff
+	}
+
+	c.Header(DigestHeader, "sha-256="+base64.StdEncoding.EncodeToString(sum[:]))
+	c.Header("ETag", strconv.Quote(base64.RawURLEncoding.EncodeToString(sum[:16])))
+	c.Header("Content-Length", strconv.Itoa(len(body)))
+
+	c.Writer.Write(body)
+}
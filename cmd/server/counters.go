@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Requests served since startup, by response status code
+type Counters struct {
+	mutex    sync.Mutex
+	requests int64
+	statuses map[int]int64
+
+	// Panics recovered by the recovery middleware
+	panics int64
+}
+
+func NewCounters() *Counters {
+	return &Counters{
+		statuses: make(map[int]int64),
+	}
+}
+
+func (c *Counters) Track() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		c.requests++
+		c.statuses[ctx.Writer.Status()]++
+	}
+}
+
+func (c *Counters) recordPanic() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.panics++
+}
+
+// Snapshot of the counters
+type CountersResponse struct {
+	Requests int64            `json:"requests"`
+	InFlight int64            `json:"inFlight"`
+	Statuses map[string]int64 `json:"statuses"`
+	Panics   int64            `json:"panics"`
+
+	// Handlers blocked by the leak fault, and goroutines of the process
+	Leaked     int64 `json:"leaked"`
+	Goroutines int   `json:"goroutines"`
+}
+
+func (c *Counters) snapshot(inFlight *InFlight, leaks *Leaks) CountersResponse {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	response := CountersResponse{
+		Requests: c.requests,
+		InFlight: inFlight.current(),
+		Statuses: make(map[string]int64, len(c.statuses)),
+		Panics:   c.panics,
+
+		Leaked:     leaks.current(),
+		Goroutines: runtime.NumGoroutine(),
+	}
+
+	for status, count := range c.statuses {
+		response.Statuses[strconv.Itoa(status)] = count
+	}
+
+	return response
+}
+
+func handleGetCounters(counters *Counters, inFlight *InFlight, leaks *Leaks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, counters.snapshot(inFlight, leaks))
+	}
+}
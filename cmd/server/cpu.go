@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// CPU burn settings
+const (
+	// Period over which the duty cycle of the burning goroutines applies
+	CPUBurnPeriod = 100 * time.Millisecond
+)
+
+// Burn CPU request, durations in milliseconds
+type BurnCPURequest struct {
+	Goroutines int `json:"goroutines"`
+
+	// Share of the time each goroutine spins, from 0 to 1
+	DutyCycle float64 `json:"dutyCycle"`
+
+	Duration int64 `json:"duration"`
+}
+
+func (r *BurnCPURequest) Validate() error {
+	if r.Goroutines < 1 {
+		return errors.New("Goroutines must be at least 1")
+	}
+
+	if r.DutyCycle <= 0 || r.DutyCycle > 1 {
+		return errors.New("DutyCycle must be greater than 0 and at most 1")
+	}
+
+	if r.Duration <= 0 {
+		return errors.New("Duration must be positive")
+	}
+
+	return nil
+}
+
+// Current CPU burn, Until being zero when idle
+type CPUBurnResponse struct {
+	Goroutines int       `json:"goroutines"`
+	DutyCycle  float64   `json:"dutyCycle"`
+	Until      time.Time `json:"until"`
+}
+
+// Goroutines spinning to saturate the CPUs, one burn at a time
+type CPUBurner struct {
+	mutex   sync.Mutex
+	stop    chan struct{}
+	current CPUBurnResponse
+}
+
+func NewCPUBurner() *CPUBurner {
+	return &CPUBurner{}
+}
+
+// Replaces the current burn, if any
+func (b *CPUBurner) burn(request BurnCPURequest) CPUBurnResponse {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stopLocked()
+
+	duration := time.Duration(request.Duration) * time.Millisecond
+	busy := time.Duration(request.DutyCycle * float64(CPUBurnPeriod))
+
+	stop := make(chan struct{})
+	b.stop = stop
+
+	b.current = CPUBurnResponse{
+		Goroutines: request.Goroutines,
+		DutyCycle:  request.DutyCycle,
+		Until:      time.Now().Add(duration),
+	}
+
+	for i := 0; i < request.Goroutines; i++ {
+		go burnCycles(busy, b.current.Until, stop)
+	}
+
+	time.AfterFunc(duration, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		if b.stop == stop {
+			b.stopLocked()
+		}
+	})
+
+	return b.current
+}
+
+func (b *CPUBurner) stopBurn() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stopLocked()
+}
+
+func (b *CPUBurner) stopLocked() {
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+
+	b.current = CPUBurnResponse{}
+}
+
+func (b *CPUBurner) snapshot() CPUBurnResponse {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.current
+}
+
+// Spins for busy then sleeps for the rest of every period, until the
+// deadline or stop
+func burnCycles(busy time.Duration, deadline time.Time, stop <-chan struct{}) {
+	for time.Now().Before(deadline) {
+		spin(busy)
+
+		select {
+		case <-time.After(CPUBurnPeriod - busy):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Keeps the CPU busy for duration
+func spin(duration time.Duration) {
+	startTime := time.Now()
+
+	for time.Since(startTime) < duration {
+	}
+}
+
+func handleGetCPUBurn(burner *CPUBurner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, burner.snapshot())
+	}
+}
+
+func handleBurnCPU(burner *CPUBurner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request BurnCPURequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		if err := request.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		burning := burner.burn(request)
+
+		requestLog(c).WithFields(log.Fields{
+			"Goroutines": request.Goroutines,
+			"DutyCycle":  request.DutyCycle,
+			"Until":      burning.Until,
+		}).Info("Burning CPU")
+
+		c.JSON(http.StatusOK, burning)
+	}
+}
+
+func handleStopCPUBurn(burner *CPUBurner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		burner.stopBurn()
+
+		requestLog(c).Info("CPU burn stopped")
+
+		c.JSON(http.StatusOK, burner.snapshot())
+	}
+}
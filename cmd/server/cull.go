@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Closes keep-alive connections once idle for the period of the settings,
+// independently of the IdleTimeout of the server
+type IdleCuller struct {
+	settings *SettingsStore
+
+	mutex  sync.Mutex
+	timers map[net.Conn]*time.Timer
+}
+
+func NewIdleCuller(settings *SettingsStore) *IdleCuller {
+	return &IdleCuller{
+		settings: settings,
+		timers:   make(map[net.Conn]*time.Timer),
+	}
+}
+
+// Schedules idle connections to be closed, for http.Server.ConnState
+func (c *IdleCuller) connState(conn net.Conn, state http.ConnState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if timer, ok := c.timers[conn]; ok {
+		timer.Stop()
+		delete(c.timers, conn)
+	}
+
+	if state != http.StateIdle {
+		return
+	}
+
+	current := c.settings.Get()
+	if current.CullIdleAfter == 0 {
+		return
+	}
+
+	after := time.Duration(current.CullIdleAfter) * time.Millisecond
+
+	if current.CullIdleRandom {
+		after = time.Duration(rand.Int63n(int64(after) + 1))
+	}
+
+	var timer *time.Timer
+
+	timer = time.AfterFunc(after, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		// Went active again while the timer fired
+		if c.timers[conn] != timer {
+			return
+		}
+
+		delete(c.timers, conn)
+
+		log.WithFields(log.Fields{
+			"Conn":      conn.RemoteAddr().String(),
+			"IdleAfter": after,
+		}).Debug("Culling idle connection")
+
+		conn.Close()
+	})
+
+	c.timers[conn] = timer
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Per-request delay override, either a duration (750ms) or a range
+// (200ms..400ms) picked uniformly
+const (
+	DelayQuery  = "delay"
+	DelayHeader = "X-Delay"
+
+	// Longest delay a request can ask for
+	MaxDelayOverride = 5000 * time.Millisecond
+)
+
+// Delay requested by the request itself, if any, the query parameter
+// taking precedence over the header
+func delayOverride(c *gin.Context, max time.Duration) (time.Duration, bool, error) {
+	value := c.Query(DelayQuery)
+	if value == "" {
+		value = c.GetHeader(DelayHeader)
+	}
+
+	if value == "" {
+		return 0, false, nil
+	}
+
+	if max == 0 {
+		return 0, false, fmt.Errorf("delay overrides are disabled")
+	}
+
+	min, maxDelay, err := parseDelayRange(value)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if maxDelay > max {
+		return 0, false, fmt.Errorf("delay [%s] exceeds the maximum of %v", value, max)
+	}
+
+	delay := min
+
+	if maxDelay > min {
+		delay += time.Duration(rand.Int63n(int64(maxDelay - min)))
+	}
+
+	return delay, true, nil
+}
+
+func parseDelayRange(value string) (time.Duration, time.Duration, error) {
+	bounds := strings.SplitN(value, "..", 2)
+
+	min, err := time.ParseDuration(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid delay [%s]: %v", value, err)
+	}
+
+	max := min
+
+	if len(bounds) == 2 {
+		if max, err = time.ParseDuration(strings.TrimSpace(bounds[1])); err != nil {
+			return 0, 0, fmt.Errorf("invalid delay [%s]: %v", value, err)
+		}
+	}
+
+	if min < 0 || max < min {
+		return 0, 0, fmt.Errorf("invalid delay [%s]: bounds must be positive and ordered", value)
+	}
+
+	return min, max, nil
+}
+
+// Delay distributions
+const (
+	DistributionUniform     = "uniform"
+	DistributionConstant    = "constant"
+	DistributionNormal      = "normal"
+	DistributionExponential = "exponential"
+	DistributionLogNormal   = "lognormal"
+	DistributionPareto      = "pareto"
+	DistributionBimodal     = "bimodal"
+)
+
+// Shape of the delay between MinimumDelay and MaximumDelay, durations in
+// milliseconds. Delays are clamped to MaximumDelay unless it is 0.
+type DelayDistribution struct {
+	// uniform (default) between the minimum and maximum, constant at the
+	// minimum, normal, exponential, lognormal, pareto or bimodal
+	Distribution string `json:"distribution"`
+
+	// normal: Mean and StdDev; exponential: Mean, above the minimum
+	Mean   int64 `json:"mean"`
+	StdDev int64 `json:"stdDev"`
+
+	// lognormal: Median and Sigma of the underlying normal distribution
+	Median int64   `json:"median"`
+	Sigma  float64 `json:"sigma"`
+
+	// pareto: Shape (alpha), the minimum being the scale
+	Shape float64 `json:"shape"`
+
+	// bimodal: share of the requests delayed by the maximum instead of the
+	// minimum
+	SlowProbability float64 `json:"slowProbability"`
+}
+
+func (d *DelayDistribution) validate(minimum, maximum int64) error {
+	switch d.Distribution {
+	case "", DistributionUniform, DistributionConstant:
+	case DistributionNormal:
+		if d.Mean < 0 || d.StdDev < 0 {
+			return errors.New("normal Mean and StdDev can not be negative")
+		}
+	case DistributionExponential:
+		if d.Mean <= minimum {
+			return errors.New("exponential Mean must be greater than MinimumDelay")
+		}
+	case DistributionLogNormal:
+		if d.Median <= 0 || d.Sigma < 0 {
+			return errors.New("lognormal Median must be positive and Sigma can not be negative")
+		}
+	case DistributionPareto:
+		if minimum <= 0 || d.Shape <= 0 {
+			return errors.New("pareto requires a positive MinimumDelay and Shape")
+		}
+	case DistributionBimodal:
+		if d.SlowProbability < 0 || d.SlowProbability > 1 {
+			return errors.New("bimodal SlowProbability must be between 0 and 1")
+		}
+	default:
+		return fmt.Errorf("unknown distribution [%s]", d.Distribution)
+	}
+
+	return nil
+}
+
+// Delay drawn from the distribution
+func calculateDelay(settings Settings) time.Duration {
+	d := &settings.DelayDistribution
+	minimum, maximum := float64(settings.MinimumDelay), float64(settings.MaximumDelay)
+
+	var delay float64
+
+	switch d.Distribution {
+	case DistributionConstant:
+		delay = minimum
+	case DistributionNormal:
+		delay = float64(d.Mean) + rand.NormFloat64()*float64(d.StdDev)
+	case DistributionExponential:
+		delay = minimum + rand.ExpFloat64()*(float64(d.Mean)-minimum)
+	case DistributionLogNormal:
+		delay = float64(d.Median) * math.Exp(d.Sigma*rand.NormFloat64())
+	case DistributionPareto:
+		delay = minimum / math.Pow(1-rand.Float64(), 1/d.Shape)
+	case DistributionBimodal:
+		delay = minimum
+
+		if rand.Float64() < d.SlowProbability {
+			delay = maximum
+		}
+	default:
+		delay = minimum + rand.Float64()*(maximum-minimum)
+	}
+
+	if delay < minimum {
+		delay = minimum
+	}
+
+	if maximum > 0 && delay > maximum {
+		delay = maximum
+	}
+
+	return time.Duration(delay * float64(time.Millisecond))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Server-Sent Events settings, the query parameters of /events
+const (
+	// Events per second, and how long the stream lasts, by default
+	EventsRate     = 1
+	EventsDuration = 10 * time.Second
+
+	MaxEventsRate     = 1000
+	MaxEventsDuration = 10 * time.Minute
+
+	EventsRateQuery     = "rate"
+	EventsDurationQuery = "duration"
+
+	// Flush every event (true by default), or let the server buffer them
+	EventsFlushQuery = "flush"
+
+	// Stall the stream for stallFor after stallAfter events
+	EventsStallAfterQuery = "stallAfter"
+	EventsStallForQuery   = "stallFor"
+)
+
+type eventsRequest struct {
+	interval   time.Duration
+	duration   time.Duration
+	flush      bool
+	stallAfter int
+	stallFor   time.Duration
+}
+
+func parseEventsRequest(c *gin.Context) (*eventsRequest, error) {
+	request := &eventsRequest{
+		interval: time.Second / EventsRate,
+		duration: EventsDuration,
+		flush:    true,
+	}
+
+	if value := c.Query(EventsRateQuery); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 || rate > MaxEventsRate {
+			return nil, fmt.Errorf("rate must be above 0 and at most %d", MaxEventsRate)
+		}
+
+		request.interval = time.Duration(float64(time.Second) / rate)
+	}
+
+	if value := c.Query(EventsDurationQuery); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 || duration > MaxEventsDuration {
+			return nil, fmt.Errorf("duration must be between 0 and %v", MaxEventsDuration)
+		}
+
+		request.duration = duration
+	}
+
+	if value := c.Query(EventsFlushQuery); value != "" {
+		flush, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("flush must be true or false")
+		}
+
+		request.flush = flush
+	}
+
+	if value := c.Query(EventsStallAfterQuery); value != "" {
+		stallAfter, err := strconv.Atoi(value)
+		if err != nil || stallAfter < 0 {
+			return nil, errors.New("stallAfter can not be negative")
+		}
+
+		request.stallAfter = stallAfter
+	}
+
+	if value := c.Query(EventsStallForQuery); value != "" {
+		stallFor, err := time.ParseDuration(value)
+		if err != nil || stallFor < 0 || stallFor > MaxEventsDuration {
+			return nil, fmt.Errorf("stallFor must be between 0 and %v", MaxEventsDuration)
+		}
+
+		request.stallFor = stallFor
+	}
+
+	return request, nil
+}
+
+// Streams numbered events at the requested rate until the duration
+// elapsed. The server WriteTimeout still applies, cutting streams lasting
+// longer.
+func handleEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request, err := parseEventsRequest(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Status(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+		c.Writer.Flush()
+
+		done := c.Request.Context().Done()
+		end := time.After(request.duration)
+
+		ticker := time.NewTicker(request.interval)
+		defer ticker.Stop()
+
+		for n := 1; ; n++ {
+			select {
+			case <-ticker.C:
+			case <-end:
+				return
+			case <-done:
+				return
+			}
+
+			if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: tick\ndata: {\"n\":%d,\"time\":%q}\n\n",
+				n, n, time.Now().Format(time.RFC3339Nano)); err != nil {
+				return
+			}
+
+			if request.flush {
+				c.Writer.Flush()
+			}
+
+			if n == request.stallAfter && request.stallFor > 0 {
+				select {
+				case <-time.After(request.stallFor):
+				case <-done:
+					return
+				}
+			}
+		}
+	}
+}
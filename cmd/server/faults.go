@@ -0,0 +1,659 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Error returned instead of the response of a route, with a probability.
+// Only one of Status, Delay, Reset, GoAway, Truncate, Malformed, Blackhole,
+// Leak, Panic, BurnCPU, HeaderDelay, HeaderBytes, DripBytes and CorruptBytes
+// or CorruptDigest is set.
+type Fault struct {
+	Status int `json:"status,omitempty" yaml:"status,omitempty"`
+
+	// Milliseconds slept before the handler runs. Delays are drawn
+	// independently of the other faults, their probability not counting in
+	// the total of the route.
+	Delay int64 `json:"delay,omitempty" yaml:"delay,omitempty"`
+
+	// Resets the connection instead, before the headers or mid-body
+	Reset string `json:"reset,omitempty" yaml:"reset,omitempty"`
+
+	// Answers normally, then closes the connection, with a GOAWAY over
+	// HTTP/2 once the streams in flight are done
+	GoAway bool `json:"goAway,omitempty" yaml:"go_away,omitempty"`
+
+	// Closes the connection cleanly before the end of the body, either
+	// short of its Content-Length or of the last chunk
+	Truncate string `json:"truncate,omitempty" yaml:"truncate,omitempty"`
+
+	// Writes a response with invalid chunked encoding, a bogus status line,
+	// an illegal header or duplicate and conflicting headers instead
+	Malformed string `json:"malformed,omitempty" yaml:"malformed,omitempty"`
+
+	// Never answers, until the client gives up or for BlackholeFor
+	// milliseconds when set, after which the connection is closed
+	Blackhole    bool  `json:"blackhole,omitempty" yaml:"blackhole,omitempty"`
+	BlackholeFor int64 `json:"blackholeFor,omitempty" yaml:"blackhole_for,omitempty"`
+
+	// Blocks the handler for good, whatever the client does, until released
+	// with POST /admin/leaks/release
+	Leak bool `json:"leak,omitempty" yaml:"leak,omitempty"`
+
+	// Panics, turned into a 500 by the recovery middleware when enabled
+	Panic bool `json:"panic,omitempty" yaml:"panic,omitempty"`
+
+	// Milliseconds of CPU spun before the handler runs, unlike the delay
+	// which sleeps
+	BurnCPU int64 `json:"burnCPU,omitempty" yaml:"burn_cpu,omitempty"`
+
+	// Milliseconds the response headers are held back, the route answering
+	// normally otherwise
+	HeaderDelay int64 `json:"headerDelay,omitempty" yaml:"header_delay,omitempty"`
+
+	// Bytes of padding added to the response headers, spread over
+	// HeaderCount headers (1 when 0), the route answering normally
+	// otherwise
+	HeaderBytes int `json:"headerBytes,omitempty" yaml:"header_bytes,omitempty"`
+	HeaderCount int `json:"headerCount,omitempty" yaml:"header_count,omitempty"`
+
+	// Bytes of the body sent every DripInterval milliseconds, the headers
+	// being sent right away
+	DripBytes    int   `json:"dripBytes,omitempty" yaml:"drip_bytes,omitempty"`
+	DripInterval int64 `json:"dripInterval,omitempty" yaml:"drip_interval,omitempty"`
+
+	// Bytes of the body flipped, the Digest and ETag headers matching the
+	// original body unless CorruptDigest is set
+	CorruptBytes  int  `json:"corruptBytes,omitempty" yaml:"corrupt_bytes,omitempty"`
+	CorruptDigest bool `json:"corruptDigest,omitempty" yaml:"corrupt_digest,omitempty"`
+
+	// From 0 to 1, the faults of a route adding up to at most 1
+	Probability float64 `json:"probability" yaml:"probability"`
+
+	// Seconds sent in a Retry-After header (0 leaves it out), as an
+	// HTTP-date that many seconds from now when RetryAfterDate is set
+	RetryAfter     int64 `json:"retryAfter,omitempty" yaml:"retry_after,omitempty"`
+	RetryAfterDate bool  `json:"retryAfterDate,omitempty" yaml:"retry_after_date,omitempty"`
+
+	// When and to which requests the fault applies
+	FaultSchedule `yaml:",inline"`
+	FaultScope    `yaml:",inline"`
+}
+
+// Header identifying the client instance, for faults scoped by ClientIDs
+const ClientIDHeader = "X-Client-Id"
+
+// Requests a fault applies to, all of them when empty. All the conditions
+// set must hold.
+type FaultScope struct {
+	// Only requests carrying the header, with the value when set, e.g.
+	// X-Fault: reset
+	MatchHeader string `json:"matchHeader,omitempty" yaml:"match_header,omitempty"`
+	MatchValue  string `json:"matchValue,omitempty" yaml:"match_value,omitempty"`
+
+	// Only clients connecting from one of the IPs or CIDR ranges
+	ClientIPs []string `json:"clientIPs,omitempty" yaml:"client_ips,omitempty"`
+
+	// Only clients sending one of the ids in X-Client-Id
+	ClientIDs []string `json:"clientIDs,omitempty" yaml:"client_ids,omitempty"`
+}
+
+func (s *FaultScope) validate() error {
+	if s.MatchValue != "" && s.MatchHeader == "" {
+		return errors.New("MatchHeader must be set with MatchValue")
+	}
+
+	for _, client := range s.ClientIPs {
+		if _, err := parseClientIP(client); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Whether only some requests are in the scope
+func (s *FaultScope) scoped() bool {
+	return s.MatchHeader != "" || len(s.ClientIPs) > 0 || len(s.ClientIDs) > 0
+}
+
+// IP as a single address range, or CIDR range
+func parseClientIP(client string) (*net.IPNet, error) {
+	if ip := net.ParseIP(client); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(client)
+	if err != nil {
+		return nil, fmt.Errorf("client [%s] is neither an IP nor a CIDR range", client)
+	}
+
+	return network, nil
+}
+
+func (s *FaultScope) matches(req *http.Request) bool {
+	return s.matchesHeader(req) && s.matchesClientIP(req) && s.matchesClientID(req)
+}
+
+func (s *FaultScope) matchesClientIP(req *http.Request) bool {
+	if len(s.ClientIPs) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, client := range s.ClientIPs {
+		if network, err := parseClientIP(client); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *FaultScope) matchesClientID(req *http.Request) bool {
+	if len(s.ClientIDs) == 0 {
+		return true
+	}
+
+	id := req.Header.Get(ClientIDHeader)
+
+	for _, client := range s.ClientIDs {
+		if id == client {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *FaultScope) matchesHeader(req *http.Request) bool {
+	if s.MatchHeader == "" {
+		return true
+	}
+
+	values, ok := req.Header[http.CanonicalHeaderKey(s.MatchHeader)]
+	if !ok {
+		return false
+	}
+
+	if s.MatchValue == "" {
+		return true
+	}
+
+	for _, value := range values {
+		if value == s.MatchValue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Faults by route, e.g. /pong, or * for all routes but the control ones
+type Faults map[string][]Fault
+
+// Endpoints changing the behavior of the server, which faults never apply
+// to so they can always be removed
+func controlEndpoint(method, route string) bool {
+	return strings.HasPrefix(route, "/admin") || strings.HasPrefix(route, "/chaos") ||
+		(route == "/delay" && method != http.MethodGet)
+}
+
+// Route whose faults apply to every route, after their own
+const FaultsAllRoutes = "*"
+
+func (f Faults) validate() error {
+	for route, faults := range f {
+		if route != FaultsAllRoutes && !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("fault route [%s] must start with / or be *", route)
+		}
+
+		// Keeps the admin API reachable
+		if strings.HasPrefix(route, "/admin") || strings.HasPrefix(route, "/chaos") {
+			return fmt.Errorf("fault route [%s] can not be a control endpoint", route)
+		}
+
+		for _, fault := range faults {
+			if err := fault.validate(); err != nil {
+				return fmt.Errorf("invalid fault of route [%s]: %v", route, err)
+			}
+		}
+
+		drawn := faults
+		if route != FaultsAllRoutes {
+			drawn = f.route(route)
+		}
+
+		// pick draws once from the faults of the route and of all routes.
+		// Scopes may overlap, so a request can match all the scoped faults
+		// and they all count.
+		total := 0.0
+
+		for _, fault := range drawn {
+			if fault.Delay == 0 {
+				total += fault.Probability
+			}
+		}
+
+		if total > 1 {
+			return fmt.Errorf("fault probabilities of route [%s] add up to more than 1", route)
+		}
+	}
+
+	return nil
+}
+
+func (f *Fault) validate() error {
+	kinds := 0
+
+	for _, set := range []bool{f.Status != 0, f.Delay != 0, f.Reset != "", f.GoAway, f.Truncate != "", f.Malformed != "", f.Blackhole, f.Leak, f.Panic, f.BurnCPU != 0, f.HeaderDelay != 0, f.HeaderBytes != 0, f.DripBytes != 0, f.CorruptBytes != 0 || f.CorruptDigest} {
+		if set {
+			kinds++
+		}
+	}
+
+	if kinds != 1 {
+		return errors.New("exactly one of Status, Delay, Reset, GoAway, Truncate, Malformed, Blackhole, Leak, Panic, BurnCPU, HeaderDelay, HeaderBytes, DripBytes and CorruptBytes or CorruptDigest must be set")
+	}
+
+	if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+		return fmt.Errorf("Status [%d] must be a 4xx or 5xx status", f.Status)
+	}
+
+	if f.Reset != "" && f.Reset != FaultResetHeaders && f.Reset != FaultResetBody {
+		return fmt.Errorf("unknown Reset [%s]", f.Reset)
+	}
+
+	if f.Truncate != "" && f.Truncate != FaultTruncateLength && f.Truncate != FaultTruncateChunked {
+		return fmt.Errorf("unknown Truncate [%s]", f.Truncate)
+	}
+
+	if _, ok := malformedResponses[f.Malformed]; f.Malformed != "" && !ok {
+		return fmt.Errorf("unknown Malformed [%s]", f.Malformed)
+	}
+
+	if f.Probability < 0 || f.Delay < 0 || f.RetryAfter < 0 || f.BlackholeFor < 0 || f.BurnCPU < 0 || f.HeaderDelay < 0 || f.HeaderBytes < 0 || f.HeaderCount < 0 || f.DripBytes < 0 || f.DripInterval < 0 || f.CorruptBytes < 0 {
+		return errors.New("Probability, Delay, RetryAfter, BlackholeFor, BurnCPU, HeaderDelay, HeaderBytes, HeaderCount, DripBytes, DripInterval and CorruptBytes can not be negative")
+	}
+
+	if f.RetryAfterDate && f.RetryAfter == 0 {
+		return errors.New("RetryAfter must be set with RetryAfterDate")
+	}
+
+	if err := f.FaultSchedule.validate(); err != nil {
+		return err
+	}
+
+	if f.HeaderCount > f.HeaderBytes {
+		return errors.New("HeaderCount can not exceed HeaderBytes")
+	}
+
+	if f.DripBytes > 0 && f.DripInterval == 0 {
+		return errors.New("DripInterval must be set with DripBytes")
+	}
+
+	return f.FaultScope.validate()
+}
+
+// Whether the request is in the scope of the fault and the time falls into
+// one of its windows, if it has any
+func (f *Fault) active(req *http.Request, now time.Time) bool {
+	return f.matches(req) && f.FaultSchedule.active(now)
+}
+
+// Faults of the route followed by the ones of all routes
+func (f Faults) route(route string) []Fault {
+	if strings.HasPrefix(route, "/admin") {
+		return nil
+	}
+
+	return append(f[route][:len(f[route]):len(f[route])], f[FaultsAllRoutes]...)
+}
+
+// Sum of the delays drawn for the request to the route
+func (f Faults) delay(route string, req *http.Request) time.Duration {
+	var delay time.Duration
+
+	now := time.Now()
+
+	for _, fault := range f.route(route) {
+		if fault.Delay > 0 && fault.active(req, now) && rand.Float64() < fault.Probability {
+			delay += time.Duration(fault.Delay) * time.Millisecond
+		}
+	}
+
+	return delay
+}
+
+// Fault other than a delay to inject into the request to the route, if any
+func (f Faults) pick(route string, req *http.Request) *Fault {
+	faults := f.route(route)
+	if len(faults) == 0 {
+		return nil
+	}
+
+	draw := rand.Float64()
+	now := time.Now()
+
+	for i := range faults {
+		if faults[i].Delay > 0 || !faults[i].active(req, now) {
+			continue
+		}
+
+		if draw < faults[i].Probability {
+			return &faults[i]
+		}
+
+		draw -= faults[i].Probability
+	}
+
+	return nil
+}
+
+// Delays the request by the delay faults drawn for the route, then answers
+// with one of its other faults instead of running its handler, if any is
+// drawn
+func WithFaults(settings *SettingsStore, connections *Connections, leaks *Leaks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current := settings.Get()
+		if !current.Middlewares.Faults || controlEndpoint(c.Request.Method, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		if delay := current.Faults.delay(c.FullPath(), c.Request); delay > 0 {
+			requestLog(c).Debug("Faults - Delay ", delay)
+
+			_, span := startSpan(c, "fault-delay")
+
+			select {
+			case <-time.After(delay):
+				span.End()
+			case <-c.Request.Context().Done():
+				span.End()
+				c.Abort()
+				return
+			}
+		}
+
+		fault := current.Faults.pick(c.FullPath(), c.Request)
+		if fault == nil {
+			c.Next()
+			return
+		}
+
+		if fault.Reset != "" {
+			requestLog(c).Debug("Faults - Reset ", fault.Reset)
+			c.Abort()
+			resetConnection(c, connections, fault.Reset)
+			return
+		}
+
+		// HTTP/2 servers turn it into a GOAWAY
+		if fault.GoAway {
+			requestLog(c).Debug("Faults - GOAWAY")
+			c.Header("Connection", "close")
+			c.Next()
+			return
+		}
+
+		if fault.Truncate != "" {
+			requestLog(c).Debug("Faults - Truncate ", fault.Truncate)
+			c.Abort()
+			truncateResponse(c, fault.Truncate)
+			return
+		}
+
+		if fault.Malformed != "" {
+			requestLog(c).Debug("Faults - Malformed ", fault.Malformed)
+			c.Abort()
+			writeMalformed(c, fault.Malformed)
+			return
+		}
+
+		if fault.Blackhole {
+			requestLog(c).Debug("Faults - Blackhole")
+			c.Abort()
+			blackhole(c, time.Duration(fault.BlackholeFor)*time.Millisecond)
+			return
+		}
+
+		if fault.Leak {
+			requestLog(c).Debug("Faults - Leak")
+			c.Abort()
+			leaks.leak()
+			return
+		}
+
+		if fault.Panic {
+			panic("injected panic")
+		}
+
+		if fault.BurnCPU > 0 {
+			requestLog(c).Debug("Faults - Burning CPU ", fault.BurnCPU, "ms")
+			spin(time.Duration(fault.BurnCPU) * time.Millisecond)
+			c.Next()
+			return
+		}
+
+		if fault.CorruptBytes > 0 || fault.CorruptDigest {
+			requestLog(c).Debug("Faults - Corrupt ", fault.CorruptBytes, " bytes")
+			corruptResponse(c, fault.CorruptBytes, fault.CorruptDigest)
+			return
+		}
+
+		if fault.HeaderDelay > 0 {
+			requestLog(c).Debug("Faults - Holding headers back ", fault.HeaderDelay, "ms")
+			c.Writer = newSlowHeaderWriter(c, time.Duration(fault.HeaderDelay)*time.Millisecond)
+			c.Next()
+			return
+		}
+
+		if fault.HeaderBytes > 0 {
+			requestLog(c).Debug("Faults - Padding headers with ", fault.HeaderBytes, " bytes")
+			padHeaders(c, fault.HeaderBytes, fault.HeaderCount)
+			c.Next()
+			return
+		}
+
+		if fault.DripBytes > 0 {
+			requestLog(c).Debug("Faults - Dripping ", fault.DripBytes, " bytes every ", fault.DripInterval, "ms")
+			c.Writer = newDripWriter(c, fault.DripBytes, time.Duration(fault.DripInterval)*time.Millisecond)
+			c.Next()
+			return
+		}
+
+		if fault.RetryAfterDate {
+			retryAt := time.Now().Add(time.Duration(fault.RetryAfter) * time.Second)
+			c.Header("Retry-After", retryAt.UTC().Format(http.TimeFormat))
+		} else if fault.RetryAfter > 0 {
+			c.Header("Retry-After", strconv.FormatInt(fault.RetryAfter, 10))
+		}
+
+		requestLog(c).Debug("Faults - Injected ", fault.Status)
+		c.AbortWithStatusJSON(fault.Status, buildError(c, "injected fault"))
+	}
+}
+
+// Adds count headers whose values add up to size bytes, to exceed the
+// client MaxResponseHeaderBytes
+func padHeaders(c *gin.Context, size int, count int) {
+	if count == 0 {
+		count = 1
+	}
+
+	for i := 0; i < count; i++ {
+		length := size / count
+		if i < size%count {
+			length++
+		}
+
+		c.Header("X-Padding-"+strconv.Itoa(i), strings.Repeat("x", length))
+	}
+}
+
+// Response writer stalling before the headers are written, whatever the
+// handler does before, so the client ResponseHeaderTimeout fires on its own
+type slowHeaderWriter struct {
+	gin.ResponseWriter
+
+	delay time.Duration
+	done  <-chan struct{}
+	once  sync.Once
+}
+
+func newSlowHeaderWriter(c *gin.Context, delay time.Duration) *slowHeaderWriter {
+	return &slowHeaderWriter{
+		ResponseWriter: c.Writer,
+		delay:          delay,
+		done:           c.Request.Context().Done(),
+	}
+}
+
+func (w *slowHeaderWriter) stall() {
+	w.once.Do(func() {
+		select {
+		case <-time.After(w.delay):
+		case <-w.done:
+		}
+	})
+}
+
+func (w *slowHeaderWriter) WriteHeaderNow() {
+	w.stall()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *slowHeaderWriter) Write(data []byte) (int, error) {
+	w.stall()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *slowHeaderWriter) WriteString(s string) (int, error) {
+	w.stall()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *slowHeaderWriter) Flush() {
+	w.stall()
+	w.ResponseWriter.Flush()
+}
+
+// Response writer sending the headers right away, then the body a few bytes
+// at a time, flushing every chunk
+type dripWriter struct {
+	gin.ResponseWriter
+
+	bytes    int
+	interval time.Duration
+	done     <-chan struct{}
+}
+
+func newDripWriter(c *gin.Context, bytes int, interval time.Duration) *dripWriter {
+	return &dripWriter{
+		ResponseWriter: c.Writer,
+		bytes:          bytes,
+		interval:       interval,
+		done:           c.Request.Context().Done(),
+	}
+}
+
+func (w *dripWriter) Write(data []byte) (int, error) {
+	w.ResponseWriter.WriteHeaderNow()
+	w.ResponseWriter.Flush()
+
+	written := 0
+
+	for written < len(data) {
+		end := written + w.bytes
+		if end > len(data) {
+			end = len(data)
+		}
+
+		n, err := w.ResponseWriter.Write(data[written:end])
+		written += n
+
+		if err != nil {
+			return written, err
+		}
+
+		w.ResponseWriter.Flush()
+
+		if written == len(data) {
+			break
+		}
+
+		select {
+		case <-time.After(w.interval):
+		case <-w.done:
+			return written, errors.New("request cancelled while dripping the body")
+		}
+	}
+
+	return written, nil
+}
+
+func (w *dripWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Replace faults request, routes left out having none
+type UpdateFaultsRequest struct {
+	Faults Faults `json:"faults"`
+}
+
+func handleGetFaults(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, UpdateFaultsRequest{Faults: settings.Get().Faults})
+	}
+}
+
+func handleUpdateFaults(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request UpdateFaultsRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		updated, err := settings.Update(newAuditEntry(c), func(s *Settings) {
+			s.Faults = request.Faults
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		requestLog(c).WithFields(log.Fields{
+			"Faults": updated.Faults,
+		}).Info("Faults updated")
+
+		c.JSON(http.StatusOK, UpdateFaultsRequest{Faults: updated.Faults})
+	}
+}
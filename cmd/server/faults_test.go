@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFaultValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault Fault
+		valid bool
+	}{
+		{"status", Fault{Status: 503, Probability: 0.5}, true},
+		{"no kind", Fault{Probability: 0.5}, false},
+		{"two kinds", Fault{Status: 500, Reset: FaultResetBody}, false},
+		{"2xx status", Fault{Status: 200}, false},
+		{"unknown reset", Fault{Reset: "later"}, false},
+		{"unknown truncate", Fault{Truncate: "half"}, false},
+		{"negative probability", Fault{Status: 500, Probability: -0.1}, false},
+		{"negative delay", Fault{Delay: -1}, false},
+		{"retry after date", Fault{Status: 503, RetryAfter: 5, RetryAfterDate: true}, true},
+		{"retry after date without seconds", Fault{Status: 503, RetryAfterDate: true}, false},
+		{"header count over bytes", Fault{HeaderBytes: 2, HeaderCount: 3}, false},
+		{"drip without interval", Fault{DripBytes: 10}, false},
+		{"drip", Fault{DripBytes: 10, DripInterval: 100}, true},
+		{"corrupt digest", Fault{CorruptDigest: true}, true},
+		{"match value without header", Fault{Status: 500, FaultScope: FaultScope{MatchValue: "reset"}}, false},
+		{"invalid client IP", Fault{Status: 500, FaultScope: FaultScope{ClientIPs: []string{"10.0.0"}}}, false},
+		{"client CIDR", Fault{Status: 500, FaultScope: FaultScope{ClientIPs: []string{"10.0.0.0/8", "::1"}}}, true},
+		{"invalid schedule", Fault{Status: 500, FaultSchedule: FaultSchedule{Every: 1000}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.fault.validate()
+
+			if test.valid && err != nil {
+				t.Errorf("validate() returned error [%v], expected none", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("validate() returned no error, expected one")
+			}
+		})
+	}
+}
+
+func TestFaultsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults Faults
+		valid  bool
+	}{
+		{"route", Faults{"/pong": {{Status: 500, Probability: 0.5}}}, true},
+		{"all routes", Faults{FaultsAllRoutes: {{Status: 500, Probability: 0.5}}}, true},
+		{"relative route", Faults{"pong": {{Status: 500, Probability: 0.5}}}, false},
+		{"admin route", Faults{"/admin/faults": {{Status: 500, Probability: 0.5}}}, false},
+		{"chaos route", Faults{"/chaos/cpu": {{Status: 500, Probability: 0.5}}}, false},
+		{"probabilities over 1", Faults{"/pong": {{Status: 500, Probability: 0.6}, {Status: 503, Probability: 0.6}}}, false},
+		{"delays not counted", Faults{"/pong": {{Status: 500, Probability: 0.6}, {Delay: 100, Probability: 0.6}}}, true},
+		{
+			"scoped fault over the rest",
+			Faults{"/pong": {
+				{Status: 500, Probability: 0.6},
+				{Status: 503, Probability: 1, FaultScope: FaultScope{MatchHeader: "X-Fault"}},
+			}},
+			false,
+		},
+		{
+			"scoped faults within the rest",
+			Faults{"/pong": {
+				{Status: 500, Probability: 0.5},
+				{Status: 503, Probability: 0.25, FaultScope: FaultScope{MatchHeader: "X-Fault"}},
+				{Status: 502, Probability: 0.25, FaultScope: FaultScope{ClientIDs: []string{"canary"}}},
+			}},
+			true,
+		},
+		{
+			"overlapping scoped faults",
+			Faults{"/pong": {
+				{Status: 503, Probability: 0.6, FaultScope: FaultScope{MatchHeader: "X-Fault"}},
+				{Status: 502, Probability: 0.6, FaultScope: FaultScope{ClientIPs: []string{"10.0.0.0/8"}}},
+			}},
+			false,
+		},
+		{"all routes counted", Faults{"/pong": {{Status: 500, Probability: 0.6}}, FaultsAllRoutes: {{Status: 503, Probability: 0.6}}}, false},
+		{"invalid fault", Faults{"/pong": {{Probability: 0.5}}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.faults.validate()
+
+			if test.valid && err != nil {
+				t.Errorf("validate() returned error [%v], expected none", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("validate() returned no error, expected one")
+			}
+		})
+	}
+}
+
+func TestFaultsPick(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		faults Faults
+		route  string
+		header string
+
+		// Status of the fault picked, 0 for none
+		status int
+	}{
+		{"certain fault", Faults{"/pong": {{Status: 500, Probability: 1}}}, "/pong", "", 500},
+		{"no fault", Faults{"/pong": {{Status: 500, Probability: 0}}}, "/pong", "", 0},
+		{"other route", Faults{"/pong": {{Status: 500, Probability: 1}}}, "/ping", "", 0},
+		{"all routes", Faults{FaultsAllRoutes: {{Status: 502, Probability: 1}}}, "/ping", "", 502},
+		{"route before all routes", Faults{"/pong": {{Status: 500, Probability: 1}}, FaultsAllRoutes: {{Status: 502, Probability: 1}}}, "/pong", "", 500},
+		{"not on admin routes", Faults{FaultsAllRoutes: {{Status: 502, Probability: 1}}}, "/admin/faults", "", 0},
+		{"delays drawn apart", Faults{"/pong": {{Delay: 100, Probability: 1}}}, "/pong", "", 0},
+		{"header missing", Faults{"/pong": {{Status: 500, Probability: 1, FaultScope: FaultScope{MatchHeader: "X-Fault"}}}}, "/pong", "", 0},
+		{"header present", Faults{"/pong": {{Status: 500, Probability: 1, FaultScope: FaultScope{MatchHeader: "X-Fault"}}}}, "/pong", "reset", 500},
+		{"header value mismatch", Faults{"/pong": {{Status: 500, Probability: 1, FaultScope: FaultScope{MatchHeader: "X-Fault", MatchValue: "delay"}}}}, "/pong", "reset", 0},
+		{"out of schedule", Faults{"/pong": {{Status: 500, Probability: 1, FaultSchedule: FaultSchedule{From: &future}}}}, "/pong", "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.route, nil)
+
+			if test.header != "" {
+				req.Header.Set("X-Fault", test.header)
+			}
+
+			status := 0
+
+			if fault := test.faults.pick(test.route, req); fault != nil {
+				status = fault.Status
+			}
+
+			if status != test.status {
+				t.Errorf("pick() picked status %d, expected %d", status, test.status)
+			}
+		})
+	}
+}
+
+func TestWithFaultsControlEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := DefaultConfig()
+
+	settings, err := NewSettingsStore(&config)
+	if err != nil {
+		t.Fatalf("NewSettingsStore() returned error [%v], expected none", err)
+	}
+
+	_, err = settings.Update(AuditEntry{}, func(s *Settings) {
+		s.Faults = Faults{FaultsAllRoutes: {{Status: 503, Probability: 1}}}
+	})
+	if err != nil {
+		t.Fatalf("Update() returned error [%v], expected none", err)
+	}
+
+	handler := gin.New()
+	handler.Use(WithFaults(settings, NewConnections(), NewLeaks()))
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	handler.GET("/delay", ok)
+	handler.PUT("/delay", ok)
+	handler.PUT("/chaos/cpu", ok)
+	handler.PUT("/admin/faults", ok)
+	handler.GET("/ping", ok)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/ping", 503},
+		{http.MethodGet, "/delay", 503},
+		{http.MethodPut, "/delay", 200},
+		{http.MethodPut, "/chaos/cpu", 200},
+		{http.MethodPut, "/admin/faults", 200},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(test.method, test.path, nil))
+
+			if recorder.Code != test.status {
+				t.Errorf("%s %s returned status %d, expected %d", test.method, test.path, recorder.Code, test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Per-request framing of the response body, the query parameter taking
+// precedence over the header
+const (
+	FramingQuery  = "framing"
+	FramingHeader = "X-Framing"
+
+	// Body held back and sent with an explicit Content-Length
+	FramingLength = "length"
+
+	// Body streamed without Content-Length, chunked over HTTP/1.1, flushed
+	// every flushEvery bytes or else after every write
+	FramingChunked = "chunked"
+
+	FlushEveryQuery = "flushEvery"
+)
+
+// Frames the response as the request asks for, on all routes, or leaves it
+// to the server when it does not. Over HTTP/2, where there is no chunked
+// encoding, chunked streams DATA frames without Content-Length.
+func WithFraming() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		framing := c.Query(FramingQuery)
+		if framing == "" {
+			framing = c.GetHeader(FramingHeader)
+		}
+
+		switch framing {
+		case "":
+			c.Next()
+
+		case FramingLength:
+			writer := &lengthWriter{ResponseWriter: c.Writer}
+			c.Writer = writer
+
+			c.Next()
+
+			c.Writer = writer.ResponseWriter
+
+			// Hijacked, or nothing to send for statuses without body
+			if c.Writer.Written() || !bodyAllowed(c.Writer.Status()) {
+				return
+			}
+
+			c.Header("Content-Length", strconv.Itoa(writer.body.Len()))
+			c.Writer.Write(writer.body.Bytes())
+
+		case FramingChunked:
+			flushEvery := 0
+
+			if value := c.Query(FlushEveryQuery); value != "" {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					c.AbortWithStatusJSON(http.StatusBadRequest, buildError(c, "flushEvery can not be negative"))
+					return
+				}
+
+				flushEvery = n
+			}
+
+			writer := &chunkedWriter{ResponseWriter: c.Writer, flushEvery: flushEvery}
+			c.Writer = writer
+
+			c.Next()
+
+			c.Writer = writer.ResponseWriter
+
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, buildError(c, fmt.Sprintf("framing must be %s or %s", FramingLength, FramingChunked)))
+		}
+	}
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// Response writer holding the body back until it is complete
+type lengthWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *lengthWriter) WriteHeaderNow() {}
+
+func (w *lengthWriter) Flush() {}
+
+func (w *lengthWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *lengthWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// Response writer dropping Content-Length and flushing as it writes, so the
+// server never frames the body itself
+type chunkedWriter struct {
+	gin.ResponseWriter
+	flushEvery int
+}
+
+func (w *chunkedWriter) Write(data []byte) (int, error) {
+	w.Header().Del("Content-Length")
+
+	if w.flushEvery == 0 {
+		n, err := w.ResponseWriter.Write(data)
+		w.ResponseWriter.Flush()
+
+		return n, err
+	}
+
+	written := 0
+
+	for written < len(data) {
+		end := written + w.flushEvery
+		if end > len(data) {
+			end = len(data)
+		}
+
+		n, err := w.ResponseWriter.Write(data[written:end])
+		written += n
+
+		if err != nil {
+			return written, err
+		}
+
+		w.ResponseWriter.Flush()
+	}
+
+	return written, nil
+}
+
+func (w *chunkedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gRPC settings
+const (
+	GRPCPingMethod = "/ping.Ping/Ping"
+
+	// Length-prefixed message header: compressed flag and big-endian length
+	grpcMessageHeaderLen = 5
+
+	// Largest request message read
+	grpcMaxMessageLen = 4 * 1024 * 1024
+)
+
+// gRPC status codes used
+const (
+	GRPCCodeOK               = 0
+	GRPCCodeDeadlineExceeded = 4
+	GRPCCodeInternal         = 13
+)
+
+// PingReply{message: "pong"}, field 1 as a length-delimited string
+var grpcPingReply = []byte{0x0a, 0x04, 'p', 'o', 'n', 'g'}
+
+// Errors returned by the gRPC Ping service instead of its reply
+type GRPCFaults struct {
+	// Share of the calls failing with the status code GRPCErrorCode, from
+	// 0 to 1
+	GRPCErrorRatio float64 `json:"grpcErrorRatio"`
+	GRPCErrorCode  int     `json:"grpcErrorCode"`
+}
+
+func (f *GRPCFaults) validate() error {
+	if f.GRPCErrorRatio < 0 || f.GRPCErrorRatio > 1 {
+		return errors.New("GRPCErrorRatio must be between 0 and 1")
+	}
+
+	if f.GRPCErrorRatio > 0 && (f.GRPCErrorCode < 1 || f.GRPCErrorCode > 16) {
+		return errors.New("GRPCErrorCode must be between 1 and 16")
+	}
+
+	return nil
+}
+
+// Unary Ping method of the ping.Ping service, served over HTTP/2 without
+// generated stubs. It waits for the delay of /pong, or of the x-delay
+// metadata, within the deadline of the grpc-timeout metadata, so deadline
+// propagation can be compared with the HTTP timeout middleware.
+func handleGRPCPing(config *Config, settings *SettingsStore, sticky *StickyDelays) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ProtoMajor != 2 {
+			c.JSON(http.StatusHTTPVersionNotSupported, buildError(c, "gRPC requires HTTP/2"))
+			return
+		}
+
+		c.Header("Content-Type", "application/grpc")
+
+		ctx := c.Request.Context()
+
+		if value := c.GetHeader("Grpc-Timeout"); value != "" {
+			timeout, err := parseGRPCTimeout(value)
+			if err != nil {
+				writeGRPCStatus(c, GRPCCodeInternal, err.Error())
+				return
+			}
+
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		if err := readGRPCMessage(c.Request.Body); err != nil {
+			writeGRPCStatus(c, GRPCCodeInternal, err.Error())
+			return
+		}
+
+		delay, ok, err := delayOverride(c, config.MaxDelayOverride)
+		if err != nil {
+			writeGRPCStatus(c, GRPCCodeInternal, err.Error())
+			return
+		}
+
+		current := settings.Get()
+
+		if !ok {
+			delay = calculateDelay(current) + sticky.delay(c, &current.StickyDelay)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			writeGRPCStatus(c, GRPCCodeDeadlineExceeded, ctx.Err().Error())
+			return
+		}
+
+		if current.GRPCErrorRatio > 0 && rand.Float64() < current.GRPCErrorRatio {
+			writeGRPCStatus(c, current.GRPCErrorCode, "injected error")
+			return
+		}
+
+		header := make([]byte, grpcMessageHeaderLen)
+		binary.BigEndian.PutUint32(header[1:], uint32(len(grpcPingReply)))
+
+		// The status follows the reply, in trailers
+		c.Header("Trailer", "Grpc-Status, Grpc-Message")
+		c.Status(http.StatusOK)
+		c.Writer.Write(header)
+		c.Writer.Write(grpcPingReply)
+
+		writeGRPCStatus(c, GRPCCodeOK, "")
+	}
+}
+
+// Sets the status, in the headers of a trailers-only response when nothing
+// was written yet, or else in the trailers declared
+func writeGRPCStatus(c *gin.Context, code int, message string) {
+	c.Status(http.StatusOK)
+	c.Writer.Header().Set("Grpc-Status", strconv.Itoa(code))
+
+	if message != "" {
+		c.Writer.Header().Set("Grpc-Message", message)
+	}
+
+	c.Writer.WriteHeaderNow()
+}
+
+// Reads and discards one length-prefixed message, the Ping request
+func readGRPCMessage(reader io.Reader) error {
+	header := make([]byte, grpcMessageHeaderLen)
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return fmt.Errorf("reading message failed: %v", err)
+	}
+
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > grpcMaxMessageLen {
+		return fmt.Errorf("message of %d bytes exceeds the maximum of %d", length, grpcMaxMessageLen)
+	}
+
+	if _, err := io.CopyN(ioutil.Discard, reader, int64(length)); err != nil {
+		return fmt.Errorf("reading message failed: %v", err)
+	}
+
+	return nil
+}
+
+// Timeout of the grpc-timeout format, at most 8 digits and a unit
+func parseGRPCTimeout(value string) (time.Duration, error) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("invalid grpc-timeout [%s]", value)
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid grpc-timeout [%s]", value)
+	}
+
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid grpc-timeout [%s]", value)
+	}
+
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Delays or aborts the TLS handshake of a share of the connections, to give
+// the client TLSHandshakeTimeout something real to fire against
+type HandshakeFaults struct {
+	// Share of the connections whose handshake waits HandshakeDelay
+	// milliseconds
+	HandshakeDelayRatio float64 `json:"handshakeDelayRatio"`
+	HandshakeDelay      int64   `json:"handshakeDelay"`
+
+	// Share of the connections reset instead of handshaking
+	HandshakeFailRatio float64 `json:"handshakeFailRatio"`
+}
+
+func (f *HandshakeFaults) validate() error {
+	if f.HandshakeDelayRatio < 0 || f.HandshakeDelayRatio > 1 || f.HandshakeFailRatio < 0 || f.HandshakeFailRatio > 1 {
+		return errors.New("HandshakeDelayRatio and HandshakeFailRatio must be between 0 and 1")
+	}
+
+	if f.HandshakeDelay < 0 {
+		return errors.New("HandshakeDelay can not be negative")
+	}
+
+	return nil
+}
+
+// Listener applying the handshake faults of the settings to the connections
+// it accepts, for TLS listeners
+func withHandshakeFaults(l net.Listener, settings *SettingsStore) net.Listener {
+	return &handshakeListener{Listener: l, settings: settings}
+}
+
+type handshakeListener struct {
+	net.Listener
+	settings *SettingsStore
+}
+
+func (l *handshakeListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	faults := l.settings.Get().HandshakeFaults
+
+	switch {
+	case faults.HandshakeFailRatio > 0 && rand.Float64() < faults.HandshakeFailRatio:
+		return &handshakeConn{Conn: conn, fail: true}, nil
+
+	case faults.HandshakeDelayRatio > 0 && rand.Float64() < faults.HandshakeDelayRatio:
+		return &handshakeConn{Conn: conn, delay: time.Duration(faults.HandshakeDelay) * time.Millisecond}, nil
+	}
+
+	return conn, nil
+}
+
+// Connection delaying or failing its first read, the one of the ClientHello
+type handshakeConn struct {
+	net.Conn
+
+	delay time.Duration
+	fail  bool
+	once  sync.Once
+}
+
+func (c *handshakeConn) Read(p []byte) (int, error) {
+	var err error
+
+	c.once.Do(func() {
+		if c.fail {
+			log.WithFields(log.Fields{
+				"Conn": c.RemoteAddr().String(),
+			}).Debug("Failing TLS handshake")
+
+			if tcpConn, ok := c.Conn.(interface{ SetLinger(int) error }); ok {
+				tcpConn.SetLinger(0)
+			}
+
+			c.Conn.Close()
+			err = errors.New("injected TLS handshake failure")
+			return
+		}
+
+		time.Sleep(c.delay)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Read(p)
+}
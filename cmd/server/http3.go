@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	log "github.com/sirupsen/logrus"
+)
+
+// HTTP/3 server on the UDP port of a TLS listener, sharing the handler of
+// its server, which then advertises it to clients in Alt-Svc. Connection
+// tracking, handshake faults and the server timeouts do not apply to it.
+func newHTTP3Server(server *http.Server) *http3.Server {
+	h3 := &http3.Server{
+		Addr:           server.Addr,
+		Handler:        server.Handler,
+		MaxHeaderBytes: server.MaxHeaderBytes,
+	}
+
+	handler := server.Handler
+
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := h3.SetQUICHeaders(w.Header()); err != nil {
+			log.Debug("Setting Alt-Svc failed with error: ", err.Error())
+		}
+
+		handler.ServeHTTP(w, req)
+	})
+
+	return h3
+}
+
+// Time a restarted server waits for its parent to free the UDP port of
+// HTTP/3, which is only closed once the restart succeeded
+const http3BindTimeout = 5 * time.Second
+
+// Serves HTTP/3 until the server is closed, retrying while the port is
+// still in use
+func serveHTTP3(h3 *http3.Server, certFile, keyFile string) error {
+	deadline := time.Now().Add(http3BindTimeout)
+
+	for {
+		err := h3.ListenAndServeTLS(certFile, keyFile)
+		if !errors.Is(err, syscall.EADDRINUSE) || time.Now().After(deadline) {
+			return err
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Closes the HTTP/3 servers right away, their requests in flight are dropped
+func closeHTTP3Servers(servers []*http3.Server) {
+	for _, server := range servers {
+		if err := server.Close(); err != nil {
+			log.Warn("HTTP/3 server close failed with error: ", err.Error())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestServeHTTP3PortInUse(t *testing.T) {
+	// Held like the parent process of a restarted server does
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening failed with error [%v]", err)
+	}
+
+	h3 := &http3.Server{Addr: conn.LocalAddr().String(), Handler: http.NotFoundHandler()}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- serveHTTP3(h3, "server.crt", "server.key")
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	conn.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	h3.Close()
+
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("serveHTTP3() returned error [%v], expected [%v]", err, http.ErrServerClosed)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Handlers blocked for good by the leak fault, until released through the
+// admin API
+type Leaks struct {
+	mutex   sync.Mutex
+	release chan struct{}
+	count   int64
+}
+
+func NewLeaks() *Leaks {
+	return &Leaks{
+		release: make(chan struct{}),
+	}
+}
+
+// Blocks, ignoring the request context, until the next release
+func (l *Leaks) leak() {
+	l.mutex.Lock()
+	release := l.release
+	l.mutex.Unlock()
+
+	atomic.AddInt64(&l.count, 1)
+	defer atomic.AddInt64(&l.count, -1)
+
+	<-release
+}
+
+// Lets all the leaked handlers return, and how many there were
+func (l *Leaks) releaseAll() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	released := l.current()
+
+	close(l.release)
+	l.release = make(chan struct{})
+
+	return released
+}
+
+func (l *Leaks) current() int64 {
+	return atomic.LoadInt64(&l.count)
+}
+
+func handleReleaseLeaks(leaks *Leaks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		released := leaks.releaseAll()
+
+		requestLog(c).WithFields(log.Fields{
+			"Released": released,
+		}).Info("Leaked handlers released")
+
+		c.JSON(http.StatusOK, gin.H{"released": released})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// Environment variable telling a restarted server how many listeners it
+// inherited from its parent, starting at file descriptor 3
+const InheritedListenersEnv = "SERVER_INHERITED_LISTENERS"
+
+// systemd socket activation, see sd_listen_fds(3)
+const (
+	ListenPIDEnv = "LISTEN_PID"
+	ListenFDsEnv = "LISTEN_FDS"
+)
+
+// Listeners of the configuration, in order, passed by systemd socket
+// activation, inherited from the parent process after a restart or else
+// bound
+func listen(config *Config) ([]net.Listener, error) {
+	if pid, _ := strconv.Atoi(os.Getenv(ListenPIDEnv)); pid == os.Getpid() {
+		count, err := strconv.Atoi(os.Getenv(ListenFDsEnv))
+		if err != nil || count != len(config.Listeners) {
+			return nil, fmt.Errorf("systemd passed %s sockets but %d listeners are configured",
+				os.Getenv(ListenFDsEnv), len(config.Listeners))
+		}
+
+		os.Unsetenv(ListenPIDEnv)
+		os.Unsetenv(ListenFDsEnv)
+
+		return inheritListeners(config.Listeners)
+	}
+
+	if value := os.Getenv(InheritedListenersEnv); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count != len(config.Listeners) {
+			return nil, fmt.Errorf("inherited %s listeners but %d are configured", value, len(config.Listeners))
+		}
+
+		// Children of this process must not inherit them again
+		os.Unsetenv(InheritedListenersEnv)
+
+		return inheritListeners(config.Listeners)
+	}
+
+	var listeners []net.Listener
+
+	for _, listener := range config.Listeners {
+		l, err := listenOn(listener)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+func listenOn(listener ListenerConfig) (net.Listener, error) {
+	if !listener.Unix {
+		return net.Listen("tcp", listener.Addr)
+	}
+
+	// Left behind by a previous server, which keeps it on close so a
+	// restarted process inheriting the listener still serves it
+	if info, err := os.Stat(listener.Addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(listener.Addr); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", listener.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	return l, nil
+}
+
+func inheritListeners(configs []ListenerConfig) ([]net.Listener, error) {
+	var listeners []net.Listener
+
+	for i, listener := range configs {
+		file := os.NewFile(uintptr(3+i), listener.Addr)
+
+		l, err := net.FileListener(file)
+		file.Close()
+
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("inheriting listener [%s] failed: %v", listener.Addr, err)
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
@@ -6,14 +6,22 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
-	"math/rand"
+	"flag"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // TLS certificate
@@ -40,10 +48,13 @@ const (
 // Context timeout settings
 const (
 	Timeout = 500 * time.Millisecond
+
+	// Milliseconds the client is still willing to wait
+	DeadlineHeader = "X-Request-Deadline"
 )
 
-// Delay
-var (
+// Delay settings
+const (
 	MinimumDelay int64 = 0
 	MaximumDelay int64 = 0
 )
@@ -55,6 +66,9 @@ type UpdateDelayRequest struct {
 
 	// Maximum delay in milliseconds
 	MaximumDelay int64 `json:"maximumDelay"`
+
+	// Uniform when left out
+	DelayDistribution
 }
 
 func (r *UpdateDelayRequest) Validate() error {
@@ -70,7 +84,7 @@ func (r *UpdateDelayRequest) Validate() error {
 		return errors.New("MinimumDelay can not be greater than MaximumDelay")
 	}
 
-	return nil
+	return r.DelayDistribution.validate(r.MinimumDelay, r.MaximumDelay)
 }
 
 func main() {
@@ -82,48 +96,260 @@ func main() {
 	})
 	log.SetLevel(log.InfoLevel)
 
-	server := newHTTPServer()
+	var configFile string
+
+	config := DefaultConfig()
+	config.RegisterFlags(flag.CommandLine)
+	flag.StringVar(&configFile, "config", "", "YAML configuration file, overridden by the flags given")
+	flag.Parse()
+
+	if configFile != "" {
+		loaded, err := LoadConfig(configFile, flag.CommandLine)
+		if err != nil {
+			log.Fatal("Loading configuration failed with error: ", err.Error())
+		}
+
+		config = loaded
+	}
+
+	if err := config.Validate(); err != nil {
+		log.Fatal("Invalid configuration: ", err.Error())
+	}
+
+	log.Info("Effective configuration:\n", config.String())
+
+	if config.OTLPEndpoint != "" {
+		flushSpans, err := setupTracing(config.OTLPEndpoint)
+		if err != nil {
+			log.Fatal("Setting up tracing failed with error: ", err.Error())
+		}
 
-	log.Infof("Starting server on %v\n", ServerAddr)
+		defer flushSpans()
+	}
 
-	err := server.ListenAndServeTLS(ServerCertFile, ServerKeyFile)
+	settings, err := NewSettingsStore(&config)
 	if err != nil {
-		log.Error("Server startup failed with error: ", err.Error())
+		log.Fatal("Restoring settings failed with error: ", err.Error())
+	}
+
+	sticky := NewStickyDelays()
+	inFlight := &InFlight{}
+	counters := NewCounters()
+	connections := NewConnections()
+	leaks := NewLeaks()
+	hog := NewMemoryHog()
+	burner := NewCPUBurner()
+	culler := NewIdleCuller(settings)
+	pushes := &Pushes{}
+	polls := NewPolls()
+	compression := &CompressionStats{}
+
+	// Listeners share the handler, and so the settings and rate limiter
+	handler := newHandler(&config, settings, sticky, inFlight, counters, connections, leaks, hog, burner, pushes, polls, compression)
+	errs := make(chan error, len(config.Listeners))
+
+	listeners, err := listen(&config)
+	if err != nil {
+		log.Fatal("Listening failed with error: ", err.Error())
+	}
+
+	var servers []*http.Server
+	var h3Servers []*http3.Server
+
+	for i, listener := range config.Listeners {
+		server := newHTTPServer(&config, listener, handler)
+		server.ConnState = func(conn net.Conn, state http.ConnState) {
+			sticky.connState(conn, state)
+			culler.connState(conn, state)
+		}
+		servers = append(servers, server)
+
+		if config.HTTP3 && !listener.Plaintext && !listener.Unix {
+			h3 := newHTTP3Server(server)
+			h3Servers = append(h3Servers, h3)
+
+			// Closed on restarts, so its errors do not stop the server
+			go func(h3 *http3.Server) {
+				log.Infof("Starting HTTP/3 server on %v\n", h3.Addr)
+
+				if err := serveHTTP3(h3, config.CertFile, config.KeyFile); err != nil {
+					log.Error("HTTP/3 server stopped with error: ", err.Error())
+				}
+			}(h3)
+		}
+
+		l := connections.listener(listeners[i])
+
+		if !listener.Plaintext {
+			l = withHandshakeFaults(l, settings)
+		}
+
+		go func(server *http.Server, listener ListenerConfig, l net.Listener) {
+			log.Infof("Starting server on %v\n", listener.Addr)
+
+			if listener.Plaintext {
+				errs <- server.Serve(l)
+			} else {
+				errs <- server.ServeTLS(l, config.CertFile, config.KeyFile)
+			}
+		}(server, listener, l)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	restarts := make(chan os.Signal, 1)
+
+	if len(restartSignals) > 0 {
+		signal.Notify(restarts, restartSignals...)
+	}
+
+	for {
+		select {
+		case err := <-errs:
+			log.Error("Server startup failed with error: ", err.Error())
+			return
+
+		case received := <-signals:
+			log.Info("Received ", received)
+			closeHTTP3Servers(h3Servers)
+			shutdown(servers, inFlight, config.ShutdownTimeout)
+			return
+
+		case received := <-restarts:
+			// The new process accepts connections as soon as it started,
+			// this one only finishes the requests it already has. The UDP
+			// ports of HTTP/3 are not handed over, but freed for it to bind
+			// once it started, so a failed restart keeps serving HTTP/3.
+			if err := restart(listeners); err != nil {
+				log.Error("Restart failed with error: ", err.Error())
+				continue
+			}
+
+			closeHTTP3Servers(h3Servers)
+
+			log.Info("Received ", received, ", handed the listeners over to a new process")
+			shutdown(servers, inFlight, config.ShutdownTimeout)
+			return
+		}
 	}
 }
 
-func newHTTPServer() *http.Server {
-	return &http.Server{
-		Addr:        ServerAddr,
-		Handler:     newHandler(),
-		ReadTimeout: ServerReadTimeout,
+func newHTTPServer(config *Config, listener ListenerConfig, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:              listener.Addr,
+		Handler:           handler,
+		ReadTimeout:       override(listener.ReadTimeout, config.ReadTimeout),
+		ReadHeaderTimeout: override(listener.ReadHeaderTimeout, config.ReadHeaderTimeout),
 		// WriteTimeout must me > ReadTimeout + Processing Time
 		// See https://blog.cloudflare.com/exposing-go-on-the-internet/
-		WriteTimeout:   ServerWriteTimeout,
-		IdleTimeout:    ServerIdleTimeout,
-		MaxHeaderBytes: ServerMaxHeaderBytes,
+		WriteTimeout:   override(listener.WriteTimeout, config.WriteTimeout),
+		IdleTimeout:    override(listener.IdleTimeout, config.IdleTimeout),
+		MaxHeaderBytes: config.MaxHeaderBytes,
 	}
+
+	// TLS listeners negotiate HTTP/2 through ALPN on their own
+	if listener.H2C {
+		server.Handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: server.IdleTimeout})
+	}
+
+	return server
+}
+
+// Timeout of the listener, if set, or else of the server
+func override(listener *time.Duration, server time.Duration) time.Duration {
+	if listener != nil {
+		return *listener
+	}
+
+	return server
 }
 
-func newHandler() http.Handler {
+func newHandler(config *Config, settings *SettingsStore, sticky *StickyDelays, inFlight *InFlight, counters *Counters, connections *Connections, leaks *Leaks, hog *MemoryHog, burner *CPUBurner, pushes *Pushes, polls *Polls, compression *CompressionStats) http.Handler {
 	handler := gin.New()
-	handler.GET("/delay", handleGetDelay)
-	handler.PUT("/delay", handleUpdateDelay)
-	handler.GET("/ping", handlePing)
-	handler.GET("/pong", WithRateLimit(RateLimitRate, RateLimitBurst), WithTimeout(Timeout), handlePong)
+
+	// Outermost, so the request span covers the whole chain
+	if config.OTLPEndpoint != "" {
+		handler.Use(otelgin.Middleware(TracingService))
+	}
+
+	handler.Use(WithRequestID(), inFlight.Track(), counters.Track(), WithAccessLog(settings), WithFirstRequestLog(time.Now()),
+		WithRecovery(settings, counters), WithConnectionClose(settings), traced("latency-spikes", WithLatencySpikes(settings)),
+		traced("faults", WithFaults(settings, connections, leaks)), WithFraming(), traced("compression", WithCompression(settings, compression)))
+
+	handler.GET("/delay", handleGetDelay(settings))
+	handler.GET("/ping", handlePing(config))
+	handler.GET("/redirect/:n", handleRedirect(config))
+	handler.POST(GRPCPingMethod, handleGRPCPing(config, settings, sticky))
+	handler.GET("/events", handleEvents())
+	handler.GET("/trailers", handleTrailers(config))
+	handler.GET("/payload/:size", handlePayload())
+	handler.POST("/upload", handleUpload(config))
+	handler.PUT("/upload", handleUpload(config))
+	handler.POST("/upload/multipart", handleMultipartUpload(config))
+	handler.GET("/poll", handlePoll(polls))
+	handler.GET("/ws/echo", handleWebSocketEcho(config, connections))
+	handler.GET("/push", handlePush(pushes))
+	handler.GET("/push/resource/:n", handlePushResource(pushes))
+	handler.GET("/pong", traced("rate-limit", WithRateLimit(settings)), traced("concurrency-limit", WithConcurrencyLimit(settings)),
+		traced("timeout", WithTimeout(settings)), handlePong(config, settings, sticky))
+
+	// Endpoints changing the behavior of the server
+	protected := handler.Group("", WithAuth(config.Auth))
+	protected.PUT("/delay", handleUpdateDelay(settings))
+
+	admin := protected.Group("/admin")
+	admin.GET("/", handleAdminUI())
+	admin.GET("/counters", handleGetCounters(counters, inFlight, leaks))
+	admin.GET("/settings", handleGetSettings(settings))
+	admin.PUT("/settings", handleUpdateSettings(settings))
+	admin.POST("/reset", handleResetSettings(settings))
+	admin.GET("/audit", handleGetAuditLog(settings))
+	admin.GET("/faults", handleGetFaults(settings))
+	admin.PUT("/faults", handleUpdateFaults(settings))
+	admin.POST("/leaks/release", handleReleaseLeaks(leaks))
+	admin.GET("/pushes", handleGetPushes(pushes))
+	admin.POST("/poll", handlePublishPoll(polls))
+	admin.GET("/compression", handleGetCompressionStats(compression))
+	admin.GET("/profile", handleGetProfiles(config, settings))
+	admin.PUT("/profile", handleSwitchProfile(config, settings))
+
+	chaos := protected.Group("/chaos")
+	chaos.GET("/memory", handleGetMemory(hog))
+	chaos.PUT("/memory", handleHoldMemory(hog))
+	chaos.DELETE("/memory", handleReleaseMemory(hog))
+	chaos.GET("/cpu", handleGetCPUBurn(burner))
+	chaos.PUT("/cpu", handleBurnCPU(burner))
+	chaos.DELETE("/cpu", handleStopCPUBurn(burner))
+
 	return handler
 }
 
-func WithRateLimit(r float64, b int) gin.HandlerFunc {
-	if r == 0 {
-		return WithoutRateLimit()
-	}
+// Logs how long after startup the first request completed, to measure
+// cold starts, e.g. under systemd socket activation
+func WithFirstRequestLog(startTime time.Time) gin.HandlerFunc {
+	var once sync.Once
 
-	limiter := rate.NewLimiter(rate.Limit(r), b)
+	return func(c *gin.Context) {
+		requestStart := time.Now()
+
+		c.Next()
 
+		once.Do(func() {
+			requestLog(c).WithFields(log.Fields{
+				"SinceStartup": time.Since(startTime),
+				"Elapsed":      time.Since(requestStart),
+				"Path":         c.Request.URL.Path,
+			}).Info("First request served")
+		})
+	}
+}
+
+// Applies the current rate limit of the settings
+func WithRateLimit(settings *SettingsStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !limiter.Allow() {
-			log.Warn("RateLimit - To too many requests!")
+		if !settings.Allow() {
+			requestLog(c).Warn("RateLimit - To too many requests!")
 			c.AbortWithStatus(http.StatusTooManyRequests)
 			return
 		}
@@ -132,26 +358,36 @@ func WithRateLimit(r float64, b int) gin.HandlerFunc {
 	}
 }
 
-func WithoutRateLimit() gin.HandlerFunc {
+// Bounds the request context by the current timeout of the settings, or the
+// client deadline sent in the X-Request-Deadline header when it is shorter
+func WithTimeout(settings *SettingsStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Next()
-	}
-}
+		current := settings.Get()
+		if !current.Middlewares.Timeout {
+			WithoutTimeLimit(c)
+			return
+		}
 
-func WithTimeout(timeout time.Duration) gin.HandlerFunc {
-	if timeout == 0 {
-		return WithoutTimeLimit
-	}
+		timeout := clientDeadline(c, current.timeout())
+
+		if timeout == 0 {
+			WithoutTimeLimit(c)
+			return
+		}
 
-	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
 
 		defer func() {
-			cancel()
-
 			if ctx.Err() == context.DeadlineExceeded {
-				fmt.Println("context timeout exceeded")
+				c.Set(ContextExpiredKey, true)
+
+				requestLog(c).WithFields(log.Fields{
+					"Path":    c.Request.URL.Path,
+					"Timeout": timeout,
+				}).Debug("Context timeout exceeded")
 			}
+
+			cancel()
 		}()
 
 		c.Request = c.Request.WithContext(ctx)
@@ -159,66 +395,137 @@ func WithTimeout(timeout time.Duration) gin.HandlerFunc {
 	}
 }
 
+// Shortest of the timeout and the client deadline, 0 meaning no limit
+func clientDeadline(c *gin.Context, timeout time.Duration) time.Duration {
+	header := c.GetHeader(DeadlineHeader)
+	if header == "" {
+		return timeout
+	}
+
+	milliseconds, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || milliseconds <= 0 {
+		requestLog(c).Warn("Ignoring invalid ", DeadlineHeader, " header: ", header)
+		return timeout
+	}
+
+	deadline := time.Duration(milliseconds) * time.Millisecond
+
+	if timeout == 0 || deadline < timeout {
+		return deadline
+	}
+
+	return timeout
+}
+
 var WithoutTimeLimit = func(c *gin.Context) {
 	c.Next()
 }
 
-func handleGetDelay(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"MinimumDelay": MinimumDelay,
-		"MaximumDelay": MaximumDelay,
-	})
+func handleGetDelay(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current := settings.Get()
+
+		c.JSON(http.StatusOK, gin.H{
+			"MinimumDelay":    current.MinimumDelay,
+			"MaximumDelay":    current.MaximumDelay,
+			"Distribution":    current.Distribution,
+			"Mean":            current.Mean,
+			"StdDev":          current.StdDev,
+			"Median":          current.Median,
+			"Sigma":           current.Sigma,
+			"Shape":           current.Shape,
+			"SlowProbability": current.SlowProbability,
+		})
+	}
 }
 
-func handleUpdateDelay(c *gin.Context) {
-	var request UpdateDelayRequest
-
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, buildError(err.Error()))
-		return
-	}
+func handleUpdateDelay(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request UpdateDelayRequest
 
-	if err := request.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, buildError(err.Error()))
-		return
-	}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
 
-	MinimumDelay = request.MinimumDelay
-	MaximumDelay = request.MaximumDelay
+		if err := request.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
 
-	c.Status(http.StatusOK)
-}
+		_, err := settings.Update(newAuditEntry(c), func(s *Settings) {
+			s.MinimumDelay = request.MinimumDelay
+			s.MaximumDelay = request.MaximumDelay
+			s.DelayDistribution = request.DelayDistribution
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
 
-func handlePing(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "pong"})
+		c.Status(http.StatusOK)
+	}
 }
 
-func handlePong(c *gin.Context) {
-	ctx := c.Request.Context()
-	delay := calculateDelay()
+// Answers right away, unless the request asks for a delay
+func handlePing(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		delay, ok, err := delayOverride(c, config.MaxDelayOverride)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
 
-	select {
-	case <-time.After(delay):
-		c.JSON(http.StatusOK, gin.H{"message": "ping"})
-		return
+		if ok {
+			select {
+			case <-time.After(delay):
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
 
-	case <-ctx.Done():
-		// if the context is done it timed out or was cancelled
-		c.AbortWithStatusJSON(http.StatusInternalServerError, buildError(ctx.Err().Error()))
-		return
+		c.JSON(http.StatusOK, gin.H{"message": "pong"})
 	}
 }
 
-func buildError(message string) *gin.H {
-	return &gin.H{"error": message}
+func handlePong(config *Config, settings *SettingsStore, sticky *StickyDelays) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		delay, ok, err := delayOverride(c, config.MaxDelayOverride)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		if !ok {
+			current := settings.Get()
+			delay = calculateDelay(current) + sticky.delay(c, &current.StickyDelay)
+		}
+
+		_, span := startSpan(c, "delay")
+		defer span.End()
+
+		select {
+		case <-time.After(delay):
+			c.JSON(http.StatusOK, gin.H{"message": "ping"})
+			return
+
+		case <-ctx.Done():
+			// if the context is done it timed out or was cancelled
+			c.AbortWithStatusJSON(http.StatusInternalServerError, buildError(c, ctx.Err().Error()))
+			return
+		}
+	}
 }
 
-func calculateDelay() time.Duration {
-	delay := MinimumDelay
+// Error body, carrying the request id so it can be found in the logs
+func buildError(c *gin.Context, message string) *gin.H {
+	body := gin.H{"error": message}
 
-	if MaximumDelay > MinimumDelay {
-		delay += rand.Int63n(MaximumDelay-MinimumDelay)
+	if id := requestID(c); id != "" {
+		body["requestId"] = id
 	}
 
-	return time.Duration(delay) * time.Millisecond
+	return &body
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Malformed responses written straight to the connection
+const (
+	FaultMalformedChunked = "chunked"
+	FaultMalformedStatus  = "status"
+	FaultMalformedHeader  = "header"
+
+	// Duplicate and conflicting headers
+	FaultMalformedContentLength    = "content-length"
+	FaultMalformedTransferEncoding = "transfer-encoding"
+	FaultMalformedSetCookie        = "set-cookie"
+)
+
+var malformedResponses = map[string]string{
+	// Chunk size which is not hexadecimal
+	FaultMalformedChunked: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"zz\r\n" + faultBody + "\r\n0\r\n\r\n",
+
+	FaultMalformedStatus: "HTTP/1.1 2OO BOGUS\r\nContent-Type: application/json\r\nContent-Length: 18\r\n\r\n" + faultBody,
+
+	// Header name with a space and value with a NUL byte
+	FaultMalformedHeader: "HTTP/1.1 200 OK\r\nContent Type: application/json\r\nX-Fault: a\x00b\r\nContent-Length: 18\r\n\r\n" + faultBody,
+
+	// Two different lengths
+	FaultMalformedContentLength: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 18\r\nContent-Length: 9\r\n\r\n" + faultBody,
+
+	// Both chunked and a length, which request smuggling relies on
+	FaultMalformedTransferEncoding: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 9\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"12\r\n" + faultBody + "\r\n0\r\n\r\n",
+
+	// Same cookie set twice with different values, and an empty one
+	FaultMalformedSetCookie: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nSet-Cookie: session=first; Path=/\r\nSet-Cookie: session=second; Path=/\r\nSet-Cookie: \r\nContent-Length: 18\r\n\r\n" + faultBody,
+}
+
+// Writes the malformed response to the connection of an HTTP/1 request and
+// closes it. HTTP/2 framing leaves no room for it, so HTTP/2 streams are
+// reset instead.
+func writeMalformed(c *gin.Context, malformed string) {
+	if c.Request.ProtoMajor != 1 {
+		panic(http.ErrAbortHandler)
+	}
+
+	conn, buffer, err := c.Writer.Hijack()
+	if err != nil {
+		requestLog(c).Warn("Hijacking connection failed with error: ", err.Error())
+		panic(http.ErrAbortHandler)
+	}
+
+	defer conn.Close()
+
+	buffer.WriteString(malformedResponses[malformed])
+	buffer.Flush()
+}
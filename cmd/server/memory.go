@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Memory pressure settings
+const (
+	// Size of the blocks held, so the GC has many objects to scan
+	MemoryBlockSize = 1 << 20
+
+	// Bytes between two writes touching the pages of a block
+	memoryPageSize = 4096
+)
+
+// Hold memory request
+type HoldMemoryRequest struct {
+	// Memory held in total, replacing the memory held so far
+	Megabytes int `json:"megabytes"`
+}
+
+func (r *HoldMemoryRequest) Validate() error {
+	if r.Megabytes < 0 {
+		return errors.New("Megabytes can not be negative")
+	}
+
+	return nil
+}
+
+// Memory held and the state of the Go runtime
+type MemoryResponse struct {
+	Megabytes int `json:"megabytes"`
+
+	HeapAlloc  uint64 `json:"heapAlloc"`
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"numGC"`
+	PauseTotal int64  `json:"pauseTotal"`
+}
+
+// Memory allocated and held to put the GC under pressure
+type MemoryHog struct {
+	mutex  sync.Mutex
+	blocks [][]byte
+}
+
+func NewMemoryHog() *MemoryHog {
+	return &MemoryHog{}
+}
+
+// Allocates or drops blocks until megabytes are held
+func (h *MemoryHog) hold(megabytes int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for len(h.blocks) < megabytes {
+		block := make([]byte, MemoryBlockSize)
+
+		// Untouched pages would not be backed by physical memory
+		for i := 0; i < len(block); i += memoryPageSize {
+			block[i] = 1
+		}
+
+		h.blocks = append(h.blocks, block)
+	}
+
+	for i := megabytes; i < len(h.blocks); i++ {
+		h.blocks[i] = nil
+	}
+
+	h.blocks = h.blocks[:megabytes]
+}
+
+func (h *MemoryHog) snapshot() MemoryResponse {
+	h.mutex.Lock()
+	megabytes := len(h.blocks)
+	h.mutex.Unlock()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	return MemoryResponse{
+		Megabytes:  megabytes,
+		HeapAlloc:  stats.HeapAlloc,
+		Sys:        stats.Sys,
+		NumGC:      stats.NumGC,
+		PauseTotal: int64(time.Duration(stats.PauseTotalNs) / time.Millisecond),
+	}
+}
+
+func handleGetMemory(hog *MemoryHog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, hog.snapshot())
+	}
+}
+
+func handleHoldMemory(hog *MemoryHog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request HoldMemoryRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		if err := request.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		hog.hold(request.Megabytes)
+
+		requestLog(c).WithFields(log.Fields{
+			"Megabytes": request.Megabytes,
+		}).Info("Memory held")
+
+		c.JSON(http.StatusOK, hog.snapshot())
+	}
+}
+
+// Drops the memory held and returns it to the OS
+func handleReleaseMemory(hog *MemoryHog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hog.hold(0)
+		debug.FreeOSMemory()
+
+		requestLog(c).Info("Memory released")
+
+		c.JSON(http.StatusOK, hog.snapshot())
+	}
+}
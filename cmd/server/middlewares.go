@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Middlewares which can be switched off at runtime, to isolate their
+// contribution to the latency
+type Middlewares struct {
+	RateLimit        bool `json:"rateLimit"`
+	ConcurrencyLimit bool `json:"concurrencyLimit"`
+	Timeout          bool `json:"timeout"`
+
+	// Faults injected into any route
+	Faults bool `json:"faults"`
+
+	// Turns panics into 500s
+	Recovery bool `json:"recovery"`
+
+	// Logs every request, on all endpoints
+	AccessLog bool `json:"accessLog"`
+}
+
+func DefaultMiddlewares() Middlewares {
+	return Middlewares{
+		RateLimit:        true,
+		ConcurrencyLimit: true,
+		Timeout:          true,
+		Faults:           true,
+		Recovery:         true,
+	}
+}
+
+// Update middlewares request, middlewares left out keep their state
+type UpdateMiddlewaresRequest struct {
+	RateLimit        *bool `json:"rateLimit" yaml:"rate_limit,omitempty"`
+	ConcurrencyLimit *bool `json:"concurrencyLimit" yaml:"concurrency_limit,omitempty"`
+	Timeout          *bool `json:"timeout" yaml:"timeout,omitempty"`
+	Faults           *bool `json:"faults" yaml:"faults,omitempty"`
+	Recovery         *bool `json:"recovery" yaml:"recovery,omitempty"`
+	AccessLog        *bool `json:"accessLog" yaml:"access_log,omitempty"`
+}
+
+func (r *UpdateMiddlewaresRequest) apply(middlewares *Middlewares) {
+	if r.RateLimit != nil {
+		middlewares.RateLimit = *r.RateLimit
+	}
+
+	if r.ConcurrencyLimit != nil {
+		middlewares.ConcurrencyLimit = *r.ConcurrencyLimit
+	}
+
+	if r.Timeout != nil {
+		middlewares.Timeout = *r.Timeout
+	}
+
+	if r.Faults != nil {
+		middlewares.Faults = *r.Faults
+	}
+
+	if r.Recovery != nil {
+		middlewares.Recovery = *r.Recovery
+	}
+
+	if r.AccessLog != nil {
+		middlewares.AccessLog = *r.AccessLog
+	}
+}
+
+// Key set on the gin context of the requests whose context timeout expired
+const ContextExpiredKey = "contextExpired"
+
+// Logs the requests while the access log is enabled, with whether their
+// context timeout expired or the client went away, so every client side
+// anomaly has server side evidence
+func WithAccessLog(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		ctx := c.Request.Context()
+
+		c.Next()
+
+		if !settings.Get().Middlewares.AccessLog {
+			return
+		}
+
+		bytes := c.Writer.Size()
+		if bytes < 0 {
+			bytes = 0
+		}
+
+		requestLog(c).WithFields(log.Fields{
+			"Method":     c.Request.Method,
+			"Route":      c.FullPath(),
+			"Path":       c.Request.URL.Path,
+			"Proto":      c.Request.Proto,
+			"Status":     c.Writer.Status(),
+			"Elapsed":    time.Since(startTime),
+			"Bytes":      bytes,
+			"Client":     c.ClientIP(),
+			"RemoteAddr": c.Request.RemoteAddr,
+			"Expired":    c.GetBool(ContextExpiredKey),
+			"Cancelled":  ctx.Err() == context.Canceled,
+		}).Info("Request served")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Periodic stalls of every request, like stop-the-world GC pauses, making
+// the saw-tooth tail latency clients must be tuned against
+type LatencySpikes struct {
+	// Every PauseEvery milliseconds, requests stall for PauseFor
+	// milliseconds (0 disables it)
+	PauseEvery int64 `json:"pauseEvery"`
+	PauseFor   int64 `json:"pauseFor"`
+}
+
+func (s *LatencySpikes) validate() error {
+	if s.PauseEvery < 0 || s.PauseFor < 0 {
+		return errors.New("PauseEvery and PauseFor can not be negative")
+	}
+
+	if s.PauseEvery > 0 && s.PauseFor >= s.PauseEvery {
+		return errors.New("PauseFor must be shorter than PauseEvery")
+	}
+
+	return nil
+}
+
+// Time left of the pause at now, 0 outside of them. Pauses start at
+// multiples of PauseEvery since the epoch, so all requests share them.
+func (s *LatencySpikes) remaining(now time.Time) time.Duration {
+	if s.PauseEvery == 0 || s.PauseFor == 0 {
+		return 0
+	}
+
+	every := time.Duration(s.PauseEvery) * time.Millisecond
+	pause := time.Duration(s.PauseFor) * time.Millisecond
+
+	if phase := time.Duration(now.UnixNano() % int64(every)); phase < pause {
+		return pause - phase
+	}
+
+	return 0
+}
+
+// Stalls new requests until the end of the current pause, and requests in
+// flight when they write their response, on all routes but /admin
+func WithLatencySpikes(settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/admin") {
+			c.Next()
+			return
+		}
+
+		done := c.Request.Context().Done()
+
+		waitPause(settings, done)
+
+		c.Writer = &pauseWriter{ResponseWriter: c.Writer, settings: settings, done: done}
+
+		c.Next()
+	}
+}
+
+// Waits for the end of the current pause, if any, or the request to end
+func waitPause(settings *SettingsStore, done <-chan struct{}) {
+	spikes := settings.Get().LatencySpikes
+
+	remaining := spikes.remaining(time.Now())
+	if remaining == 0 {
+		return
+	}
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-done:
+	}
+}
+
+// Writer stalling the writes made during a pause
+type pauseWriter struct {
+	gin.ResponseWriter
+
+	settings *SettingsStore
+	done     <-chan struct{}
+}
+
+func (w *pauseWriter) Write(data []byte) (int, error) {
+	waitPause(w.settings, w.done)
+
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *pauseWriter) WriteString(s string) (int, error) {
+	waitPause(w.settings, w.done)
+
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *pauseWriter) WriteHeaderNow() {
+	if !w.ResponseWriter.Written() {
+		waitPause(w.settings, w.done)
+	}
+
+	w.ResponseWriter.WriteHeaderNow()
+}
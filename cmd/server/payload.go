@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Largest body served by /payload/:size
+const MaxPayloadSize = 10 << 30
+
+// Serves size bytes of a deterministic body, with Range requests answered
+// by 206 Partial Content and If-Range validated against its ETag, for
+// throughput, partial content and resume experiments
+func handlePayload() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		size, err := strconv.ParseInt(c.Param("size"), 10, 64)
+		if err != nil || size < 0 || size > MaxPayloadSize {
+			c.JSON(http.StatusBadRequest, buildError(c, fmt.Sprintf("size must be between 0 and %d", int64(MaxPayloadSize))))
+			return
+		}
+
+		// The same size always serves the same body
+		c.Header("ETag", fmt.Sprintf(`"payload-%d"`, size))
+		c.Header("Content-Type", "application/octet-stream")
+
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, &payloadReader{size: size})
+	}
+}
+
+// Body cycling through the lowercase letters, generated as it is read
+type payloadReader struct {
+	size   int64
+	offset int64
+}
+
+func (r *payloadReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if remaining := r.size - r.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	for i := range p {
+		p[i] = byte('a' + (r.offset+int64(i))%26)
+	}
+
+	r.offset += int64(len(p))
+
+	return len(p), nil
+}
+
+func (r *payloadReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	r.offset = offset
+
+	return offset, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Long-polling settings, the query parameters of /poll
+const (
+	// How long a poll waits for data, by default
+	PollWait    = 30 * time.Second
+	MaxPollWait = 10 * time.Minute
+
+	PollWaitQuery = "wait"
+
+	// Version the client already has, newer data being returned at once
+	PollSinceQuery = "since"
+)
+
+// Data published through the admin API to the clients polling for it
+type Polls struct {
+	mutex   sync.Mutex
+	version int64
+	data    string
+
+	// Closed and replaced on every publication, waking the polls
+	published chan struct{}
+}
+
+func NewPolls() *Polls {
+	return &Polls{published: make(chan struct{})}
+}
+
+type PollResponse struct {
+	Version int64  `json:"version"`
+	Data    string `json:"data"`
+}
+
+type PublishPollRequest struct {
+	Data string `json:"data"`
+}
+
+func (p *Polls) publish(data string) int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.version++
+	p.data = data
+
+	close(p.published)
+	p.published = make(chan struct{})
+
+	return p.version
+}
+
+// Current data, and the channel closed when newer data is published
+func (p *Polls) current() (PollResponse, <-chan struct{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return PollResponse{Version: p.version, Data: p.data}, p.published
+}
+
+// Holds the request until data newer than the since query parameter is
+// published, answering 204 once the wait expired
+func handlePoll(polls *Polls) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wait := PollWait
+
+		if value := c.Query(PollWaitQuery); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 || parsed > MaxPollWait {
+				c.JSON(http.StatusBadRequest, buildError(c, fmt.Sprintf("wait must be between 0 and %v", MaxPollWait)))
+				return
+			}
+
+			wait = parsed
+		}
+
+		var since int64
+
+		if value := c.Query(PollSinceQuery); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, buildError(c, "since must be a version"))
+				return
+			}
+
+			since = parsed
+		}
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		for {
+			current, published := polls.current()
+
+			if current.Version > since {
+				c.JSON(http.StatusOK, current)
+				return
+			}
+
+			select {
+			case <-published:
+			case <-timer.C:
+				c.Status(http.StatusNoContent)
+				return
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+// Publishes data to the clients polling for it
+func handlePublishPoll(polls *Polls) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request PublishPollRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		version := polls.publish(request.Data)
+
+		requestLog(c).WithFields(log.Fields{
+			"Version": version,
+		}).Info("Poll data published")
+
+		c.JSON(http.StatusOK, PollResponse{Version: version, Data: request.Data})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Switch profile request
+type SwitchProfileRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// Active profile and the ones of the configuration
+type ProfilesResponse struct {
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+// Checks every profile gives valid settings over the configured ones
+func validateProfiles(profiles map[string]UpdateSettingsRequest, configured Settings) error {
+	for name, profile := range profiles {
+		settings := configured
+		profile.apply(&settings)
+
+		if err := settings.Validate(); err != nil {
+			return fmt.Errorf("invalid profile [%s]: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+func handleGetProfiles(config *Config, settings *SettingsStore) gin.HandlerFunc {
+	names := make([]string, 0, len(config.Profiles))
+
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, ProfilesResponse{
+			Active:   settings.Get().Profile,
+			Profiles: names,
+		})
+	}
+}
+
+// Replaces all settings by the ones of the profile, the settings it leaves
+// out taking the values of the configuration
+func handleSwitchProfile(config *Config, settings *SettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request SwitchProfileRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		profile, ok := config.Profiles[request.Name]
+		if !ok {
+			c.JSON(http.StatusNotFound, buildError(c, fmt.Sprintf("unknown profile [%s]", request.Name)))
+			return
+		}
+
+		switched, err := settings.Update(newAuditEntry(c), func(s *Settings) {
+			*s = settings.configured
+			profile.apply(s)
+			s.Profile = request.Name
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		requestLog(c).WithFields(log.Fields{
+			"Profile": request.Name,
+		}).Info("Profile switched")
+
+		c.JSON(http.StatusOK, switched)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Server push settings
+const (
+	// Resources pushed by /push, and their size in bytes, by default
+	PushCount = 3
+	PushSize  = 1024
+
+	MaxPushCount = 100
+	MaxPushSize  = 10 * 1024 * 1024
+
+	PushCountQuery = "count"
+	PushSizeQuery  = "size"
+
+	// Header of the requests pushed, telling them from the ones the client
+	// made itself
+	PushedHeader = "X-Pushed"
+)
+
+// Outcome of the pushes since startup
+type Pushes struct {
+	// Pushes attempted, promised to the client, and refused because the
+	// connection does not support them (HTTP/1.1, or push disabled by the
+	// client) or failed otherwise
+	attempted   int64
+	promised    int64
+	unsupported int64
+	failed      int64
+
+	// Pushed responses sent in full, and cancelled by the client
+	served    int64
+	cancelled int64
+}
+
+type PushesResponse struct {
+	Attempted   int64 `json:"attempted"`
+	Promised    int64 `json:"promised"`
+	Unsupported int64 `json:"unsupported"`
+	Failed      int64 `json:"failed"`
+	Served      int64 `json:"served"`
+	Cancelled   int64 `json:"cancelled"`
+}
+
+func (p *Pushes) snapshot() PushesResponse {
+	return PushesResponse{
+		Attempted:   atomic.LoadInt64(&p.attempted),
+		Promised:    atomic.LoadInt64(&p.promised),
+		Unsupported: atomic.LoadInt64(&p.unsupported),
+		Failed:      atomic.LoadInt64(&p.failed),
+		Served:      atomic.LoadInt64(&p.served),
+		Cancelled:   atomic.LoadInt64(&p.cancelled),
+	}
+}
+
+// Pushes count resources of size bytes, then lists them. Clients without
+// push still get the list, to fetch them themselves.
+func handlePush(pushes *Pushes) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, err := intQuery(c, PushCountQuery, PushCount, MaxPushCount)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		size, err := intQuery(c, PushSizeQuery, PushSize, MaxPushSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		pusher := c.Writer.Pusher()
+		resources := make([]string, 0, count)
+		promised := 0
+
+		for i := 0; i < count; i++ {
+			resource := fmt.Sprintf("/push/resource/%d?%s=%d", i, PushSizeQuery, size)
+			resources = append(resources, resource)
+
+			atomic.AddInt64(&pushes.attempted, 1)
+
+			if pusher == nil {
+				atomic.AddInt64(&pushes.unsupported, 1)
+				continue
+			}
+
+			err := pusher.Push(resource, &http.PushOptions{
+				Header: http.Header{PushedHeader: []string{"true"}},
+			})
+
+			switch err {
+			case nil:
+				atomic.AddInt64(&pushes.promised, 1)
+				promised++
+
+			case http.ErrNotSupported:
+				atomic.AddInt64(&pushes.unsupported, 1)
+
+			default:
+				atomic.AddInt64(&pushes.failed, 1)
+
+				requestLog(c).WithFields(log.Fields{
+					"Resource": resource,
+				}).Debug("Push failed with error: ", err.Error())
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"pushed": promised, "resources": resources})
+	}
+}
+
+// Resource of the size query parameter in bytes, pushed or not
+func handlePushResource(pushes *Pushes) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		size, err := intQuery(c, PushSizeQuery, PushSize, MaxPushSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		c.Header("Content-Length", strconv.Itoa(size))
+		c.Status(http.StatusOK)
+
+		_, err = c.Writer.Write(bytes.Repeat([]byte{'x'}, size))
+
+		if c.GetHeader(PushedHeader) == "" {
+			return
+		}
+
+		if err != nil || c.Request.Context().Err() != nil {
+			atomic.AddInt64(&pushes.cancelled, 1)
+		} else {
+			atomic.AddInt64(&pushes.served, 1)
+		}
+	}
+}
+
+func handleGetPushes(pushes *Pushes) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, pushes.snapshot())
+	}
+}
+
+// Integer query parameter between 0 and max, or defaultValue when absent
+func intQuery(c *gin.Context, name string, defaultValue int, max int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > max {
+		return 0, fmt.Errorf("%s must be between 0 and %d", name, max)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Turns handler panics into 500s while the recovery middleware is enabled.
+// Otherwise net/http recovers them by closing the connection.
+func WithRecovery(settings *SettingsStore, counters *Counters) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !settings.Get().Middlewares.Recovery {
+			c.Next()
+			return
+		}
+
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+
+			// Faults aborting the connection or stream on purpose
+			if value == http.ErrAbortHandler {
+				panic(value)
+			}
+
+			counters.recordPanic()
+
+			requestLog(c).WithFields(log.Fields{
+				"Path":  c.Request.URL.Path,
+				"Panic": value,
+			}).Error("Recovered from panic\n", string(debug.Stack()))
+
+			c.AbortWithStatusJSON(http.StatusInternalServerError, buildError(c, "internal error"))
+		}()
+
+		c.Next()
+	}
+}
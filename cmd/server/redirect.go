@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Redirect settings
+const (
+	// Longest chain of redirects
+	MaxRedirects = 100
+
+	// Switch between the TLS and plaintext listeners at every hop
+	RedirectCrossQuery  = "cross"
+	RedirectStatusQuery = "status"
+)
+
+// Redirects to /redirect/n-1 until n reaches 0, with the status of the
+// status query parameter (302 by default). The query string is kept, so
+// every hop can also ask for a delay.
+func handleRedirect(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		remaining, err := strconv.Atoi(c.Param("n"))
+		if err != nil || remaining < 0 || remaining > MaxRedirects {
+			c.JSON(http.StatusBadRequest, buildError(c, fmt.Sprintf("n must be between 0 and %d", MaxRedirects)))
+			return
+		}
+
+		delay, ok, err := delayOverride(c, config.MaxDelayOverride)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		if ok {
+			select {
+			case <-time.After(delay):
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+
+		if remaining == 0 {
+			c.JSON(http.StatusOK, gin.H{"message": "redirected"})
+			return
+		}
+
+		status, err := redirectStatus(c.Query(RedirectStatusQuery))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		location := &url.URL{
+			Path:     "/redirect/" + strconv.Itoa(remaining-1),
+			RawQuery: c.Request.URL.RawQuery,
+		}
+
+		if cross, _ := strconv.ParseBool(c.Query(RedirectCrossQuery)); cross {
+			location.Scheme, location.Host = crossListener(config, c.Request)
+		}
+
+		c.Redirect(status, location.String())
+	}
+}
+
+func redirectStatus(value string) (int, error) {
+	if value == "" {
+		return http.StatusFound, nil
+	}
+
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return status, nil
+	}
+
+	return 0, errors.New("status must be 301, 302, 303, 307 or 308")
+}
+
+// Scheme and host of the first listener of the other protocol, or empty to
+// stay on the same listener when there is none
+func crossListener(config *Config, req *http.Request) (string, string) {
+	plaintext := req.TLS == nil
+
+	for _, listener := range config.Listeners {
+		if listener.Plaintext == plaintext {
+			continue
+		}
+
+		_, port, err := net.SplitHostPort(listener.Addr)
+		if err != nil {
+			continue
+		}
+
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+
+		scheme := "https"
+		if listener.Plaintext {
+			scheme = "http"
+		}
+
+		return scheme, net.JoinHostPort(host, port)
+	}
+
+	return "", ""
+}
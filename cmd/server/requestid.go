@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Header identifying a request in the client and server logs
+const RequestIDHeader = "X-Request-Id"
+
+// Longest request id accepted from clients, longer ones being replaced
+const MaxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// Takes the request id of the client, or generates one, attaches it to the
+// request context and echoes it in the response
+func WithRequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+		c.Header(RequestIDHeader, id)
+
+		c.Next()
+	}
+}
+
+// Printable ASCII only, so it can not forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// Request id of the request, empty for requests outside of WithRequestID
+func requestID(c *gin.Context) string {
+	id, _ := c.Request.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// Logger of the request, adding its id to every line
+func requestLog(c *gin.Context) *log.Entry {
+	return log.WithField("RequestID", requestID(c))
+}
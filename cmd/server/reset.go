@@ -0,0 +1,194 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Points of the response where a fault resets the connection
+const (
+	FaultResetHeaders = "headers"
+	FaultResetBody    = "body"
+)
+
+// Ways a fault cuts the body short
+const (
+	FaultTruncateLength  = "length"
+	FaultTruncateChunked = "chunked"
+)
+
+// Body of the responses cut short by the faults
+const faultBody = `{"message":"ping"}`
+
+// TCP connections accepted, by remote address, so the ones hidden behind TLS
+// can still be reset
+type Connections struct {
+	mutex sync.Mutex
+	conns map[string]*net.TCPConn
+}
+
+func NewConnections() *Connections {
+	return &Connections{
+		conns: make(map[string]*net.TCPConn),
+	}
+}
+
+// Listener recording the connections it accepts
+func (c *Connections) listener(l net.Listener) net.Listener {
+	return &trackedListener{Listener: l, connections: c}
+}
+
+// Closes the connection with SO_LINGER 0, sending a RST instead of a FIN
+func (c *Connections) reset(addr string) bool {
+	c.mutex.Lock()
+	conn, ok := c.conns[addr]
+	c.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	if err := conn.SetLinger(0); err != nil {
+		log.Warn("Setting SO_LINGER failed with error: ", err.Error())
+	}
+
+	conn.Close()
+
+	return true
+}
+
+type trackedListener struct {
+	net.Listener
+	connections *Connections
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return conn, nil
+	}
+
+	addr := conn.RemoteAddr().String()
+
+	l.connections.mutex.Lock()
+	l.connections.conns[addr] = tcpConn
+	l.connections.mutex.Unlock()
+
+	return &trackedConn{TCPConn: tcpConn, addr: addr, connections: l.connections}, nil
+}
+
+type trackedConn struct {
+	*net.TCPConn
+	addr        string
+	connections *Connections
+}
+
+func (c *trackedConn) Close() error {
+	c.connections.mutex.Lock()
+	delete(c.connections.conns, c.addr)
+	c.connections.mutex.Unlock()
+
+	return c.TCPConn.Close()
+}
+
+// Resets the connection of an HTTP/1 request, or the stream of an HTTP/2
+// one, before the headers or after part of the body
+func resetConnection(c *gin.Context, connections *Connections, point string) {
+	if point == FaultResetBody {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Header("Content-Length", strconv.Itoa(len(faultBody)))
+		c.Status(http.StatusOK)
+		c.Writer.WriteString(faultBody[:len(faultBody)/2])
+		c.Writer.Flush()
+	}
+
+	// HTTP/2 resets the stream with RST_STREAM when the handler aborts
+	if c.Request.ProtoMajor != 1 {
+		panic(http.ErrAbortHandler)
+	}
+
+	conn, buffer, err := c.Writer.Hijack()
+	if err != nil {
+		requestLog(c).Warn("Hijacking connection failed with error: ", err.Error())
+		panic(http.ErrAbortHandler)
+	}
+
+	if point == FaultResetHeaders {
+		buffer.WriteString("HTTP/1.1 200 OK\r\nContent-Type: appl")
+		buffer.Flush()
+	}
+
+	if !connections.reset(conn.RemoteAddr().String()) {
+		conn.Close()
+	}
+}
+
+// Sends half of the body, declaring all of it in the Content-Length or
+// sending it in chunks, then closes the connection of an HTTP/1 request, or
+// resets the stream of an HTTP/2 one
+func truncateResponse(c *gin.Context, truncate string) {
+	if truncate == FaultTruncateLength {
+		c.Header("Content-Length", strconv.Itoa(len(faultBody)))
+	}
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	c.Writer.WriteString(faultBody[:len(faultBody)/2])
+
+	// Without Content-Length, the flush switches to chunked encoding
+	c.Writer.Flush()
+
+	if c.Request.ProtoMajor != 1 {
+		panic(http.ErrAbortHandler)
+	}
+
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		requestLog(c).Warn("Hijacking connection failed with error: ", err.Error())
+		panic(http.ErrAbortHandler)
+	}
+
+	conn.Close()
+}
+
+// Holds the request without answering until the client gives up, or closes
+// the connection after limit unless 0
+func blackhole(c *gin.Context, limit time.Duration) {
+	var expired <-chan time.Time
+
+	if limit > 0 {
+		timer := time.NewTimer(limit)
+		defer timer.Stop()
+
+		expired = timer.C
+	}
+
+	select {
+	case <-c.Request.Context().Done():
+		return
+	case <-expired:
+	}
+
+	if c.Request.ProtoMajor != 1 {
+		panic(http.ErrAbortHandler)
+	}
+
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		requestLog(c).Warn("Hijacking connection failed with error: ", err.Error())
+		panic(http.ErrAbortHandler)
+	}
+
+	conn.Close()
+}
@@ -0,0 +1,77 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// Signals starting a new server process which takes over the listeners
+var restartSignals = []os.Signal{syscall.SIGUSR2}
+
+// Starts the current binary again, handing the listeners over so no
+// connection attempt is refused. The caller then drains its own requests.
+func restart(listeners []net.Listener) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	files, err := listenerFiles(listeners)
+	if err != nil {
+		return err
+	}
+
+	defer closeFiles(files)
+
+	env := append(os.Environ(), InheritedListenersEnv+"="+strconv.Itoa(len(files)))
+
+	process, err := os.StartProcess(executable, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...),
+	})
+	if err != nil {
+		return err
+	}
+
+	return process.Release()
+}
+
+// Listeners whose socket can be handed over, TCP and Unix ones
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+// Duplicates the sockets of the listeners for the new process
+func listenerFiles(listeners []net.Listener) ([]*os.File, error) {
+	files := make([]*os.File, 0, len(listeners))
+
+	for _, listener := range listeners {
+		l, ok := listener.(fileListener)
+		if !ok {
+			closeFiles(files)
+			return nil, fmt.Errorf("listener [%s] can not be handed over", listener.Addr())
+		}
+
+		file, err := l.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// Listener without a socket to hand over
+type pipeListener struct {
+	net.Listener
+}
+
+func TestListenerFiles(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening failed with error [%v]", err)
+	}
+	defer tcp.Close()
+
+	unix, err := net.Listen("unix", filepath.Join(t.TempDir(), "server.sock"))
+	if err != nil {
+		t.Fatalf("listening failed with error [%v]", err)
+	}
+	defer unix.Close()
+
+	tests := []struct {
+		name      string
+		listeners []net.Listener
+		valid     bool
+	}{
+		{"tcp", []net.Listener{tcp}, true},
+		{"unix", []net.Listener{tcp, unix}, true},
+		{"not a socket", []net.Listener{tcp, pipeListener{tcp}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := listenerFiles(test.listeners)
+			defer closeFiles(files)
+
+			if test.valid && err != nil {
+				t.Errorf("listenerFiles() returned error [%v], expected none", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("listenerFiles() returned no error, expected one")
+			}
+
+			if test.valid && len(files) != len(test.listeners) {
+				t.Errorf("listenerFiles() returned %d files, expected %d", len(files), len(test.listeners))
+			}
+		})
+	}
+}
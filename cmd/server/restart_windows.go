@@ -0,0 +1,14 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// Listeners can't be handed over on Windows
+var restartSignals []os.Signal
+
+func restart(listeners []net.Listener) error {
+	return errors.New("restart is not supported on Windows")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// When a fault is injected, always when empty. All the windows set must
+// hold.
+type FaultSchedule struct {
+	// Only during the first ActiveFor milliseconds of every Every
+	// milliseconds of the wall clock
+	ActiveFor int64 `json:"activeFor,omitempty" yaml:"active_for,omitempty"`
+	Every     int64 `json:"every,omitempty" yaml:"every,omitempty"`
+
+	// Only from and until these times, e.g. 2021-03-01T03:00:00Z
+	From  *time.Time `json:"from,omitempty" yaml:"from,omitempty"`
+	Until *time.Time `json:"until,omitempty" yaml:"until,omitempty"`
+
+	// Only between these times of the day, in the local time of the
+	// server, e.g. 23:30-01:00
+	Daily string `json:"daily,omitempty" yaml:"daily,omitempty"`
+}
+
+func (s *FaultSchedule) validate() error {
+	if s.ActiveFor < 0 || s.Every < 0 || s.ActiveFor > s.Every || (s.Every > 0 && s.ActiveFor == 0) {
+		return errors.New("ActiveFor and Every must be set together, ActiveFor being at most Every")
+	}
+
+	if s.From != nil && s.Until != nil && !s.From.Before(*s.Until) {
+		return errors.New("From must be before Until")
+	}
+
+	if s.Daily != "" {
+		if _, _, err := parseDaily(s.Daily); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FaultSchedule) active(now time.Time) bool {
+	if s.From != nil && now.Before(*s.From) {
+		return false
+	}
+
+	if s.Until != nil && !now.Before(*s.Until) {
+		return false
+	}
+
+	if s.Daily != "" && !inDaily(s.Daily, now) {
+		return false
+	}
+
+	if s.Every == 0 {
+		return true
+	}
+
+	every := time.Duration(s.Every) * time.Millisecond
+
+	return now.Sub(now.Truncate(every)) < time.Duration(s.ActiveFor)*time.Millisecond
+}
+
+// Start and end of the daily window as offsets from midnight
+func parseDaily(daily string) (time.Duration, time.Duration, error) {
+	parts := strings.Split(daily, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("Daily [%s] must be formatted as 15:04-15:04", daily)
+	}
+
+	var offsets [2]time.Duration
+
+	for i, part := range parts {
+		clock, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("Daily [%s] must be formatted as 15:04-15:04", daily)
+		}
+
+		offsets[i] = time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+	}
+
+	if offsets[0] == offsets[1] {
+		return 0, 0, fmt.Errorf("Daily [%s] can not be empty", daily)
+	}
+
+	return offsets[0], offsets[1], nil
+}
+
+// Whether the time of the day falls into the window, which may span
+// midnight
+func inDaily(daily string, now time.Time) bool {
+	start, end, err := parseDaily(daily)
+	if err != nil {
+		return false
+	}
+
+	hour, minute, second := now.Clock()
+	offset := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second
+
+	if start < end {
+		return offset >= start && offset < end
+	}
+
+	return offset >= start || offset < end
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFaultScheduleValidate(t *testing.T) {
+	from := time.Date(2021, 3, 1, 3, 0, 0, 0, time.UTC)
+	until := from.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		schedule FaultSchedule
+		valid    bool
+	}{
+		{"always", FaultSchedule{}, true},
+		{"periodic", FaultSchedule{ActiveFor: 10000, Every: 60000}, true},
+		{"every without active for", FaultSchedule{Every: 60000}, false},
+		{"active for without every", FaultSchedule{ActiveFor: 10000}, false},
+		{"active for over every", FaultSchedule{ActiveFor: 70000, Every: 60000}, false},
+		{"from before until", FaultSchedule{From: &from, Until: &until}, true},
+		{"from after until", FaultSchedule{From: &until, Until: &from}, false},
+		{"daily", FaultSchedule{Daily: "23:30-01:00"}, true},
+		{"daily without end", FaultSchedule{Daily: "23:30"}, false},
+		{"daily out of range", FaultSchedule{Daily: "23:30-25:00"}, false},
+		{"empty daily", FaultSchedule{Daily: "12:00-12:00"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.schedule.validate()
+
+			if test.valid && err != nil {
+				t.Errorf("validate() returned error [%v], expected none", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("validate() returned no error, expected one")
+			}
+		})
+	}
+}
+
+func TestFaultScheduleActive(t *testing.T) {
+	day := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	from := day.Add(3 * time.Hour)
+	until := day.Add(4 * time.Hour)
+
+	tests := []struct {
+		name     string
+		schedule FaultSchedule
+		now      time.Time
+		active   bool
+	}{
+		{"always", FaultSchedule{}, day, true},
+		{"start of period", FaultSchedule{ActiveFor: 10000, Every: 60000}, day.Add(5 * time.Second), true},
+		{"rest of period", FaultSchedule{ActiveFor: 10000, Every: 60000}, day.Add(10 * time.Second), false},
+		{"next period", FaultSchedule{ActiveFor: 10000, Every: 60000}, day.Add(61 * time.Second), true},
+		{"before from", FaultSchedule{From: &from}, from.Add(-time.Second), false},
+		{"at from", FaultSchedule{From: &from}, from, true},
+		{"before until", FaultSchedule{Until: &until}, until.Add(-time.Second), true},
+		{"at until", FaultSchedule{Until: &until}, until, false},
+		{"daily", FaultSchedule{Daily: "03:00-04:00"}, day.Add(3*time.Hour + 30*time.Minute), true},
+		{"all windows must hold", FaultSchedule{From: &from, Daily: "01:00-02:00"}, from.Add(time.Minute), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if active := test.schedule.active(test.now); active != test.active {
+				t.Errorf("active() returned %v, expected %v", active, test.active)
+			}
+		})
+	}
+}
+
+func TestInDaily(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2021, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		daily  string
+		now    time.Time
+		inside bool
+	}{
+		{"09:00-17:00", at(8, 59), false},
+		{"09:00-17:00", at(9, 0), true},
+		{"09:00-17:00", at(16, 59), true},
+		{"09:00-17:00", at(17, 0), false},
+
+		// Spanning midnight
+		{"23:30-01:00", at(23, 29), false},
+		{"23:30-01:00", at(23, 30), true},
+		{"23:30-01:00", at(0, 0), true},
+		{"23:30-01:00", at(0, 59), true},
+		{"23:30-01:00", at(1, 0), false},
+		{"23:30-01:00", at(12, 0), false},
+
+		{"invalid", at(12, 0), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.daily+" at "+test.now.Format("15:04"), func(t *testing.T) {
+			if inside := inDaily(test.daily, test.now); inside != test.inside {
+				t.Errorf("inDaily() returned %v, expected %v", inside, test.inside)
+			}
+		})
+	}
+}
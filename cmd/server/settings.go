@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// Settings changeable at runtime through the admin API, durations in
+// milliseconds
+type Settings struct {
+	// Requests per second allowed on /pong (0 disables the rate limit)
+	RateLimitRate  float64 `json:"rateLimitRate"`
+	RateLimitBurst int     `json:"rateLimitBurst"`
+
+	// Context timeout of /pong requests (0 disables it)
+	Timeout int64 `json:"timeout"`
+
+	// /pong handlers running at once (0 disables the limit), and requests
+	// waiting up to QueueTimeout for one of them to finish
+	MaxConcurrent int   `json:"maxConcurrent"`
+	MaxQueue      int   `json:"maxQueue"`
+	QueueTimeout  int64 `json:"queueTimeout"`
+
+	// Delay of /pong
+	MinimumDelay int64 `json:"minimumDelay"`
+	MaximumDelay int64 `json:"maximumDelay"`
+	DelayDistribution
+
+	// Extra delay of persistently slow connections or clients
+	StickyDelay
+
+	// Errors returned instead of the responses of the routes
+	Faults Faults `json:"faults"`
+
+	// Keep-alive connections closed once idle that long (0 disables it), or
+	// a random time up to it
+	CullIdleAfter  int64 `json:"cullIdleAfter"`
+	CullIdleRandom bool  `json:"cullIdleRandom"`
+
+	// TLS handshakes delayed or aborted
+	HandshakeFaults
+
+	// HTTP/1.1 connections closed after a response
+	ConnectionChurn
+
+	// Periodic stalls of all requests
+	LatencySpikes
+
+	// Errors of the gRPC Ping service
+	GRPCFaults
+
+	// Compression of the responses
+	Compression
+
+	Middlewares Middlewares `json:"middlewares"`
+
+	// Profile last switched to, empty after a reset
+	Profile string `json:"profile"`
+}
+
+func (s *Settings) Validate() error {
+	if s.RateLimitRate < 0 {
+		return errors.New("RateLimitRate can not be negative")
+	}
+
+	if s.RateLimitRate > 0 && s.RateLimitBurst < 1 {
+		return errors.New("RateLimitBurst must be at least 1")
+	}
+
+	if s.Timeout < 0 {
+		return errors.New("Timeout can not be negative")
+	}
+
+	if s.MaxConcurrent < 0 || s.MaxQueue < 0 || s.QueueTimeout < 0 {
+		return errors.New("MaxConcurrent, MaxQueue and QueueTimeout can not be negative")
+	}
+
+	if s.CullIdleAfter < 0 {
+		return errors.New("CullIdleAfter can not be negative")
+	}
+
+	if err := s.HandshakeFaults.validate(); err != nil {
+		return err
+	}
+
+	if err := s.ConnectionChurn.validate(); err != nil {
+		return err
+	}
+
+	if err := s.LatencySpikes.validate(); err != nil {
+		return err
+	}
+
+	if err := s.GRPCFaults.validate(); err != nil {
+		return err
+	}
+
+	if err := s.Compression.validate(); err != nil {
+		return err
+	}
+
+	if err := s.StickyDelay.validate(); err != nil {
+		return err
+	}
+
+	if err := s.Faults.validate(); err != nil {
+		return err
+	}
+
+	delay := UpdateDelayRequest{
+		MinimumDelay:      s.MinimumDelay,
+		MaximumDelay:      s.MaximumDelay,
+		DelayDistribution: s.DelayDistribution,
+	}
+
+	return delay.Validate()
+}
+
+func (s *Settings) timeout() time.Duration {
+	return time.Duration(s.Timeout) * time.Millisecond
+}
+
+// Update settings request, settings left out keep their value. Also the
+// settings of a profile in the configuration.
+type UpdateSettingsRequest struct {
+	RateLimitRate  *float64 `json:"rateLimitRate" yaml:"rate_limit_rate,omitempty"`
+	RateLimitBurst *int     `json:"rateLimitBurst" yaml:"rate_limit_burst,omitempty"`
+	Timeout        *int64   `json:"timeout" yaml:"timeout,omitempty"`
+	MaxConcurrent  *int     `json:"maxConcurrent" yaml:"max_concurrent,omitempty"`
+	MaxQueue       *int     `json:"maxQueue" yaml:"max_queue,omitempty"`
+	QueueTimeout   *int64   `json:"queueTimeout" yaml:"queue_timeout,omitempty"`
+	MinimumDelay   *int64   `json:"minimumDelay" yaml:"minimum_delay,omitempty"`
+	MaximumDelay   *int64   `json:"maximumDelay" yaml:"maximum_delay,omitempty"`
+	StickyMode     *string  `json:"stickyMode" yaml:"sticky_mode,omitempty"`
+	SlowShare      *float64 `json:"slowShare" yaml:"slow_share,omitempty"`
+	SlowDelay      *int64   `json:"slowDelay" yaml:"slow_delay,omitempty"`
+
+	// Replace all the faults when given
+	Faults Faults `json:"faults" yaml:"faults,omitempty"`
+
+	CullIdleAfter  *int64 `json:"cullIdleAfter" yaml:"cull_idle_after,omitempty"`
+	CullIdleRandom *bool  `json:"cullIdleRandom" yaml:"cull_idle_random,omitempty"`
+
+	HandshakeDelayRatio *float64 `json:"handshakeDelayRatio" yaml:"handshake_delay_ratio,omitempty"`
+	HandshakeDelay      *int64   `json:"handshakeDelay" yaml:"handshake_delay,omitempty"`
+	HandshakeFailRatio  *float64 `json:"handshakeFailRatio" yaml:"handshake_fail_ratio,omitempty"`
+
+	CloseRatio *float64 `json:"closeRatio" yaml:"close_ratio,omitempty"`
+
+	PauseEvery *int64 `json:"pauseEvery" yaml:"pause_every,omitempty"`
+	PauseFor   *int64 `json:"pauseFor" yaml:"pause_for,omitempty"`
+
+	GRPCErrorRatio *float64 `json:"grpcErrorRatio" yaml:"grpc_error_ratio,omitempty"`
+	GRPCErrorCode  *int     `json:"grpcErrorCode" yaml:"grpc_error_code,omitempty"`
+
+	CompressionLevel   *int `json:"compressionLevel" yaml:"compression_level,omitempty"`
+	CompressionMinSize *int `json:"compressionMinSize" yaml:"compression_min_size,omitempty"`
+
+	Middlewares *UpdateMiddlewaresRequest `json:"middlewares" yaml:"middlewares,omitempty"`
+}
+
+func (r *UpdateSettingsRequest) apply(settings *Settings) {
+	if r.RateLimitRate != nil {
+		settings.RateLimitRate = *r.RateLimitRate
+	}
+
+	if r.RateLimitBurst != nil {
+		settings.RateLimitBurst = *r.RateLimitBurst
+	}
+
+	if r.Timeout != nil {
+		settings.Timeout = *r.Timeout
+	}
+
+	if r.MaxConcurrent != nil {
+		settings.MaxConcurrent = *r.MaxConcurrent
+	}
+
+	if r.MaxQueue != nil {
+		settings.MaxQueue = *r.MaxQueue
+	}
+
+	if r.QueueTimeout != nil {
+		settings.QueueTimeout = *r.QueueTimeout
+	}
+
+	if r.MinimumDelay != nil {
+		settings.MinimumDelay = *r.MinimumDelay
+	}
+
+	if r.MaximumDelay != nil {
+		settings.MaximumDelay = *r.MaximumDelay
+	}
+
+	if r.StickyMode != nil {
+		settings.StickyMode = *r.StickyMode
+	}
+
+	if r.SlowShare != nil {
+		settings.SlowShare = *r.SlowShare
+	}
+
+	if r.SlowDelay != nil {
+		settings.SlowDelay = *r.SlowDelay
+	}
+
+	if r.Faults != nil {
+		settings.Faults = r.Faults
+	}
+
+	if r.CullIdleAfter != nil {
+		settings.CullIdleAfter = *r.CullIdleAfter
+	}
+
+	if r.CullIdleRandom != nil {
+		settings.CullIdleRandom = *r.CullIdleRandom
+	}
+
+	if r.HandshakeDelayRatio != nil {
+		settings.HandshakeDelayRatio = *r.HandshakeDelayRatio
+	}
+
+	if r.HandshakeDelay != nil {
+		settings.HandshakeDelay = *r.HandshakeDelay
+	}
+
+	if r.HandshakeFailRatio != nil {
+		settings.HandshakeFailRatio = *r.HandshakeFailRatio
+	}
+
+	if r.CloseRatio != nil {
+		settings.CloseRatio = *r.CloseRatio
+	}
+
+	if r.PauseEvery != nil {
+		settings.PauseEvery = *r.PauseEvery
+	}
+
+	if r.PauseFor != nil {
+		settings.PauseFor = *r.PauseFor
+	}
+
+	if r.GRPCErrorRatio != nil {
+		settings.GRPCErrorRatio = *r.GRPCErrorRatio
+	}
+
+	if r.GRPCErrorCode != nil {
+		settings.GRPCErrorCode = *r.GRPCErrorCode
+	}
+
+	if r.CompressionLevel != nil {
+		settings.CompressionLevel = *r.CompressionLevel
+	}
+
+	if r.CompressionMinSize != nil {
+		settings.CompressionMinSize = *r.CompressionMinSize
+	}
+
+	if r.Middlewares != nil {
+		r.Middlewares.apply(&settings.Middlewares)
+	}
+}
+
+// Current settings, replaced as a whole so every request sees a consistent
+// snapshot. Updates affect subsequent requests only.
+type SettingsStore struct {
+	// Serializes updates
+	mutex sync.Mutex
+
+	// Settings and the rate limiter matching them, swapped together
+	current atomic.Value
+
+	// File the settings are saved to on every change (empty disables it)
+	stateFile string
+
+	// Settings of the configuration, restored by Reset
+	configured Settings
+
+	audit *AuditLog
+}
+
+// Starts from the settings saved in the state file of the config, if any,
+// or else from the config itself
+func NewSettingsStore(config *Config) (*SettingsStore, error) {
+	settings := Settings{
+		RateLimitRate:  config.RateLimitRate,
+		RateLimitBurst: config.RateLimitBurst,
+		Timeout:        int64(config.Timeout / time.Millisecond),
+		MinimumDelay:   config.MinimumDelay,
+		MaximumDelay:   config.MaximumDelay,
+		Middlewares:    DefaultMiddlewares(),
+	}
+
+	configured := settings
+
+	if err := validateProfiles(config.Profiles, configured); err != nil {
+		return nil, err
+	}
+
+	if config.StateFile != "" {
+		restored, err := loadSettings(config.StateFile, settings)
+		if err != nil {
+			return nil, err
+		}
+
+		settings = restored
+	}
+
+	s := &SettingsStore{
+		stateFile:  config.StateFile,
+		configured: configured,
+		audit:      NewAuditLog(),
+	}
+
+	s.current.Store(newSettingsState(settings, nil))
+
+	return s, nil
+}
+
+// Settings of the state file over the defaults, or the defaults when the
+// file does not exist yet
+func loadSettings(path string, defaults Settings) (Settings, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return defaults, nil
+	}
+
+	if err != nil {
+		return defaults, err
+	}
+
+	settings := defaults
+
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return defaults, fmt.Errorf("parsing state file [%s] failed: %v", path, err)
+	}
+
+	if err := settings.Validate(); err != nil {
+		return defaults, fmt.Errorf("invalid state file [%s]: %v", path, err)
+	}
+
+	log.WithFields(log.Fields{
+		"StateFile": path,
+	}).Info("Settings restored")
+
+	return settings, nil
+}
+
+// Writes the settings to a temporary file renamed over the state file, so a
+// crash never leaves it half written
+func saveSettings(path string, settings Settings) error {
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func (s *SettingsStore) Get() Settings {
+	return s.state().settings
+}
+
+func (s *SettingsStore) state() *settingsState {
+	return s.current.Load().(*settingsState)
+}
+
+// Settings with the rate and concurrency limiters applying them
+type settingsState struct {
+	settings    Settings
+	limiter     *rate.Limiter
+	concurrency *concurrencyLimit
+}
+
+// Keeps the previous limiters, and so their tokens and slots, unless their
+// settings changed. Requests always see limiters matching the settings,
+// never a new rate with an old burst.
+func newSettingsState(settings Settings, previous *settingsState) *settingsState {
+	state := &settingsState{settings: settings}
+
+	if previous != nil && previous.settings.RateLimitRate == settings.RateLimitRate &&
+		previous.settings.RateLimitBurst == settings.RateLimitBurst {
+		state.limiter = previous.limiter
+	} else {
+		state.limiter = rate.NewLimiter(rate.Limit(settings.RateLimitRate), settings.RateLimitBurst)
+	}
+
+	// Requests holding a slot of a replaced limit release it there
+	if previous != nil && previous.settings.MaxConcurrent == settings.MaxConcurrent &&
+		previous.settings.MaxQueue == settings.MaxQueue && previous.settings.QueueTimeout == settings.QueueTimeout {
+		state.concurrency = previous.concurrency
+	} else {
+		state.concurrency = newConcurrencyLimit(&settings)
+	}
+
+	return state
+}
+
+// Applies update to a copy of the current settings, which replace them
+// when valid. The change is recorded in the audit log under entry.
+func (s *SettingsStore) Update(entry AuditEntry, update func(*Settings)) (Settings, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := s.state()
+	old := previous.settings
+
+	settings := old
+	update(&settings)
+
+	if err := settings.Validate(); err != nil {
+		return old, err
+	}
+
+	s.current.Store(newSettingsState(settings, previous))
+
+	entry.Time = time.Now()
+	entry.Old = old
+	entry.New = settings
+
+	s.audit.record(entry)
+
+	// The update applies even if it could not be saved
+	if s.stateFile != "" {
+		if err := saveSettings(s.stateFile, settings); err != nil {
+			log.Error("Saving settings failed with error: ", err.Error())
+		}
+	}
+
+	return settings, nil
+}
+
+// Restores the settings of the configuration, dropping every change made
+// at runtime or restored from the state file
+func (s *SettingsStore) Reset(entry AuditEntry) (Settings, error) {
+	return s.Update(entry, func(settings *Settings) {
+		*settings = s.configured
+	})
+}
+
+// Whether the rate limit lets one more request through
+func (s *SettingsStore) Allow() bool {
+	state := s.state()
+
+	if state.settings.RateLimitRate == 0 || !state.settings.Middlewares.RateLimit {
+		return true
+	}
+
+	return state.limiter.Allow()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Shutdown settings
+const (
+	ServerShutdownTimeout = 10000 * time.Millisecond
+)
+
+// Requests being handled, to tell how many a shutdown dropped
+type InFlight struct {
+	count int64
+}
+
+func (f *InFlight) Track() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		atomic.AddInt64(&f.count, 1)
+		defer atomic.AddInt64(&f.count, -1)
+
+		c.Next()
+	}
+}
+
+func (f *InFlight) current() int64 {
+	return atomic.LoadInt64(&f.count)
+}
+
+// Stops accepting connections and waits up to timeout for the requests in
+// flight, closing the connections of the ones still running after that
+func shutdown(servers []*http.Server, inFlight *InFlight, timeout time.Duration) {
+	log.WithFields(log.Fields{
+		"InFlight": inFlight.current(),
+		"Timeout":  timeout,
+	}).Info("Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var waitGroup sync.WaitGroup
+
+	for _, server := range servers {
+		waitGroup.Add(1)
+
+		go func(server *http.Server) {
+			defer waitGroup.Done()
+
+			if err := server.Shutdown(ctx); err != nil {
+				log.Warn("Server shutdown failed with error: ", err.Error())
+			}
+		}(server)
+	}
+
+	waitGroup.Wait()
+
+	dropped := inFlight.current()
+
+	for _, server := range servers {
+		server.Close()
+	}
+
+	log.WithFields(log.Fields{
+		"Dropped": dropped,
+	}).Info("Server stopped")
+}
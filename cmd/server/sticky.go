@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sticky delay modes
+const (
+	StickyNone       = ""
+	StickyConnection = "connection"
+	StickyClient     = "client"
+)
+
+// Extra delay pinned to a share of the connections or client IPs, so that
+// connection pooling keeps sending requests to slow backends
+type StickyDelay struct {
+	// connection, client (IP) or empty to disable it
+	StickyMode string `json:"stickyMode"`
+
+	// Share of the connections or clients which are persistently slow
+	SlowShare float64 `json:"slowShare"`
+
+	// Delay added to every request of a slow connection or client, in
+	// milliseconds
+	SlowDelay int64 `json:"slowDelay"`
+}
+
+func (d *StickyDelay) validate() error {
+	switch d.StickyMode {
+	case StickyNone, StickyConnection, StickyClient:
+	default:
+		return fmt.Errorf("unknown sticky mode [%s]", d.StickyMode)
+	}
+
+	if d.SlowShare < 0 || d.SlowShare > 1 {
+		return errors.New("SlowShare must be between 0 and 1")
+	}
+
+	if d.SlowDelay < 0 {
+		return errors.New("SlowDelay can not be negative")
+	}
+
+	return nil
+}
+
+// Whether each connection or client is slow, drawn the first time it is
+// seen and again whenever SlowShare changes
+type StickyDelays struct {
+	mutex sync.Mutex
+	slow  map[string]stickyDraw
+}
+
+type stickyDraw struct {
+	slow  bool
+	share float64
+}
+
+func NewStickyDelays() *StickyDelays {
+	return &StickyDelays{
+		slow: make(map[string]stickyDraw),
+	}
+}
+
+// Extra delay of the connection or client of the request
+func (s *StickyDelays) delay(c *gin.Context, settings *StickyDelay) time.Duration {
+	var key string
+
+	switch settings.StickyMode {
+	case StickyConnection:
+		key = StickyConnection + " " + c.Request.RemoteAddr
+	case StickyClient:
+		key = StickyClient + " " + c.ClientIP()
+	default:
+		return 0
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	draw, ok := s.slow[key]
+
+	if !ok || draw.share != settings.SlowShare {
+		draw = stickyDraw{slow: rand.Float64() < settings.SlowShare, share: settings.SlowShare}
+		s.slow[key] = draw
+	}
+
+	if !draw.slow {
+		return 0
+	}
+
+	return time.Duration(settings.SlowDelay) * time.Millisecond
+}
+
+// Forgets closed connections, for http.Server.ConnState
+func (s *StickyDelays) connState(conn net.Conn, state http.ConnState) {
+	if state != http.StateClosed && state != http.StateHijacked {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.slow, StickyConnection+" "+conn.RemoteAddr().String())
+}
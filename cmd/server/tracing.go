@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing settings
+const (
+	// Service of the request spans
+	TracingService = "poc-server"
+
+	TracerName = "github.com/dmazine/poc-http/cmd/server"
+
+	// Longest wait for the spans not exported yet on shutdown
+	TracingShutdownTimeout = 5 * time.Second
+)
+
+// Exports the spans over OTLP/gRPC to the collector at endpoint, taking
+// the parent of the request spans from the W3C traceparent header. The
+// returned function flushes the spans not exported yet.
+func setupTracing(endpoint string) (func(), error) {
+	driver := otlpgrpc.NewDriver(otlpgrpc.WithInsecure(), otlpgrpc.WithEndpoint(endpoint))
+
+	exporter, err := otlp.NewExporter(context.Background(), driver)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), TracingShutdownTimeout)
+		defer cancel()
+
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Warn("Flushing spans failed with error: ", err.Error())
+		}
+	}, nil
+}
+
+// Span child of the current span of the request, a no-op without tracing
+func startSpan(c *gin.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(c.Request.Context(), name)
+}
+
+// Runs the middleware, and the handlers it calls, within a span of its own
+func traced(name string, middleware gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, span := startSpan(c, name)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+
+		middleware(c)
+	}
+}
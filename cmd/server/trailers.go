@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Trailers settings, the query parameters of /trailers
+const (
+	// Body size in bytes, and chunks it is flushed in, by default
+	TrailersSize   = 1024
+	TrailersChunks = 4
+
+	MaxTrailersSize   = 10 * 1024 * 1024
+	MaxTrailersChunks = 1000
+
+	TrailersSizeQuery   = "size"
+	TrailersChunksQuery = "chunks"
+
+	ServerTimingTrailer = "Server-Timing"
+)
+
+// Streams a body in chunks, chunked over HTTP/1.1, followed by trailers
+// carrying its Digest and the processing time in Server-Timing, only known
+// once it was written
+func handleTrailers(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		size, err := intQuery(c, TrailersSizeQuery, TrailersSize, MaxTrailersSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		chunks, err := intQuery(c, TrailersChunksQuery, TrailersChunks, MaxTrailersChunks)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		if chunks == 0 {
+			chunks = 1
+		}
+
+		delay, ok, err := delayOverride(c, config.MaxDelayOverride)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		body := bytes.Repeat([]byte{'x'}, size)
+		hash := sha256.New()
+
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Trailer", DigestHeader+", "+ServerTimingTrailer)
+		c.Status(http.StatusOK)
+
+		for i := 0; i < chunks; i++ {
+			chunk := body[i*size/chunks : (i+1)*size/chunks]
+
+			if _, err := c.Writer.Write(chunk); err != nil {
+				return
+			}
+
+			hash.Write(chunk)
+			c.Writer.Flush()
+
+			// Spread over the chunks, the delay makes the processing time
+			if ok && i < chunks-1 {
+				select {
+				case <-time.After(delay / time.Duration(chunks-1)):
+				case <-c.Request.Context().Done():
+					return
+				}
+			}
+		}
+
+		c.Writer.Header().Set(DigestHeader, "sha-256="+base64.StdEncoding.EncodeToString(hash.Sum(nil)))
+		c.Writer.Header().Set(ServerTimingTrailer, fmt.Sprintf("app;dur=%.3f", float64(time.Since(start))/float64(time.Millisecond)))
+	}
+}
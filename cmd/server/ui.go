@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Admin page showing the settings and counters, refreshed every second, with
+// forms calling the admin API. It uses the credentials of the browser, so
+// only basic auth protects it.
+const adminPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>PoC HTTP server</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+input { width: 8em; }
+#error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>PoC HTTP server</h1>
+
+<h2>Counters</h2>
+<table id="counters"></table>
+
+<h2>Settings</h2>
+<p id="error"></p>
+<form id="settings">
+<table>
+<tr><th>Rate limit (requests/s)</th><td><input name="rateLimitRate" type="number" step="any" min="0"></td></tr>
+<tr><th>Rate limit burst</th><td><input name="rateLimitBurst" type="number" min="0"></td></tr>
+<tr><th>Timeout (ms)</th><td><input name="timeout" type="number" min="0"></td></tr>
+<tr><th>Max concurrent</th><td><input name="maxConcurrent" type="number" min="0"></td></tr>
+<tr><th>Max queue</th><td><input name="maxQueue" type="number" min="0"></td></tr>
+<tr><th>Queue timeout (ms)</th><td><input name="queueTimeout" type="number" min="0"></td></tr>
+<tr><th>Minimum delay (ms)</th><td><input name="minimumDelay" type="number" min="0"></td></tr>
+<tr><th>Maximum delay (ms)</th><td><input name="maximumDelay" type="number" min="0"></td></tr>
+<tr><th>Sticky mode</th><td><select name="stickyMode">
+<option value="">none</option><option value="connection">connection</option><option value="client">client</option>
+</select></td></tr>
+<tr><th>Slow share</th><td><input name="slowShare" type="number" step="any" min="0" max="1"></td></tr>
+<tr><th>Slow delay (ms)</th><td><input name="slowDelay" type="number" min="0"></td></tr>
+<tr><th>Faults (JSON by route)</th><td><textarea name="faults" rows="4" cols="40"></textarea></td></tr>
+<tr><th>Cull idle connections after (ms)</th><td><input name="cullIdleAfter" type="number" min="0"></td></tr>
+<tr><th>Cull after a random time up to it</th><td><input name="cullIdleRandom" type="checkbox"></td></tr>
+<tr><th>Connection: close ratio</th><td><input name="closeRatio" type="number" step="any" min="0" max="1"></td></tr>
+<tr><th>Pause every (ms)</th><td><input name="pauseEvery" type="number" min="0"></td></tr>
+<tr><th>Pause for (ms)</th><td><input name="pauseFor" type="number" min="0"></td></tr>
+<tr><th>gRPC error ratio</th><td><input name="grpcErrorRatio" type="number" step="any" min="0" max="1"></td></tr>
+<tr><th>gRPC error code</th><td><input name="grpcErrorCode" type="number" min="0" max="16"></td></tr>
+<tr><th>Compression level (0 disables it)</th><td><input name="compressionLevel" type="number" min="0" max="9"></td></tr>
+<tr><th>Compression minimum size (bytes)</th><td><input name="compressionMinSize" type="number" min="0"></td></tr>
+<tr><th>TLS handshake delay ratio</th><td><input name="handshakeDelayRatio" type="number" step="any" min="0" max="1"></td></tr>
+<tr><th>TLS handshake delay (ms)</th><td><input name="handshakeDelay" type="number" min="0"></td></tr>
+<tr><th>TLS handshake failure ratio</th><td><input name="handshakeFailRatio" type="number" step="any" min="0" max="1"></td></tr>
+<tr><th>Rate limit enabled</th><td><input name="middlewares.rateLimit" type="checkbox"></td></tr>
+<tr><th>Concurrency limit enabled</th><td><input name="middlewares.concurrencyLimit" type="checkbox"></td></tr>
+<tr><th>Timeout enabled</th><td><input name="middlewares.timeout" type="checkbox"></td></tr>
+<tr><th>Faults enabled</th><td><input name="middlewares.faults" type="checkbox"></td></tr>
+<tr><th>Recovery enabled</th><td><input name="middlewares.recovery" type="checkbox"></td></tr>
+<tr><th>Access log enabled</th><td><input name="middlewares.accessLog" type="checkbox"></td></tr>
+</table>
+<button type="submit">Update</button>
+<button type="button" id="reset">Reset to configuration</button>
+</form>
+
+<h2>Current settings</h2>
+<table id="current"></table>
+
+<script>
+var form = document.getElementById("settings");
+
+function rows(table, values) {
+	table.innerHTML = "";
+	Object.keys(values).sort().forEach(function (key) {
+		var row = table.insertRow();
+		row.insertCell().textContent = key;
+		row.insertCell().textContent = JSON.stringify(values[key]);
+	});
+}
+
+function request(method, path, body) {
+	return fetch(path, {
+		method: method,
+		headers: {"Content-Type": "application/json"},
+		body: body && JSON.stringify(body)
+	}).then(function (response) {
+		return response.json().then(function (json) {
+			if (!response.ok) {
+				throw new Error(json.error || response.statusText);
+			}
+			return json;
+		});
+	});
+}
+
+// Middlewares are nested, e.g. middlewares.timeout
+function field(values, name) {
+	var path = name.split(".");
+	var key = path.pop();
+	path.forEach(function (part) {
+		values = values[part] = values[part] || {};
+	});
+	return {values: values, key: key};
+}
+
+function show(settings) {
+	rows(document.getElementById("current"), settings);
+	Array.prototype.forEach.call(form.elements, function (input) {
+		if (!input.name || document.activeElement === input) {
+			return;
+		}
+		var f = field(settings, input.name);
+		if (input.type === "checkbox") {
+			input.checked = f.values[f.key];
+		} else if (input.type === "textarea") {
+			input.value = JSON.stringify(f.values[f.key] || {});
+		} else {
+			input.value = f.values[f.key];
+		}
+	});
+}
+
+function failed(err) {
+	document.getElementById("error").textContent = err.message;
+}
+
+function refresh() {
+	request("GET", "counters").then(function (counters) {
+		var statuses = counters.statuses;
+		delete counters.statuses;
+		Object.keys(statuses).forEach(function (status) {
+			counters["status " + status] = statuses[status];
+		});
+		rows(document.getElementById("counters"), counters);
+	}).catch(failed);
+}
+
+form.addEventListener("submit", function (event) {
+	event.preventDefault();
+
+	// Rejected on invalid JSON
+	new Promise(function (resolve) {
+		var update = {};
+		Array.prototype.forEach.call(form.elements, function (input) {
+			if (!input.name) {
+				return;
+			}
+			var f = field(update, input.name);
+			if (input.type === "checkbox") {
+				f.values[f.key] = input.checked;
+			} else if (input.type === "textarea") {
+				f.values[f.key] = JSON.parse(input.value || "{}");
+			} else {
+				f.values[f.key] = input.type === "number" ? Number(input.value) : input.value;
+			}
+		});
+		resolve(update);
+	}).then(function (update) {
+		return request("PUT", "settings", update);
+	}).then(function (settings) {
+		document.getElementById("error").textContent = "";
+		show(settings);
+	}).catch(failed);
+});
+
+document.getElementById("reset").addEventListener("click", function () {
+	request("POST", "reset").then(show).catch(failed);
+});
+
+request("GET", "settings").then(show).catch(failed);
+refresh();
+setInterval(refresh, 1000);
+</script>
+</body>
+</html>
+`
+
+func handleAdminUI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(adminPage))
+	}
+}
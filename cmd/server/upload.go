@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Answers to Expect: 100-continue of /upload, chosen with the expect query
+// parameter
+const (
+	// Send 100 Continue at once (default)
+	ExpectContinue = "continue"
+
+	// Send 100 Continue after the delay of the delay query parameter
+	ExpectDelay = "delay"
+
+	// Answer 417 Expectation Failed without reading the body
+	ExpectReject = "reject"
+
+	ExpectQuery = "expect"
+
+	// Largest body read
+	MaxUploadSize = 100 * 1024 * 1024
+)
+
+// Reads and discards the body, answering its size. The server sends the
+// interim 100 Continue response when the body is first read, so delaying
+// the read delays it, for the client ExpectContinueTimeout to fire against.
+func handleUpload(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mode := c.DefaultQuery(ExpectQuery, ExpectContinue)
+
+		switch mode {
+		case ExpectContinue:
+			// Sent by reading the body below
+
+		case ExpectDelay:
+			delay, _, err := delayOverride(c, config.MaxDelayOverride)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+				return
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-c.Request.Context().Done():
+				return
+			}
+
+		case ExpectReject:
+			c.JSON(http.StatusExpectationFailed, buildError(c, "expectation rejected"))
+			return
+
+		default:
+			c.JSON(http.StatusBadRequest, buildError(c, fmt.Sprintf("expect must be %s, %s or %s", ExpectContinue, ExpectDelay, ExpectReject)))
+			return
+		}
+
+		read, err := io.Copy(ioutil.Discard, http.MaxBytesReader(c.Writer, c.Request.Body, MaxUploadSize))
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, buildError(c, err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"bytes":  read,
+			"expect": c.GetHeader("Expect"),
+		})
+	}
+}
+
+// Multipart upload settings, the query parameters of /upload/multipart
+const (
+	MaxMultipartParts = 1000
+
+	MaxPartsQuery    = "maxParts"
+	MaxPartSizeQuery = "maxPartSize"
+)
+
+type UploadedPart struct {
+	Name     string `json:"name"`
+	FileName string `json:"fileName,omitempty"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// Parses a multipart/form-data body as it arrives, one part at a time,
+// waiting for the delay of the delay query parameter, drawn again for every
+// part, after reading each of them. Parts over maxPartSize bytes, or more
+// than maxParts of them, are answered with 413.
+func handleMultipartUpload(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maxParts, err := intQuery(c, MaxPartsQuery, MaxMultipartParts, MaxMultipartParts)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		maxPartSize, err := intQuery(c, MaxPartSizeQuery, MaxUploadSize, MaxUploadSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		if _, _, err := delayOverride(c, config.MaxDelayOverride); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxUploadSize)
+
+		reader, err := c.Request.MultipartReader()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		parts := []UploadedPart{}
+
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+				return
+			}
+
+			if len(parts) == maxParts {
+				c.JSON(http.StatusRequestEntityTooLarge, buildError(c, fmt.Sprintf("more than %d parts", maxParts)))
+				return
+			}
+
+			// One byte over the limit tells a part too large
+			read, err := io.Copy(ioutil.Discard, io.LimitReader(part, int64(maxPartSize)+1))
+			part.Close()
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+				return
+			}
+
+			if read > int64(maxPartSize) {
+				c.JSON(http.StatusRequestEntityTooLarge, buildError(c, fmt.Sprintf("part [%s] exceeds %d bytes", part.FormName(), maxPartSize)))
+				return
+			}
+
+			parts = append(parts, UploadedPart{Name: part.FormName(), FileName: part.FileName(), Bytes: read})
+
+			// Validated before reading the body
+			delay, _, _ := delayOverride(c, config.MaxDelayOverride)
+
+			select {
+			case <-time.After(delay):
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"parts": parts})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+// Share of the messages after which /ws/echo drops the connection instead
+// of echoing them, from 0 to 1
+const WebSocketDisconnectQuery = "disconnect"
+
+// Echoes every message with its frame type, after the delay of the delay
+// query parameter or X-Delay header, drawn again for every message
+func handleWebSocketEcho(config *Config, connections *Connections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, _, err := delayOverride(c, config.MaxDelayOverride); err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		disconnect, err := disconnectRatio(c.Query(WebSocketDisconnectQuery))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, buildError(c, err.Error()))
+			return
+		}
+
+		server := websocket.Server{
+			// Clients outside of browsers send no Origin
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(ws *websocket.Conn) {
+				echo(c, ws, config, connections, disconnect)
+			},
+		}
+
+		server.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+func echo(c *gin.Context, ws *websocket.Conn, config *Config, connections *Connections, disconnect float64) {
+	defer ws.Close()
+
+	// Hijacked connections keep the deadlines of the server timeouts,
+	// which would cut long-lived connections
+	ws.SetDeadline(time.Time{})
+
+	for {
+		var message frame
+
+		if err := echoCodec.Receive(ws, &message); err != nil {
+			return
+		}
+
+		// Validated on the upgrade
+		delay, _, _ := delayOverride(c, config.MaxDelayOverride)
+		time.Sleep(delay)
+
+		if disconnect > 0 && rand.Float64() < disconnect {
+			requestLog(c).WithFields(log.Fields{
+				"Conn": c.Request.RemoteAddr,
+			}).Debug("Dropping WebSocket connection")
+
+			connections.reset(c.Request.RemoteAddr)
+			return
+		}
+
+		if err := echoCodec.Send(ws, message); err != nil {
+			return
+		}
+	}
+}
+
+func disconnectRatio(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return 0, errors.New("disconnect must be between 0 and 1")
+	}
+
+	return ratio, nil
+}
+
+// Message with its frame type, text or binary
+type frame struct {
+	data        []byte
+	payloadType byte
+}
+
+var echoCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		message := v.(frame)
+		return message.data, message.payloadType, nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		*v.(*frame) = frame{data: data, payloadType: payloadType}
+		return nil
+	},
+}
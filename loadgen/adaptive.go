@@ -0,0 +1,227 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Adaptive timeout settings
+const (
+	AdaptiveTimeoutPercentile = 99
+	AdaptiveTimeoutFactor     = 2.0
+	AdaptiveTimeoutMin        = 100 * time.Millisecond
+	AdaptiveTimeoutMax        = 5000 * time.Millisecond
+	AdaptiveTimeoutWindowSize = 1000
+
+	// Samples required before the adaptive timeout replaces the static one
+	AdaptiveTimeoutMinSamples = 100
+)
+
+// Replaces the client timeout by a per-request deadline derived from recent latencies
+type AdaptiveTimeoutOptions struct {
+	Enabled    bool
+	Percentile float64
+	Factor     float64
+	Min        time.Duration
+	Max        time.Duration
+	WindowSize int
+	MinSamples int
+}
+
+func DefaultAdaptiveTimeoutOptions() AdaptiveTimeoutOptions {
+	return AdaptiveTimeoutOptions{
+		Percentile: AdaptiveTimeoutPercentile,
+		Factor:     AdaptiveTimeoutFactor,
+		Min:        AdaptiveTimeoutMin,
+		Max:        AdaptiveTimeoutMax,
+		WindowSize: AdaptiveTimeoutWindowSize,
+		MinSamples: AdaptiveTimeoutMinSamples,
+	}
+}
+
+func (o *AdaptiveTimeoutOptions) Validate() error {
+	if !o.Enabled {
+		return nil
+	}
+
+	if o.Percentile <= 0 || o.Percentile > 100 {
+		return errors.New("adaptive timeout Percentile must be between 0 and 100")
+	}
+
+	if o.Factor <= 0 {
+		return errors.New("adaptive timeout Factor must be positive")
+	}
+
+	if o.Min <= 0 || o.Max < o.Min {
+		return errors.New("adaptive timeout Min must be positive and Max at least Min")
+	}
+
+	if o.MinSamples < 1 || o.WindowSize < o.MinSamples {
+		return errors.New("adaptive timeout MinSamples must be at least 1 and WindowSize at least MinSamples")
+	}
+
+	return nil
+}
+
+// Per-request timeout computed from a sliding window of observed latencies
+type AdaptiveTimeout struct {
+	mutex sync.Mutex
+
+	options       AdaptiveTimeoutOptions
+	staticTimeout time.Duration
+	startTime     time.Time
+
+	window []time.Duration
+	next   int
+
+	// Cached timeout, recomputed every MinSamples observations
+	current      time.Duration
+	observations int64
+
+	// Every recomputed timeout, to follow its evolution over the run
+	timeline []AdaptiveTimeoutSample
+
+	fired             int64
+	firedBeforeStatic int64
+	staticWouldFire   int64
+}
+
+// Starts from the static timeout within Min and Max, or from Max when the
+// static timeout is disabled (0)
+func NewAdaptiveTimeout(options AdaptiveTimeoutOptions, staticTimeout time.Duration) *AdaptiveTimeout {
+	a := &AdaptiveTimeout{
+		options:       options,
+		staticTimeout: staticTimeout,
+		startTime:     time.Now(),
+		window:        make([]time.Duration, 0, options.WindowSize),
+		current:       options.Max,
+	}
+
+	if staticTimeout > 0 {
+		a.current = a.clamp(staticTimeout)
+	}
+
+	return a
+}
+
+// Cause of the cancellation of requests whose adaptive deadline expired, to
+// tell it apart from the other deadlines of the request
+var errAdaptiveTimeout = errors.New("adaptive timeout expired")
+
+// Returns a context carrying the current adaptive deadline
+func (a *AdaptiveTimeout) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc, time.Duration) {
+	timeout := a.Timeout()
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, errAdaptiveTimeout)
+	return ctx, cancel, timeout
+}
+
+func (a *AdaptiveTimeout) Timeout() time.Duration {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.current
+}
+
+// Feeds the outcome of a request sent with the given timeout and the
+// context returned by WithTimeout
+func (a *AdaptiveTimeout) Observe(ctx context.Context, elapsed time.Duration, timeout time.Duration, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// Only the adaptive deadline, not RequestTimeout or that of the caller
+	timedOut := err != nil && errors.Is(context.Cause(ctx), errAdaptiveTimeout)
+
+	if timedOut {
+		a.fired++
+
+		if a.staticTimeout == 0 || timeout < a.staticTimeout {
+			a.firedBeforeStatic++
+		}
+	}
+
+	if a.staticTimeout > 0 && elapsed >= a.staticTimeout {
+		a.staticWouldFire++
+	}
+
+	// Timed-out requests only tell the latency was at least the deadline,
+	// and other failures say nothing about the latency of the server
+	if err != nil {
+		return
+	}
+
+	if len(a.window) < cap(a.window) {
+		a.window = append(a.window, elapsed)
+	} else {
+		a.window[a.next] = elapsed
+		a.next = (a.next + 1) % len(a.window)
+	}
+
+	a.observations++
+
+	minSamples := int64(a.options.MinSamples)
+
+	if len(a.window) >= a.options.MinSamples && a.observations%minSamples == 0 {
+		latency := a.percentile()
+		a.current = a.clamp(time.Duration(float64(latency) * a.options.Factor))
+
+		a.timeline = append(a.timeline, AdaptiveTimeoutSample{
+			Elapsed: time.Since(a.startTime),
+			Latency: latency,
+			Timeout: a.current,
+		})
+	}
+}
+
+// Configured percentile of the latencies in the window
+func (a *AdaptiveTimeout) percentile() time.Duration {
+	sorted := make([]time.Duration, len(a.window))
+	copy(sorted, a.window)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return percentile(sorted, a.options.Percentile)
+}
+
+func (a *AdaptiveTimeout) clamp(timeout time.Duration) time.Duration {
+	if timeout < a.options.Min {
+		return a.options.Min
+	}
+
+	if timeout > a.options.Max {
+		return a.options.Max
+	}
+
+	return timeout
+}
+
+func (a *AdaptiveTimeout) report() *AdaptiveTimeoutReport {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	report := &AdaptiveTimeoutReport{
+		StaticTimeout:     a.staticTimeout,
+		FinalTimeout:      a.current,
+		MinTimeout:        a.current,
+		MaxTimeout:        a.current,
+		Fired:             a.fired,
+		FiredBeforeStatic: a.firedBeforeStatic,
+		StaticWouldFire:   a.staticWouldFire,
+		Timeline:          make([]AdaptiveTimeoutSample, len(a.timeline)),
+	}
+
+	copy(report.Timeline, a.timeline)
+
+	for _, sample := range a.timeline {
+		if sample.Timeout < report.MinTimeout {
+			report.MinTimeout = sample.Timeout
+		}
+
+		if sample.Timeout > report.MaxTimeout {
+			report.MaxTimeout = sample.Timeout
+		}
+	}
+
+	return report
+}
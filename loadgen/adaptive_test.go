@@ -0,0 +1,148 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testAdaptiveTimeoutOptions() AdaptiveTimeoutOptions {
+	return AdaptiveTimeoutOptions{
+		Enabled:    true,
+		Percentile: 50,
+		Factor:     2,
+		Min:        100 * time.Millisecond,
+		Max:        time.Second,
+		WindowSize: 10,
+		MinSamples: 5,
+	}
+}
+
+func TestNewAdaptiveTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		staticTimeout time.Duration
+		timeout       time.Duration
+	}{
+		{"no static timeout", 0, time.Second},
+		{"static under min", 10 * time.Millisecond, 100 * time.Millisecond},
+		{"static within bounds", 500 * time.Millisecond, 500 * time.Millisecond},
+		{"static over max", time.Minute, time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adaptive := NewAdaptiveTimeout(testAdaptiveTimeoutOptions(), test.staticTimeout)
+
+			if timeout := adaptive.Timeout(); timeout != test.timeout {
+				t.Errorf("Timeout() returned %v, expected %v", timeout, test.timeout)
+			}
+		})
+	}
+}
+
+func TestAdaptiveTimeoutObserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		errs      []error
+		timeout   time.Duration
+	}{
+		{
+			"under min samples",
+			[]time.Duration{200, 200, 200, 200},
+			[]error{nil, nil, nil, nil},
+			500 * time.Millisecond,
+		},
+		{
+			"recomputed",
+			[]time.Duration{200, 200, 200, 200, 200},
+			[]error{nil, nil, nil, nil, nil},
+			400 * time.Millisecond,
+		},
+		{
+			"clamped to max",
+			[]time.Duration{800, 800, 800, 800, 800},
+			[]error{nil, nil, nil, nil, nil},
+			time.Second,
+		},
+		{
+			"clamped to min",
+			[]time.Duration{10, 10, 10, 10, 10},
+			[]error{nil, nil, nil, nil, nil},
+			100 * time.Millisecond,
+		},
+		{
+			"timed out samples left out",
+			[]time.Duration{200, 200, 200, 200, 500},
+			[]error{nil, nil, nil, nil, context.DeadlineExceeded},
+			500 * time.Millisecond,
+		},
+		{
+			"failed samples left out",
+			[]time.Duration{200, 200, 200, 200, 1},
+			[]error{nil, nil, nil, nil, errors.New("connection reset")},
+			500 * time.Millisecond,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adaptive := NewAdaptiveTimeout(testAdaptiveTimeoutOptions(), 500*time.Millisecond)
+
+			for i, latency := range test.latencies {
+				adaptive.Observe(context.Background(), latency*time.Millisecond, adaptive.Timeout(), test.errs[i])
+			}
+
+			if timeout := adaptive.Timeout(); timeout != test.timeout {
+				t.Errorf("Timeout() returned %v, expected %v", timeout, test.timeout)
+			}
+		})
+	}
+}
+
+func TestAdaptiveTimeoutReport(t *testing.T) {
+	tests := []struct {
+		name              string
+		staticTimeout     time.Duration
+		fired             int64
+		firedBeforeStatic int64
+		staticWouldFire   int64
+	}{
+		{"no static timeout", 0, 2, 2, 0},
+		{"static timeout", 300 * time.Millisecond, 2, 1, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adaptive := NewAdaptiveTimeout(testAdaptiveTimeoutOptions(), test.staticTimeout)
+
+			expired, cancel := context.WithTimeoutCause(context.Background(), 0, errAdaptiveTimeout)
+			defer cancel()
+
+			// Expired by another deadline, e.g. RequestTimeout
+			otherExpired, cancelOther := context.WithTimeout(context.Background(), 0)
+			defer cancelOther()
+
+			adaptive.Observe(expired, 200*time.Millisecond, 200*time.Millisecond, context.DeadlineExceeded)
+			adaptive.Observe(expired, 300*time.Millisecond, 300*time.Millisecond, context.DeadlineExceeded)
+			adaptive.Observe(otherExpired, 100*time.Millisecond, 300*time.Millisecond, context.DeadlineExceeded)
+			adaptive.Observe(context.Background(), 100*time.Millisecond, 300*time.Millisecond, nil)
+
+			report := adaptive.report()
+
+			if report.Fired != test.fired {
+				t.Errorf("fired %d times, expected %d", report.Fired, test.fired)
+			}
+
+			if report.FiredBeforeStatic != test.firedBeforeStatic {
+				t.Errorf("fired %d times before the static timeout, expected %d", report.FiredBeforeStatic, test.firedBeforeStatic)
+			}
+
+			if report.StaticWouldFire != test.staticWouldFire {
+				t.Errorf("static timeout would have fired %d times, expected %d", report.StaticWouldFire, test.staticWouldFire)
+			}
+		})
+	}
+}
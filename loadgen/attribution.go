@@ -0,0 +1,149 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration unmarshalled from strings such as "250ms"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Share of the end-to-end latency consumed by a step
+type StepAttribution struct {
+	// Time spent by the step on the critical path
+	criticalTime time.Duration
+
+	// Iterations where the step was the largest contributor
+	dominant int64
+
+	// SLO breaches blamed on the step
+	breaches int64
+}
+
+// Returns the steps whose completion determined the iteration latency,
+// from the last one back to the root. Failed iterations end with the first
+// step which failed, the steps skipped after it never running.
+func criticalPath(scenario *Scenario, results map[string]*stepResult) []*Step {
+	steps := make(map[string]*Step, len(scenario.Steps))
+
+	var last, failed *Step
+
+	for _, step := range scenario.Steps {
+		steps[step.Name] = step
+
+		result := results[step.Name]
+		if result.startTime.IsZero() {
+			continue
+		}
+
+		if last == nil || result.finishTime.After(results[last.Name].finishTime) {
+			last = step
+		}
+
+		if result.err != nil && (failed == nil || result.finishTime.Before(results[failed.Name].finishTime)) {
+			failed = step
+		}
+	}
+
+	if failed != nil {
+		last = failed
+	}
+
+	var path []*Step
+
+	for step := last; step != nil; {
+		path = append(path, step)
+
+		var next *Step
+
+		for _, name := range step.DependsOn {
+			if next == nil || results[name].finishTime.After(results[next.Name].finishTime) {
+				next = steps[name]
+			}
+		}
+
+		step = next
+	}
+
+	return path
+}
+
+// Attributes the iteration latency to the steps on its critical path
+func (s *ScenarioStats) recordAttribution(scenario *Scenario, results map[string]*stepResult, elapsed time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var dominant string
+	var dominantTime time.Duration
+
+	for _, step := range criticalPath(scenario, results) {
+		result := results[step.Name]
+		stepTime := result.finishTime.Sub(result.startTime)
+
+		s.attribution(step.Name).criticalTime += stepTime
+
+		if stepTime > dominantTime {
+			dominant, dominantTime = step.Name, stepTime
+		}
+	}
+
+	s.attributedTime += elapsed
+
+	if dominant == "" {
+		return
+	}
+
+	s.attribution(dominant).dominant++
+
+	if scenario.SLO > 0 && elapsed > time.Duration(scenario.SLO) {
+		s.breaches++
+		s.attribution(dominant).breaches++
+	}
+}
+
+func (s *ScenarioStats) attribution(name string) *StepAttribution {
+	attribution, ok := s.attributions[name]
+	if !ok {
+		attribution = &StepAttribution{}
+		s.attributions[name] = attribution
+	}
+
+	return attribution
+}
+
+func (s *ScenarioStats) reportAttribution(report *ScenarioReport) {
+	for name, attribution := range s.attributions {
+		step, ok := report.Steps[name]
+		if !ok {
+			continue
+		}
+
+		if s.attributedTime > 0 {
+			step.Share = float64(attribution.criticalTime) / float64(s.attributedTime)
+		}
+
+		step.Dominant = attribution.dominant
+		step.SLOBreaches = attribution.breaches
+	}
+}
@@ -0,0 +1,66 @@
+package loadgen
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCriticalPath(t *testing.T) {
+	start := time.Now()
+
+	// Ran from ms to ms, or skipped when both are zero
+	result := func(from, to time.Duration, failed bool) *stepResult {
+		result := &stepResult{finishTime: start.Add(to * time.Millisecond)}
+
+		if from > 0 || to > 0 {
+			result.startTime = start.Add(from * time.Millisecond)
+		}
+
+		if failed {
+			result.err = errors.New("failed")
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		name    string
+		results map[string]*stepResult
+		path    []string
+	}{
+		{"completed", map[string]*stepResult{
+			"a": result(0, 10, false), "b": result(10, 30, false), "c": result(10, 20, false),
+		}, []string{"b", "a"}},
+		{"failed before a slower step", map[string]*stepResult{
+			"a": result(0, 10, false), "b": result(10, 15, true), "c": result(10, 40, false),
+		}, []string{"b", "a"}},
+		{"first failure", map[string]*stepResult{
+			"a": result(0, 10, false), "b": result(10, 25, true), "c": result(10, 20, true),
+		}, []string{"c", "a"}},
+		{"dependents skipped", map[string]*stepResult{
+			"a": result(0, 10, true), "b": result(0, 0, true), "c": result(0, 0, true),
+		}, []string{"a"}},
+	}
+
+	scenario := &Scenario{Steps: []*Step{
+		{Name: "a", Path: "/"},
+		{Name: "b", Path: "/", DependsOn: []string{"a"}},
+		{Name: "c", Path: "/", DependsOn: []string{"a"}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var path []string
+
+			for _, step := range criticalPath(scenario, test.results) {
+				path = append(path, step.Name)
+			}
+
+			if !reflect.DeepEqual(path, test.path) {
+				t.Errorf("criticalPath() returned %v, expected %v", path, test.path)
+			}
+		})
+	}
+}
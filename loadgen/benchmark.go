@@ -0,0 +1,227 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Benchmark settings
+const (
+	BenchmarkUsers           = 10
+	BenchmarkRequestsPerUser = 10000
+)
+
+// Transports compared by the benchmark
+const (
+	BenchmarkTransportHTTP  = "http"
+	BenchmarkTransportHTTP2 = "http2"
+)
+
+// Identical load sent through net/http and golang.org/x/net/http2 to an
+// in-process handler
+type BenchmarkOptions struct {
+	Users           int
+	RequestsPerUser int
+
+	// Directory receiving the CPU profiles and their diff
+	ProfileDir string
+}
+
+func DefaultBenchmarkOptions() BenchmarkOptions {
+	return BenchmarkOptions{
+		Users:           BenchmarkUsers,
+		RequestsPerUser: BenchmarkRequestsPerUser,
+		ProfileDir:      ".",
+	}
+}
+
+func (o *BenchmarkOptions) Validate() error {
+	if o.Users < 1 {
+		return errors.New("Users must be at least 1")
+	}
+
+	if o.RequestsPerUser < 1 {
+		return errors.New("RequestsPerUser must be at least 1")
+	}
+
+	if o.ProfileDir == "" {
+		return errors.New("ProfileDir can not be empty")
+	}
+
+	return nil
+}
+
+// Cost of each transport, measured for the whole process. The in-process
+// server runs HTTP/1.1 or HTTP/2 to match, so its cost is included too.
+type BenchmarkReport struct {
+	Results []BenchmarkResult `json:"results"`
+
+	// Output of go tool pprof -top -diff_base, http2 against http
+	Diff     string `json:"diff"`
+	DiffFile string `json:"diff_file"`
+}
+
+type BenchmarkResult struct {
+	Transport string        `json:"transport"`
+	Requests  int64         `json:"requests"`
+	Failures  int64         `json:"failures"`
+	Duration  time.Duration `json:"duration"`
+	Latency   Percentiles   `json:"latency"`
+
+	CPUTime          time.Duration `json:"cpu_time"`
+	CPUPerRequest    time.Duration `json:"cpu_per_request"`
+	AllocsPerRequest float64       `json:"allocs_per_request"`
+	BytesPerRequest  float64       `json:"bytes_per_request"`
+
+	Profile string `json:"profile"`
+}
+
+// Runs the same load through both transports one after the other,
+// profiling each run. The options only provide the client settings, the
+// target and the load are set by the benchmark.
+func BenchmarkTransports(ctx context.Context, options Options, benchmark BenchmarkOptions) (*BenchmarkReport, error) {
+	if err := benchmark.Validate(); err != nil {
+		return nil, err
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong")
+	}))
+
+	server.EnableHTTP2 = true
+	server.StartTLS()
+
+	defer server.Close()
+
+	options.BaseURL = server.URL
+	options.RequestPath = "/"
+	options.Protocol = ProtocolHTTP
+	options.Users = benchmark.Users
+	options.RequestsPerUser = benchmark.RequestsPerUser
+	options.Rate = 0
+	options.InsecureSkipVerify = true
+	options.Range.Enabled = false
+	options.Sinks = nil
+
+	report := &BenchmarkReport{}
+
+	for _, transport := range []string{BenchmarkTransportHTTP, BenchmarkTransportHTTP2} {
+		options.HTTP2 = transport == BenchmarkTransportHTTP2
+
+		profile := filepath.Join(benchmark.ProfileDir, "cpu-"+transport+".pprof")
+
+		result, err := benchmarkTransport(ctx, options, profile)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Transport = transport
+		report.Results = append(report.Results, *result)
+	}
+
+	report.DiffFile = filepath.Join(benchmark.ProfileDir, "cpu-diff.txt")
+
+	diff, err := exec.Command("go", "tool", "pprof", "-top",
+		"-diff_base", report.Results[0].Profile, report.Results[1].Profile).CombinedOutput()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Base":    report.Results[0].Profile,
+			"Profile": report.Results[1].Profile,
+		}).Printf("Diffing CPU profiles failed with error [%v]\n", err)
+
+		report.DiffFile = ""
+		return report, nil
+	}
+
+	report.Diff = string(diff)
+
+	return report, ioutil.WriteFile(report.DiffFile, diff, 0644)
+}
+
+func benchmarkTransport(ctx context.Context, options Options, profile string) (*BenchmarkResult, error) {
+	file, err := os.Create(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	// Start from the same heap for both transports
+	runtime.GC()
+
+	var before, after runtime.MemStats
+
+	runtime.ReadMemStats(&before)
+	cpuBefore := processCPUTime()
+
+	if err := pprof.StartCPUProfile(file); err != nil {
+		return nil, err
+	}
+
+	report, err := Run(ctx, Scenario{}, options)
+
+	pprof.StopCPUProfile()
+
+	if err != nil {
+		return nil, err
+	}
+
+	cpuTime := processCPUTime() - cpuBefore
+	runtime.ReadMemStats(&after)
+
+	if report.Attempts == 0 {
+		return nil, fmt.Errorf("no request was sent to [%s]", options.BaseURL)
+	}
+
+	attempts := float64(report.Attempts)
+
+	return &BenchmarkResult{
+		Requests:         report.Requests,
+		Failures:         report.Failures,
+		Duration:         report.Duration,
+		Latency:          report.Latency,
+		CPUTime:          cpuTime,
+		CPUPerRequest:    time.Duration(float64(cpuTime) / attempts),
+		AllocsPerRequest: float64(after.Mallocs-before.Mallocs) / attempts,
+		BytesPerRequest:  float64(after.TotalAlloc-before.TotalAlloc) / attempts,
+		Profile:          profile,
+	}, nil
+}
+
+// Logs the comparison
+func (r *BenchmarkReport) Print() {
+	for _, result := range r.Results {
+		log.WithFields(log.Fields{
+			"Transport":        result.Transport,
+			"Requests":         result.Requests,
+			"Failures":         result.Failures,
+			"Duration":         result.Duration,
+			"CPUTime":          result.CPUTime,
+			"CPUPerRequest":    result.CPUPerRequest,
+			"AllocsPerRequest": result.AllocsPerRequest,
+			"BytesPerRequest":  result.BytesPerRequest,
+			"Profile":          result.Profile,
+		}).Print("Transport benchmark")
+
+		result.Latency.print(result.Transport)
+	}
+
+	if r.DiffFile != "" {
+		log.WithFields(log.Fields{
+			"DiffFile": r.DiffFile,
+		}).Print("CPU profile diff, http2 against http")
+	}
+}
@@ -0,0 +1,275 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Circuit breaker settings
+const (
+	CircuitBreakerFailureRatio   = 0.5
+	CircuitBreakerMinRequests    = 20
+	CircuitBreakerWindow         = 10 * time.Second
+	CircuitBreakerOpenDuration   = 5 * time.Second
+	CircuitBreakerHalfOpenProbes = 3
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// Returned instead of sending the request while the circuit is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Fails fast once too many round trips failed, then lets a few probes
+// through to find out whether the server recovered
+type CircuitBreakerOptions struct {
+	Enabled bool
+
+	// Opens when this share of the round trips of a window failed, with an
+	// error or a 5xx or 429 status, once the window saw at least MinRequests
+	FailureRatio float64
+	MinRequests  int
+	Window       time.Duration
+
+	// Time spent open before probing the server again
+	OpenDuration time.Duration
+
+	// Successful probes needed to close again, a failed one opens again
+	HalfOpenProbes int
+}
+
+func DefaultCircuitBreakerOptions() CircuitBreakerOptions {
+	return CircuitBreakerOptions{
+		FailureRatio:   CircuitBreakerFailureRatio,
+		MinRequests:    CircuitBreakerMinRequests,
+		Window:         CircuitBreakerWindow,
+		OpenDuration:   CircuitBreakerOpenDuration,
+		HalfOpenProbes: CircuitBreakerHalfOpenProbes,
+	}
+}
+
+func (o *CircuitBreakerOptions) Validate() error {
+	if !o.Enabled {
+		return nil
+	}
+
+	if o.FailureRatio <= 0 || o.FailureRatio > 1 {
+		return errors.New("circuit breaker FailureRatio must be between 0 and 1")
+	}
+
+	if o.MinRequests < 1 || o.HalfOpenProbes < 1 {
+		return errors.New("circuit breaker MinRequests and HalfOpenProbes must be at least 1")
+	}
+
+	if o.Window <= 0 || o.OpenDuration <= 0 {
+		return errors.New("circuit breaker Window and OpenDuration must be positive")
+	}
+
+	return nil
+}
+
+// State shared by all transports of a load test
+type CircuitBreaker struct {
+	options CircuitBreakerOptions
+
+	mutex sync.Mutex
+	state string
+
+	// Incremented on every transition, so outcomes of round trips admitted
+	// in an earlier state are ignored
+	generation uint64
+
+	// Closed state: outcomes of the current window
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	// Open state
+	openedAt time.Time
+
+	// Half-open state: probes let through and succeeded
+	probes    int
+	successes int
+
+	transitions map[string]int64
+	rejected    int64
+	timeOpen    time.Duration
+}
+
+func NewCircuitBreaker(options CircuitBreakerOptions) *CircuitBreaker {
+	return &CircuitBreaker{
+		options:     options,
+		state:       CircuitClosed,
+		windowStart: time.Now(),
+		transitions: make(map[string]int64),
+	}
+}
+
+// Whether a round trip may be sent, and the generation its outcome must be
+// recorded with
+func (b *CircuitBreaker) allow() (uint64, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.options.OpenDuration {
+		b.transition(CircuitHalfOpen)
+	}
+
+	switch b.state {
+	case CircuitClosed:
+		return b.generation, true
+
+	case CircuitHalfOpen:
+		if b.probes < b.options.HalfOpenProbes {
+			b.probes++
+			return b.generation, true
+		}
+	}
+
+	b.rejected++
+
+	return b.generation, false
+}
+
+// Records the outcome of a round trip admitted in the given generation
+func (b *CircuitBreaker) record(generation uint64, failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// Late outcomes of round trips admitted before the last transition
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case CircuitClosed:
+		if time.Since(b.windowStart) >= b.options.Window {
+			b.resetWindow()
+		}
+
+		b.requests++
+
+		if failed {
+			b.failures++
+		}
+
+		if b.requests >= b.options.MinRequests &&
+			float64(b.failures) >= b.options.FailureRatio*float64(b.requests) {
+			b.transition(CircuitOpen)
+		}
+
+	case CircuitHalfOpen:
+		if failed {
+			b.transition(CircuitOpen)
+			return
+		}
+
+		b.successes++
+
+		if b.successes >= b.options.HalfOpenProbes {
+			b.transition(CircuitClosed)
+		}
+	}
+}
+
+// Gives back the probe of a round trip cancelled or shed by the client,
+// which says nothing about the server
+func (b *CircuitBreaker) cancel(generation uint64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if generation == b.generation && b.state == CircuitHalfOpen {
+		b.probes--
+	}
+}
+
+func (b *CircuitBreaker) resetWindow() {
+	b.windowStart = time.Now()
+	b.requests = 0
+	b.failures = 0
+}
+
+func (b *CircuitBreaker) transition(state string) {
+	from := b.state
+
+	b.state = state
+	b.generation++
+	b.transitions[from+" -> "+state]++
+
+	log.WithFields(log.Fields{
+		"From":     from,
+		"To":       state,
+		"Requests": b.requests,
+		"Failures": b.failures,
+	}).Warn("Circuit breaker state changed")
+
+	switch state {
+	case CircuitOpen:
+		b.openedAt = time.Now()
+
+	case CircuitHalfOpen:
+		b.timeOpen += time.Since(b.openedAt)
+		b.probes = 0
+		b.successes = 0
+
+	case CircuitClosed:
+		b.resetWindow()
+	}
+}
+
+func (b *CircuitBreaker) report() *CircuitBreakerReport {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	report := &CircuitBreakerReport{
+		State:       b.state,
+		Transitions: make(map[string]int64, len(b.transitions)),
+		Rejected:    b.rejected,
+		TimeOpen:    b.timeOpen,
+	}
+
+	if b.state == CircuitOpen {
+		report.TimeOpen += time.Since(b.openedAt)
+	}
+
+	for transition, count := range b.transitions {
+		report.Transitions[transition] = count
+	}
+
+	return report
+}
+
+// Fails round trips with ErrCircuitOpen while the circuit is open. Errors
+// and 5xx or 429 responses count as failures, but not cancellations by the
+// client, e.g. by chaos or of the loser of a hedged request, nor rejections
+// by the bulkhead, which sheds load locally.
+func WithCircuitBreaker(breaker *CircuitBreaker) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			generation, ok := breaker.allow()
+			if !ok {
+				return nil, ErrCircuitOpen
+			}
+
+			resp, err := next.RoundTrip(req)
+
+			if errors.Is(err, context.Canceled) || errors.Is(err, ErrBulkheadFull) {
+				breaker.cancel(generation)
+				return resp, err
+			}
+
+			breaker.record(generation, err != nil || failedStatus(resp.StatusCode))
+
+			return resp, err
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestCircuitBreaker() *CircuitBreaker {
+	return NewCircuitBreaker(CircuitBreakerOptions{
+		Enabled:        true,
+		FailureRatio:   0.5,
+		MinRequests:    4,
+		Window:         time.Hour,
+		OpenDuration:   time.Hour,
+		HalfOpenProbes: 2,
+	})
+}
+
+// Sends a round trip through the breaker, returning whether it was allowed
+func roundTrip(b *CircuitBreaker, failed bool) bool {
+	generation, ok := b.allow()
+	if ok {
+		b.record(generation, failed)
+	}
+
+	return ok
+}
+
+// Lets the open duration elapse
+func elapseOpenDuration(b *CircuitBreaker) {
+	b.openedAt = b.openedAt.Add(-b.options.OpenDuration)
+}
+
+func TestCircuitBreakerClosed(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []bool
+		state    string
+	}{
+		{"successes", []bool{false, false, false, false}, CircuitClosed},
+		{"failures under ratio", []bool{true, false, false, false}, CircuitClosed},
+		{"failures at ratio", []bool{true, true, false, false}, CircuitOpen},
+		{"failures under min requests", []bool{true, true, true}, CircuitClosed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := newTestCircuitBreaker()
+
+			for _, failed := range test.outcomes {
+				roundTrip(breaker, failed)
+			}
+
+			if breaker.state != test.state {
+				t.Errorf("state is %s, expected %s", breaker.state, test.state)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	breaker := newTestCircuitBreaker()
+
+	for i := 0; i < 4; i++ {
+		roundTrip(breaker, true)
+	}
+
+	if roundTrip(breaker, false) {
+		t.Fatal("open circuit allowed a round trip")
+	}
+
+	elapseOpenDuration(breaker)
+
+	// Half-open: only HalfOpenProbes round trips at once
+	first, ok := breaker.allow()
+	if !ok || breaker.state != CircuitHalfOpen {
+		t.Fatalf("circuit is %s after the open duration, expected %s", breaker.state, CircuitHalfOpen)
+	}
+
+	second, _ := breaker.allow()
+
+	if _, ok := breaker.allow(); ok {
+		t.Fatal("half-open circuit allowed more probes than HalfOpenProbes")
+	}
+
+	breaker.record(first, false)
+	breaker.record(second, false)
+
+	if breaker.state != CircuitClosed {
+		t.Fatalf("circuit is %s after successful probes, expected %s", breaker.state, CircuitClosed)
+	}
+
+	report := breaker.report()
+
+	for _, transition := range []string{"closed -> open", "open -> half-open", "half-open -> closed"} {
+		if report.Transitions[transition] != 1 {
+			t.Errorf("transition %s counted %d times, expected 1", transition, report.Transitions[transition])
+		}
+	}
+
+	if report.Rejected != 2 {
+		t.Errorf("rejected %d round trips, expected 2", report.Rejected)
+	}
+}
+
+func TestCircuitBreakerFailedProbe(t *testing.T) {
+	breaker := newTestCircuitBreaker()
+
+	for i := 0; i < 4; i++ {
+		roundTrip(breaker, true)
+	}
+
+	elapseOpenDuration(breaker)
+	roundTrip(breaker, true)
+
+	if breaker.state != CircuitOpen {
+		t.Errorf("circuit is %s after a failed probe, expected %s", breaker.state, CircuitOpen)
+	}
+}
+
+func TestCircuitBreakerLateOutcome(t *testing.T) {
+	breaker := newTestCircuitBreaker()
+
+	// Admitted while closed, completing once the circuit is half-open
+	late, _ := breaker.allow()
+
+	for i := 0; i < 4; i++ {
+		roundTrip(breaker, true)
+	}
+
+	elapseOpenDuration(breaker)
+	breaker.allow()
+
+	breaker.record(late, true)
+
+	if breaker.state != CircuitHalfOpen {
+		t.Errorf("circuit is %s after a late failure, expected %s", breaker.state, CircuitHalfOpen)
+	}
+}
+
+func TestCircuitBreakerCancel(t *testing.T) {
+	breaker := newTestCircuitBreaker()
+
+	for i := 0; i < 4; i++ {
+		roundTrip(breaker, true)
+	}
+
+	elapseOpenDuration(breaker)
+
+	first, _ := breaker.allow()
+	breaker.allow()
+	breaker.cancel(first)
+
+	if _, ok := breaker.allow(); !ok {
+		t.Error("half-open circuit did not give back the probe of a cancelled round trip")
+	}
+}
+
+func TestWithCircuitBreakerFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		err        error
+		state      string
+	}{
+		{"succeeded", 200, nil, CircuitClosed},
+		{"not found", 404, nil, CircuitClosed},
+		{"server error", 503, nil, CircuitOpen},
+		{"too many requests", 429, nil, CircuitOpen},
+		{"failed", 0, errors.New("failed"), CircuitOpen},
+		{"cancelled", 0, context.Canceled, CircuitClosed},
+		{"bulkhead full", 0, ErrBulkheadFull, CircuitClosed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := newTestCircuitBreaker()
+
+			transport := WithCircuitBreaker(breaker)(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if test.err != nil {
+					return nil, test.err
+				}
+
+				return &http.Response{StatusCode: test.statusCode, Body: http.NoBody}, nil
+			}))
+
+			for i := 0; i < 4; i++ {
+				req, _ := http.NewRequest(http.MethodGet, "https://localhost:8443/", nil)
+				transport.RoundTrip(req)
+			}
+
+			if breaker.state != test.state {
+				t.Errorf("state is %s, expected %s", breaker.state, test.state)
+			}
+		})
+	}
+}
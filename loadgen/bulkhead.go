@@ -0,0 +1,179 @@
+package loadgen
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Bulkhead settings
+const (
+	BulkheadQueueTimeout = 100 * time.Millisecond
+)
+
+// Returned when no slot of the host freed up within the queue timeout
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// Caps the round trips in flight per host, so a slow host can't hold all
+// the workers
+type BulkheadOptions struct {
+	// Round trips in flight per host (0 disables the bulkhead)
+	MaxInFlight int
+
+	// Longest wait for a slot
+	QueueTimeout time.Duration
+}
+
+func DefaultBulkheadOptions() BulkheadOptions {
+	return BulkheadOptions{
+		QueueTimeout: BulkheadQueueTimeout,
+	}
+}
+
+func (o *BulkheadOptions) Validate() error {
+	if o.MaxInFlight < 0 {
+		return errors.New("bulkhead MaxInFlight can not be negative")
+	}
+
+	if o.MaxInFlight > 0 && o.QueueTimeout <= 0 {
+		return errors.New("bulkhead QueueTimeout must be positive")
+	}
+
+	return nil
+}
+
+// Slots of every host, shared by all transports
+type Bulkhead struct {
+	options BulkheadOptions
+
+	mutex sync.Mutex
+	hosts map[string]*hostBulkhead
+}
+
+type hostBulkhead struct {
+	slots chan struct{}
+
+	mutex        sync.Mutex
+	queueWaits   []time.Duration
+	serviceTimes []time.Duration
+	rejected     int64
+}
+
+func NewBulkhead(options BulkheadOptions) *Bulkhead {
+	return &Bulkhead{
+		options: options,
+		hosts:   make(map[string]*hostBulkhead),
+	}
+}
+
+func (b *Bulkhead) host(host string) *hostBulkhead {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	h, ok := b.hosts[host]
+	if !ok {
+		h = &hostBulkhead{slots: make(chan struct{}, b.options.MaxInFlight)}
+		b.hosts[host] = h
+	}
+
+	return h
+}
+
+func (h *hostBulkhead) recordWait(wait time.Duration, rejected bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if rejected {
+		h.rejected++
+		return
+	}
+
+	h.queueWaits = append(h.queueWaits, wait)
+}
+
+func (h *hostBulkhead) recordService(elapsed time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.serviceTimes = append(h.serviceTimes, elapsed)
+}
+
+func (b *Bulkhead) report() map[string]*BulkheadReport {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	report := make(map[string]*BulkheadReport, len(b.hosts))
+
+	for host, h := range b.hosts {
+		h.mutex.Lock()
+
+		report[host] = &BulkheadReport{
+			QueueWait:   newPercentiles(h.queueWaits),
+			ServiceTime: newPercentiles(h.serviceTimes),
+			Rejected:    h.rejected,
+		}
+
+		h.mutex.Unlock()
+	}
+
+	return report
+}
+
+// Waits for a slot of the request host before sending it, and keeps the
+// slot until the response body is closed
+func WithBulkhead(bulkhead *Bulkhead) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			host := bulkhead.host(req.URL.Host)
+
+			startTime := time.Now()
+			timer := time.NewTimer(bulkhead.options.QueueTimeout)
+
+			select {
+			case host.slots <- struct{}{}:
+				timer.Stop()
+			case <-timer.C:
+				host.recordWait(time.Since(startTime), true)
+				return nil, ErrBulkheadFull
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			}
+
+			host.recordWait(time.Since(startTime), false)
+
+			serviceStart := time.Now()
+
+			release := func() {
+				host.recordService(time.Since(serviceStart))
+				<-host.slots
+			}
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				release()
+				return nil, err
+			}
+
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+
+			return resp, nil
+		})
+	}
+}
+
+// Response body releasing the bulkhead slot once closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+
+	return err
+}
@@ -0,0 +1,89 @@
+package loadgen
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWithBulkhead(t *testing.T) {
+	bulkhead := NewBulkhead(BulkheadOptions{MaxInFlight: 1, QueueTimeout: 20 * time.Millisecond})
+
+	transport := WithBulkhead(bulkhead)(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/fail" {
+			return nil, errors.New("failed")
+		}
+
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	}))
+
+	roundTrip := func(url string) (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		return transport.RoundTrip(req)
+	}
+
+	resp, err := roundTrip("https://a/")
+	if err != nil {
+		t.Fatalf("RoundTrip() returned %v, expected nil", err)
+	}
+
+	// The slot is held until the body is closed
+	if _, err := roundTrip("https://a/"); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("RoundTrip() returned %v, expected %v", err, ErrBulkheadFull)
+	}
+
+	// Hosts have their own slots
+	if other, err := roundTrip("https://b/"); err != nil {
+		t.Errorf("RoundTrip() to another host returned %v, expected nil", err)
+	} else {
+		other.Body.Close()
+	}
+
+	resp.Body.Close()
+	resp.Body.Close()
+
+	// Failed round trips release their slot right away
+	if _, err := roundTrip("https://a/fail"); err == nil {
+		t.Error("RoundTrip() returned nil, expected the round trip error")
+	}
+
+	if resp, err := roundTrip("https://a/"); err != nil {
+		t.Errorf("RoundTrip() returned %v once the slot was released, expected nil", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	report := bulkhead.report()["a"]
+
+	if report.Rejected != 1 || report.ServiceTime.Count != 3 {
+		t.Errorf("report() returned %d rejected and %d served, expected 1 and 3", report.Rejected, report.ServiceTime.Count)
+	}
+}
+
+func TestBulkheadOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options BulkheadOptions
+		valid   bool
+	}{
+		{"disabled", BulkheadOptions{}, true},
+		{"enabled", BulkheadOptions{MaxInFlight: 10, QueueTimeout: time.Second}, true},
+		{"negative", BulkheadOptions{MaxInFlight: -1}, false},
+		{"no queue timeout", BulkheadOptions{MaxInFlight: 10}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.options.Validate()
+
+			if test.valid && err != nil {
+				t.Errorf("Validate() returned error [%v], expected none", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("Validate() returned no error, expected one")
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Chaos settings
+const (
+	ChaosCancelMaxDelay = 500 * time.Millisecond
+)
+
+// Faults injected by the client itself, to exercise how the server copes
+// with them under load
+type ChaosOptions struct {
+	// Share of the requests whose context is cancelled while in flight,
+	// from 0 (none) to 1 (all)
+	CancelRatio float64
+
+	// Cancellations happen at a random point within this delay of the send
+	CancelMaxDelay time.Duration
+}
+
+func DefaultChaosOptions() ChaosOptions {
+	return ChaosOptions{
+		CancelMaxDelay: ChaosCancelMaxDelay,
+	}
+}
+
+func (o *ChaosOptions) Validate() error {
+	if o.CancelRatio < 0 || o.CancelRatio > 1 {
+		return errors.New("chaos CancelRatio must be between 0 and 1")
+	}
+
+	if o.CancelRatio > 0 && o.CancelMaxDelay <= 0 {
+		return errors.New("chaos CancelMaxDelay must be positive")
+	}
+
+	return nil
+}
+
+// Cancellations scheduled and those which fired before the response was
+// complete
+type ChaosStats struct {
+	mutex     sync.Mutex
+	scheduled int64
+	fired     int64
+}
+
+func NewChaosStats() *ChaosStats {
+	return &ChaosStats{}
+}
+
+func (s *ChaosStats) recordScheduled() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.scheduled++
+}
+
+func (s *ChaosStats) recordFired() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.fired++
+}
+
+func (s *ChaosStats) report() *ChaosReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return &ChaosReport{
+		CancelScheduled: s.scheduled,
+		CancelFired:     s.fired,
+	}
+}
+
+// Returns a context cancelled at a random point for CancelRatio of the
+// requests. The returned function must be called once the request is done.
+func (t *LoadTest) withChaosCancel(ctx context.Context) (context.Context, context.CancelFunc) {
+	options := &t.options.Chaos
+
+	if t.chaosStats == nil || rand.Float64() >= options.CancelRatio {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	delay := time.Duration(rand.Int63n(int64(options.CancelMaxDelay)))
+
+	timer := time.AfterFunc(delay, func() {
+		t.chaosStats.recordFired()
+		cancel()
+	})
+
+	t.chaosStats.recordScheduled()
+
+	return ctx, func() {
+		timer.Stop()
+		cancel()
+	}
+}
@@ -0,0 +1,127 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+type DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+type DialTLSContext func(ctx context.Context, network, addr string, cfg *tls.Config) (*tls.Conn, error)
+
+// Response of a single request
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+
+	// Only available once the body has been fully read
+	Trailer http.Header
+
+	// Only set when Options.RecordChunkTimings is enabled
+	Timings *ChunkTimings
+
+	// Only set when the response was compressed
+	ContentEncoding string
+	CompressedBytes int
+	DecompressTime  time.Duration
+}
+
+// Returned with the response when the server answered with a status counted
+// as a failure, a 5xx or a 429
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server responded with status %d", e.StatusCode)
+}
+
+// Whether the status tells the server failed to serve the request, or
+// refused to because it is overloaded
+func failedStatus(code int) bool {
+	return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+}
+
+func newHTTPClient(options *Options, dialer *socketDialer, middlewares []Middleware) *http.Client {
+	return &http.Client{
+		Transport: Chain(newHTTPTransport(options, dialer), middlewares...),
+		Timeout:   options.ClientTimeout,
+	}
+}
+
+func newHTTPTransport(options *Options, dialer *socketDialer) http.RoundTripper {
+	httpTransport := &http.Transport{
+		Proxy:                  http.ProxyFromEnvironment,
+		DialContext:            dialer.DialContext,
+		TLSClientConfig:        newTLSClientConfig(options),
+		TLSHandshakeTimeout:    options.Transport.TLSHandshakeTimeout,
+		DisableKeepAlives:      options.Transport.DisableKeepAlives,
+		MaxIdleConns:           options.Transport.MaxIdleConns,
+		MaxIdleConnsPerHost:    options.Transport.MaxIdleConnsPerHost,
+		MaxConnsPerHost:        options.Transport.MaxConnsPerHost,
+		IdleConnTimeout:        options.Transport.IdleConnTimeout,
+		ResponseHeaderTimeout:  options.Transport.ResponseHeaderTimeout,
+		ExpectContinueTimeout:  options.Transport.ExpectContinueTimeout,
+		MaxResponseHeaderBytes: options.Transport.MaxResponseHeaderBytes,
+		WriteBufferSize:        options.Transport.WriteBufferSize,
+		ReadBufferSize:         options.Transport.ReadBufferSize,
+	}
+
+	// Handshakes can only be timed when the transport leaves them to us
+	if dialer.tls != nil {
+		httpTransport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialTLS(ctx, network, addr, httpTransport.TLSClientConfig)
+			if err != nil {
+				return nil, err
+			}
+
+			return conn, nil
+		}
+	}
+
+	//err := http2.ConfigureTransport(httpTransport)
+	//if err != nil {
+	//	panic(err)
+	//}
+
+	return httpTransport
+}
+
+func newHTTP2Client(options *Options, dialer *socketDialer, health *HTTP2Health, middlewares []Middleware) *http.Client {
+	return &http.Client{
+		Transport: Chain(newHTTP2Transport(options, dialer, health), middlewares...),
+		Timeout:   options.ClientTimeout,
+	}
+}
+
+func newHTTP2Transport(options *Options, dialer *socketDialer, health *HTTP2Health) *http2.Transport {
+	return &http2.Transport{
+		DialTLS:                    health.DialTLS(dialer.DialTLS),
+		TLSClientConfig:            newTLSClientConfig(options),
+		AllowHTTP:                  options.HTTP2Transport.AllowHTTP,
+		StrictMaxConcurrentStreams: options.HTTP2Transport.StrictMaxConcurrentStreams,
+		ReadIdleTimeout:            options.HTTP2Transport.ReadIdleTimeout,
+		PingTimeout:                options.HTTP2Transport.PingTimeout,
+	}
+}
+
+func newTLSClientConfig(options *Options) *tls.Config {
+	cfg := &tls.Config{
+		InsecureSkipVerify: options.InsecureSkipVerify,
+		MinVersion:         tlsVersions[options.TLS.MinVersion],
+		MaxVersion:         tlsVersions[options.TLS.MaxVersion],
+	}
+
+	if options.TLS.SessionResumption {
+		cfg.ClientSessionCache = tls.NewLRUClientSessionCache(options.TLS.SessionCacheSize)
+	}
+
+	return cfg
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package loadgen
+
+import (
+	"syscall"
+	"time"
+)
+
+// User and system CPU time consumed by the process so far
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
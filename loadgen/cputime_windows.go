@@ -0,0 +1,27 @@
+package loadgen
+
+import (
+	"syscall"
+	"time"
+)
+
+// User and kernel CPU time consumed by the process so far
+func processCPUTime() time.Duration {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0
+	}
+
+	var creation, exit, kernel, user syscall.Filetime
+
+	if err := syscall.GetProcessTimes(process, &creation, &exit, &kernel, &user); err != nil {
+		return 0
+	}
+
+	return filetimeDuration(kernel) + filetimeDuration(user)
+}
+
+// Filetimes count 100-nanosecond intervals
+func filetimeDuration(ft syscall.Filetime) time.Duration {
+	return time.Duration(int64(ft.HighDateTime)<<32|int64(ft.LowDateTime)) * 100
+}
@@ -0,0 +1,99 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header carrying the time left before the request deadline, in
+// milliseconds, so the server can give up when the client already has
+const DeadlineHeader = "X-Request-Deadline"
+
+// What terminated a failed request
+const (
+	// http.Client.Timeout, covering the whole exchange including the body
+	TerminatedByClientTimeout = "client_timeout"
+
+	// Deadline of the request context: RequestTimeout or adaptive timeout
+	TerminatedByContextDeadline = "context_deadline"
+
+	// Cancellation of the request context, by chaos, the fan-in of a
+	// scenario step or the end of the run
+	TerminatedByCancel = "cancelled"
+
+	// Transport or dialer timeouts, e.g. ResponseHeaderTimeout
+	TerminatedByTransportTimeout = "transport_timeout"
+
+	// Panic in the load generator itself
+	TerminatedByPanic = "panic"
+
+	// Any other error or an unexpected response
+	TerminatedByError = "error"
+)
+
+// Returns a context carrying the per-request deadline, if any
+func (t *LoadTest) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.options.RequestTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, t.options.RequestTimeout)
+}
+
+// Finds which timeout mechanism, if any, terminated the request sent with
+// ctx, which must not have been cancelled yet
+func terminationCause(ctx context.Context, err error) string {
+	if errors.Is(err, errPanic) {
+		return TerminatedByPanic
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return TerminatedByContextDeadline
+	}
+
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return TerminatedByCancel
+	}
+
+	// net/http only tells the client timeout apart in the error message
+	if strings.Contains(err.Error(), "Client.Timeout exceeded") {
+		return TerminatedByClientTimeout
+	}
+
+	var netErr net.Error
+
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return TerminatedByTransportTimeout
+	}
+
+	return TerminatedByError
+}
+
+// Tells the server how long it has left through the deadline header, when
+// the request context has a deadline
+func WithDeadlineHeader() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			deadline, ok := req.Context().Deadline()
+			if !ok {
+				return next.RoundTrip(req)
+			}
+
+			// Relative, so clock skew between client and server does not matter
+			remaining := time.Until(deadline) / time.Millisecond
+			if remaining < 1 {
+				remaining = 1
+			}
+
+			req = req.Clone(req.Context())
+			req.Header.Set(DeadlineHeader, strconv.FormatInt(int64(remaining), 10))
+
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package loadgen
+
+import (
+	"context"
+	"time"
+)
+
+// Shutdown settings
+const (
+	DrainTimeout = 5 * time.Second
+)
+
+// Context of the requests of a run, outliving ctx by up to timeout so the
+// requests in flight when the run is stopped can complete
+func drainContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	drained, cancel := context.WithCancel(detachedContext{ctx})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-drained.Done():
+			return
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			cancel()
+		case <-drained.Done():
+		}
+	}()
+
+	return drained, cancel
+}
+
+// Context keeping the values of its parent but not its cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// Whether the run was asked to stop scheduling new requests
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,52 @@
+package loadgen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func validateAcceptEncoding(encoding string) error {
+	switch encoding {
+	case "", "gzip", "deflate", "br":
+		return nil
+	default:
+		return fmt.Errorf("unsupported encoding [%s], expected gzip, deflate or br", encoding)
+	}
+}
+
+// Decompresses the body, returning the time it took
+func decodeBody(encoding string, body []byte) ([]byte, time.Duration, error) {
+	startTime := time.Now()
+
+	var reader io.Reader
+	var err error
+
+	switch encoding {
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	case "br":
+		reader = brotli.NewReader(bytes.NewReader(body))
+	default:
+		return nil, 0, fmt.Errorf("unsupported Content-Encoding [%s]", encoding)
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	decoded, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return decoded, time.Since(startTime), nil
+}
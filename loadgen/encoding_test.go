@@ -0,0 +1,62 @@
+package loadgen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestValidateAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		encoding string
+		valid    bool
+	}{
+		{"", true},
+		{"gzip", true},
+		{"deflate", true},
+		{"br", true},
+		{"zstd", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.encoding, func(t *testing.T) {
+			if err := validateAcceptEncoding(test.encoding); (err == nil) != test.valid {
+				t.Errorf("validateAcceptEncoding() returned error [%v], expected valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	tests := []struct {
+		encoding  string
+		newWriter func(w io.Writer) io.WriteCloser
+	}{
+		{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{"deflate", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+		{"br", func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.encoding, func(t *testing.T) {
+			var compressed bytes.Buffer
+
+			writer := test.newWriter(&compressed)
+			writer.Write([]byte("compressed body"))
+			writer.Close()
+
+			body, _, err := decodeBody(test.encoding, compressed.Bytes())
+			if err != nil {
+				t.Fatalf("decodeBody() returned error [%v], expected none", err)
+			}
+
+			if string(body) != "compressed body" {
+				t.Errorf("decodeBody() returned [%s], expected [compressed body]", body)
+			}
+		})
+	}
+}
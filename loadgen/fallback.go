@@ -0,0 +1,167 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// When requests fail over to the fallback target
+const (
+	// Every request failing on the primary target, like the circuit breaker
+	// counts failures
+	FallbackOnFailure = "failure"
+
+	// Requests rejected by the open circuit breaker
+	FallbackOnOpenCircuit = "open-circuit"
+)
+
+// Secondary backend, simulating clients of replicated services
+type FallbackOptions struct {
+	// Empty disables the fallback
+	BaseURL string
+	Mode    string
+}
+
+func DefaultFallbackOptions() FallbackOptions {
+	return FallbackOptions{
+		Mode: FallbackOnFailure,
+	}
+}
+
+func (o *Options) validateFallback() error {
+	if o.Fallback.BaseURL == "" {
+		return nil
+	}
+
+	switch o.Fallback.Mode {
+	case FallbackOnFailure:
+	case FallbackOnOpenCircuit:
+		if !o.CircuitBreaker.Enabled {
+			return errors.New("falling back on open circuit requires the circuit breaker")
+		}
+	default:
+		return fmt.Errorf("unknown fallback mode [%s]", o.Fallback.Mode)
+	}
+
+	if o.Range.Enabled {
+		return errors.New("Range can not be combined with a fallback")
+	}
+
+	return nil
+}
+
+// Requests served by each target
+type FallbackStats struct {
+	mutex            sync.Mutex
+	primary          int64
+	fallback         int64
+	fallbackFailures int64
+}
+
+func NewFallbackStats() *FallbackStats {
+	return &FallbackStats{}
+}
+
+func (s *FallbackStats) record(fallback bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !fallback {
+		s.primary++
+		return
+	}
+
+	s.fallback++
+
+	if err != nil {
+		s.fallbackFailures++
+	}
+}
+
+func (s *FallbackStats) report(options *FallbackOptions) *FallbackReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	report := &FallbackReport{
+		BaseURL:          options.BaseURL,
+		Mode:             options.Mode,
+		Primary:          s.primary,
+		Fallback:         s.fallback,
+		FallbackFailures: s.fallbackFailures,
+	}
+
+	if total := s.primary + s.fallback; total > 0 {
+		report.FallbackShare = float64(s.fallback) / float64(total)
+	}
+
+	return report
+}
+
+// Sends requests to the primary target, failing over to the fallback one
+type fallbackTarget struct {
+	primary  Target
+	fallback Target
+	mode     string
+	stats    *FallbackStats
+}
+
+// Builds the fallback from a copy of the load test pointing to the fallback
+// base URL, without the circuit breaker guarding the primary target
+func newFallbackTarget(t *LoadTest, primary Target) (Target, error) {
+	options := *t.options
+	options.BaseURL = t.options.Fallback.BaseURL
+	options.Fallback.BaseURL = ""
+
+	loadTest := *t
+	loadTest.options = &options
+	loadTest.circuitBreaker = nil
+
+	fallback, err := newTarget(&loadTest)
+	if err != nil {
+		primary.Close()
+		return nil, err
+	}
+
+	return &fallbackTarget{
+		primary:  primary,
+		fallback: fallback,
+		mode:     t.options.Fallback.Mode,
+		stats:    t.fallbackStats,
+	}, nil
+}
+
+func (t *fallbackTarget) Do(ctx context.Context, resource string) (*Response, error) {
+	response, err := t.primary.Do(ctx, resource)
+
+	if !t.failOver(ctx, response, err) {
+		t.stats.record(false, err)
+		return response, err
+	}
+
+	response, err = t.fallback.Do(ctx, resource)
+
+	t.stats.record(true, err)
+
+	return response, err
+}
+
+func (t *fallbackTarget) failOver(ctx context.Context, response *Response, err error) bool {
+	failed := err != nil || (response != nil && failedStatus(response.StatusCode))
+
+	if !failed || ctx.Err() != nil {
+		return false
+	}
+
+	if t.mode == FallbackOnOpenCircuit {
+		return errors.Is(err, ErrCircuitOpen)
+	}
+
+	return true
+}
+
+func (t *fallbackTarget) Close() error {
+	t.fallback.Close()
+	return t.primary.Close()
+}
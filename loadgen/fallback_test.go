@@ -0,0 +1,59 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Target answering every request with the status, or failing when it is 0
+func statusTarget(statusCode int) Target {
+	return targetFunc(func(ctx context.Context, resource string) (*Response, error) {
+		if statusCode == 0 {
+			return nil, errors.New("failed")
+		}
+
+		return &Response{StatusCode: statusCode}, nil
+	})
+}
+
+func TestFallbackTargetDo(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		primary    Target
+		statusCode int
+		fallback   int64
+	}{
+		{"primary succeeded", FallbackOnFailure, statusTarget(200), 200, 0},
+		{"primary not found", FallbackOnFailure, statusTarget(404), 404, 0},
+		{"primary failed", FallbackOnFailure, statusTarget(0), 200, 1},
+		{"primary server error", FallbackOnFailure, statusTarget(503), 200, 1},
+		{"primary overloaded", FallbackOnFailure, statusTarget(429), 200, 1},
+		{"open circuit", FallbackOnOpenCircuit, targetFunc(func(ctx context.Context, resource string) (*Response, error) {
+			return nil, ErrCircuitOpen
+		}), 200, 1},
+		{"server error with circuit closed", FallbackOnOpenCircuit, statusTarget(503), 503, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := &fallbackTarget{
+				primary:  test.primary,
+				fallback: statusTarget(200),
+				mode:     test.mode,
+				stats:    NewFallbackStats(),
+			}
+
+			response, _ := target.Do(context.Background(), "/")
+
+			if response == nil || response.StatusCode != test.statusCode {
+				t.Errorf("Do() returned response %+v, expected status %d", response, test.statusCode)
+			}
+
+			if report := target.stats.report(&FallbackOptions{}); report.Fallback != test.fallback {
+				t.Errorf("Do() fell back %d times, expected %d", report.Fallback, test.fallback)
+			}
+		})
+	}
+}
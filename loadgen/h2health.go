@@ -0,0 +1,270 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+)
+
+// HTTP2 frame types observed on the wire
+const (
+	frameRSTStream = 0x3
+	framePing      = 0x6
+	frameGoAway    = 0x7
+
+	flagPingAck = 0x1
+
+	frameHeaderLen = 9
+)
+
+// Connection-level HTTP/2 events
+type HTTP2Health struct {
+	mutex sync.Mutex
+
+	connections  int64
+	pingsSent    int64
+	pingRTTs     []time.Duration
+	goAways      int64
+	streamResets map[http2.ErrCode]int64
+}
+
+func NewHTTP2Health() *HTTP2Health {
+	return &HTTP2Health{
+		streamResets: make(map[http2.ErrCode]int64),
+	}
+}
+
+// Returns a DialTLS function whose connections report their frames
+func (h *HTTP2Health) DialTLS(dialTLS DialTLSContext) func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+	return func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+		conn, err := dialTLS(context.Background(), network, addr, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		h.mutex.Lock()
+		h.connections++
+		h.mutex.Unlock()
+
+		return newObservedConn(conn, h), nil
+	}
+}
+
+func (h *HTTP2Health) report() *HTTP2Report {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	report := &HTTP2Report{
+		Connections:  h.connections,
+		PingsSent:    h.pingsSent,
+		PingRTT:      newPercentiles(h.pingRTTs),
+		GoAways:      h.goAways,
+		StreamResets: make(map[string]int64, len(h.streamResets)),
+	}
+
+	for code, count := range h.streamResets {
+		report.StreamResets[code.String()] = count
+	}
+
+	return report
+}
+
+// TLS connection parsing the HTTP/2 frame headers flowing in both directions
+type observedConn struct {
+	*tls.Conn
+
+	health *HTTP2Health
+	logger *log.Entry
+
+	reader *frameParser
+	writer *frameParser
+
+	mutex sync.Mutex
+	pings map[[8]byte]time.Time
+}
+
+func newObservedConn(conn *tls.Conn, health *HTTP2Health) *observedConn {
+	c := &observedConn{
+		Conn:   conn,
+		health: health,
+		logger: log.WithFields(log.Fields{"conn": conn.LocalAddr().String()}),
+		pings:  make(map[[8]byte]time.Time),
+	}
+
+	c.reader = &frameParser{onFrame: c.onFrameRead}
+
+	// The client starts with the connection preface, not a frame
+	c.writer = &frameParser{skip: len(http2.ClientPreface), onFrame: c.onFrameWritten}
+
+	return c
+}
+
+func (c *observedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.reader.feed(p[:n])
+	return n, err
+}
+
+func (c *observedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.writer.feed(p[:n])
+	return n, err
+}
+
+func (c *observedConn) onFrameWritten(frameType, flags byte, streamID uint32, payload []byte) {
+	if frameType != framePing || flags&flagPingAck != 0 || len(payload) < 8 {
+		return
+	}
+
+	var data [8]byte
+	copy(data[:], payload)
+
+	c.mutex.Lock()
+	c.pings[data] = time.Now()
+	c.mutex.Unlock()
+
+	c.health.mutex.Lock()
+	c.health.pingsSent++
+	c.health.mutex.Unlock()
+}
+
+func (c *observedConn) onFrameRead(frameType, flags byte, streamID uint32, payload []byte) {
+	switch frameType {
+	case framePing:
+		if flags&flagPingAck == 0 || len(payload) < 8 {
+			return
+		}
+
+		var data [8]byte
+		copy(data[:], payload)
+
+		c.mutex.Lock()
+		sent, ok := c.pings[data]
+		delete(c.pings, data)
+		c.mutex.Unlock()
+
+		if !ok {
+			return
+		}
+
+		rtt := time.Since(sent)
+
+		c.health.mutex.Lock()
+		c.health.pingRTTs = append(c.health.pingRTTs, rtt)
+		c.health.mutex.Unlock()
+
+		c.logger.WithFields(log.Fields{"RTT": rtt}).Debug("PING acknowledged")
+
+	case frameGoAway:
+		if len(payload) < 8 {
+			return
+		}
+
+		lastStreamID := binary.BigEndian.Uint32(payload[0:4]) & (1<<31 - 1)
+		code := http2.ErrCode(binary.BigEndian.Uint32(payload[4:8]))
+
+		c.health.mutex.Lock()
+		c.health.goAways++
+		c.health.mutex.Unlock()
+
+		c.logger.WithFields(log.Fields{
+			"LastStreamID": lastStreamID,
+			"ErrCode":      code,
+		}).Warn("GOAWAY received")
+
+	case frameRSTStream:
+		if len(payload) < 4 {
+			return
+		}
+
+		code := http2.ErrCode(binary.BigEndian.Uint32(payload[0:4]))
+
+		c.health.mutex.Lock()
+		c.health.streamResets[code]++
+		c.health.mutex.Unlock()
+
+		c.logger.WithFields(log.Fields{
+			"StreamID": streamID,
+			"ErrCode":  code,
+		}).Warn("RST_STREAM received")
+	}
+}
+
+// Incremental parser of a stream of HTTP/2 frames, only keeping the first
+// bytes of each payload
+type frameParser struct {
+	onFrame func(frameType, flags byte, streamID uint32, payload []byte)
+
+	// Bytes to ignore before the first frame
+	skip int
+
+	header    [frameHeaderLen]byte
+	headerLen int
+
+	// Payload bytes of the current frame still to be consumed
+	remaining int
+	payload   []byte
+}
+
+func (p *frameParser) feed(data []byte) {
+	for len(data) > 0 {
+		if p.skip > 0 {
+			n := min(p.skip, len(data))
+			p.skip -= n
+			data = data[n:]
+			continue
+		}
+
+		if p.headerLen < frameHeaderLen {
+			n := copy(p.header[p.headerLen:], data)
+			p.headerLen += n
+			data = data[n:]
+
+			if p.headerLen == frameHeaderLen {
+				p.remaining = int(p.header[0])<<16 | int(p.header[1])<<8 | int(p.header[2])
+				p.payload = p.payload[:0]
+
+				if p.remaining == 0 {
+					p.emit()
+				}
+			}
+
+			continue
+		}
+
+		n := min(p.remaining, len(data))
+
+		if keep := min(8-len(p.payload), n); keep > 0 {
+			p.payload = append(p.payload, data[:keep]...)
+		}
+
+		p.remaining -= n
+		data = data[n:]
+
+		if p.remaining == 0 {
+			p.emit()
+		}
+	}
+}
+
+func (p *frameParser) emit() {
+	streamID := binary.BigEndian.Uint32(p.header[5:9]) & (1<<31 - 1)
+
+	p.onFrame(p.header[3], p.header[4], streamID, p.payload)
+
+	p.headerLen = 0
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,204 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Hedging settings
+const (
+	HedgeDelay      = 50 * time.Millisecond
+	HedgePercentile = 95
+	HedgeWindowSize = 1000
+
+	// Samples required before the percentile replaces the static delay
+	HedgeMinSamples = 100
+)
+
+// Sends a backup request on a separate transport when the first one has not
+// responded within the hedging delay, keeping whichever responds first
+type HedgeOptions struct {
+	Enabled bool
+
+	// Static delay, used until MinSamples latencies were observed or when
+	// Percentile is 0
+	Delay time.Duration
+
+	// Percentile of recent latencies used as delay, e.g. 95
+	Percentile float64
+	WindowSize int
+	MinSamples int
+}
+
+func DefaultHedgeOptions() HedgeOptions {
+	return HedgeOptions{
+		Delay:      HedgeDelay,
+		Percentile: HedgePercentile,
+		WindowSize: HedgeWindowSize,
+		MinSamples: HedgeMinSamples,
+	}
+}
+
+func (o *HedgeOptions) Validate() error {
+	if !o.Enabled {
+		return nil
+	}
+
+	if o.Delay <= 0 {
+		return errors.New("hedging Delay must be positive")
+	}
+
+	if o.Percentile < 0 || o.Percentile >= 100 {
+		return errors.New("hedging Percentile must be between 0 and 100")
+	}
+
+	if o.MinSamples < 1 || o.WindowSize < o.MinSamples {
+		return errors.New("hedging WindowSize must be at least MinSamples")
+	}
+
+	return nil
+}
+
+// Hedging delay computed from a sliding window of observed latencies
+type Hedger struct {
+	mutex   sync.Mutex
+	options HedgeOptions
+
+	window       []time.Duration
+	next         int
+	current      time.Duration
+	observations int64
+
+	hedged     int64
+	hedgeWon   int64
+	primaryWon int64
+	bothFailed int64
+}
+
+func NewHedger(options HedgeOptions) *Hedger {
+	return &Hedger{
+		options: options,
+		window:  make([]time.Duration, 0, options.WindowSize),
+		current: options.Delay,
+	}
+}
+
+func (h *Hedger) Delay() time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.current
+}
+
+// Outcome of one of the attempts of a hedged request
+type hedgeAttempt struct {
+	response *Response
+	err      error
+	elapsed  time.Duration
+	hedge    bool
+}
+
+// Sends the request, and a hedge on the hedge target once the hedging delay
+// elapsed. The first success wins and the other attempt is cancelled.
+// Failures before the delay are returned as is, retrying is not hedging.
+func (h *Hedger) Do(ctx context.Context, spawn spawner, primary, hedge Target, resource string) (*Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered so the cancelled loser does not block
+	attempts := make(chan hedgeAttempt, 2)
+
+	// A panic fails the attempt like any error
+	send := func(target Target, isHedge bool) {
+		startTime := time.Now()
+
+		spawn(func() {
+			response, err := target.Do(ctx, resource)
+			attempts <- hedgeAttempt{response: response, err: err, elapsed: time.Since(startTime), hedge: isHedge}
+		}, func(err error) {
+			attempts <- hedgeAttempt{err: err, elapsed: time.Since(startTime), hedge: isHedge}
+		})
+	}
+
+	send(primary, false)
+
+	timer := time.NewTimer(h.Delay())
+	defer timer.Stop()
+
+	inFlight := 1
+	hedged := false
+
+	for {
+		select {
+		case <-timer.C:
+			hedged = true
+			inFlight++
+
+			send(hedge, true)
+
+		case attempt := <-attempts:
+			inFlight--
+
+			if attempt.err == nil || inFlight == 0 {
+				h.record(hedged, attempt)
+				return attempt.response, attempt.err
+			}
+		}
+	}
+}
+
+func (h *Hedger) record(hedged bool, winner hedgeAttempt) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if hedged {
+		h.hedged++
+
+		switch {
+		case winner.err != nil:
+			h.bothFailed++
+		case winner.hedge:
+			h.hedgeWon++
+		default:
+			h.primaryWon++
+		}
+	}
+
+	// Only the primary latency tells how slow requests are without hedging
+	if winner.err != nil || winner.hedge || h.options.Percentile == 0 {
+		return
+	}
+
+	if len(h.window) < cap(h.window) {
+		h.window = append(h.window, winner.elapsed)
+	} else {
+		h.window[h.next] = winner.elapsed
+		h.next = (h.next + 1) % len(h.window)
+	}
+
+	h.observations++
+
+	if len(h.window) >= h.options.MinSamples && h.observations%int64(h.options.MinSamples) == 0 {
+		sorted := make([]time.Duration, len(h.window))
+		copy(sorted, h.window)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		h.current = percentile(sorted, h.options.Percentile)
+	}
+}
+
+func (h *Hedger) report() *HedgeReport {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return &HedgeReport{
+		FinalDelay: h.current,
+		Hedged:     h.hedged,
+		HedgeWon:   h.hedgeWon,
+		PrimaryWon: h.primaryWon,
+		BothFailed: h.bothFailed,
+	}
+}
@@ -0,0 +1,121 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Target answering every request through a function
+type targetFunc func(ctx context.Context, resource string) (*Response, error)
+
+func (f targetFunc) Do(ctx context.Context, resource string) (*Response, error) {
+	return f(ctx, resource)
+}
+
+func (f targetFunc) Close() error {
+	return nil
+}
+
+// Target answering with the body after the delay, or failing when the body
+// is empty
+func delayedTarget(delay time.Duration, body string) Target {
+	return targetFunc(func(ctx context.Context, resource string) (*Response, error) {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if body == "" {
+			return nil, errors.New("failed")
+		}
+
+		return &Response{StatusCode: 200, Body: body}, nil
+	})
+}
+
+// Target panicking on every request
+var panickingTarget = targetFunc(func(ctx context.Context, resource string) (*Response, error) {
+	panic("bug")
+})
+
+func testHedgeOptions() HedgeOptions {
+	options := DefaultHedgeOptions()
+	options.Enabled = true
+	options.Delay = 20 * time.Millisecond
+	options.Percentile = 0
+
+	return options
+}
+
+func TestHedgerDo(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary Target
+		hedge   Target
+		body    string
+		err     bool
+		report  HedgeReport
+	}{
+		{"primary before delay", delayedTarget(0, "primary"), delayedTarget(0, "hedge"), "primary", false, HedgeReport{}},
+		{"primary failed before delay", delayedTarget(0, ""), delayedTarget(0, "hedge"), "", true, HedgeReport{}},
+		{"hedge won", delayedTarget(time.Second, "primary"), delayedTarget(0, "hedge"), "hedge", false, HedgeReport{Hedged: 1, HedgeWon: 1}},
+		{"primary won", delayedTarget(40*time.Millisecond, "primary"), delayedTarget(time.Second, "hedge"), "primary", false, HedgeReport{Hedged: 1, PrimaryWon: 1}},
+		{"hedge failed", delayedTarget(40*time.Millisecond, "primary"), delayedTarget(0, ""), "primary", false, HedgeReport{Hedged: 1, PrimaryWon: 1}},
+		{"both failed", delayedTarget(40*time.Millisecond, ""), delayedTarget(0, ""), "", true, HedgeReport{Hedged: 1, BothFailed: 1}},
+		{"primary panicked", panickingTarget, delayedTarget(0, "hedge"), "", true, HedgeReport{}},
+		{"hedge panicked", delayedTarget(40*time.Millisecond, "primary"), panickingTarget, "primary", false, HedgeReport{Hedged: 1, PrimaryWon: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hedger := NewHedger(testHedgeOptions())
+			loadTest := &LoadTest{stats: NewStats()}
+
+			response, err := hedger.Do(context.Background(), loadTest.safeGo(log.NewEntry(log.StandardLogger())), test.primary, test.hedge, "/")
+
+			if (err != nil) != test.err {
+				t.Errorf("Do() returned %v, expected error %v", err, test.err)
+			}
+
+			if err == nil && response.Body != test.body {
+				t.Errorf("Do() returned %s, expected %s", response.Body, test.body)
+			}
+
+			report := hedger.report()
+			report.FinalDelay = 0
+
+			if *report != test.report {
+				t.Errorf("report() returned %+v, expected %+v", *report, test.report)
+			}
+		})
+	}
+}
+
+func TestHedgerDelay(t *testing.T) {
+	options := testHedgeOptions()
+	options.Percentile = 50
+	options.WindowSize = 4
+	options.MinSamples = 2
+
+	hedger := NewHedger(options)
+
+	hedger.record(false, hedgeAttempt{elapsed: 4 * time.Millisecond})
+
+	if delay := hedger.Delay(); delay != options.Delay {
+		t.Errorf("Delay() returned %v under MinSamples, expected %v", delay, options.Delay)
+	}
+
+	// Failures and hedges say nothing about the primary latency
+	hedger.record(true, hedgeAttempt{elapsed: time.Second, hedge: true})
+	hedger.record(false, hedgeAttempt{elapsed: time.Second, err: errors.New("failed")})
+	hedger.record(false, hedgeAttempt{elapsed: 4 * time.Millisecond})
+
+	if delay := hedger.Delay(); delay != 4*time.Millisecond {
+		t.Errorf("Delay() returned %v, expected 4ms", delay)
+	}
+}
@@ -0,0 +1,173 @@
+package loadgen
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TCP keep-alive experiment: users hold their connections idle between
+// requests while the server drops idle connections, to see how long dead
+// connections linger and who notices first
+type KeepAliveOptions struct {
+	Enabled bool
+
+	// Pause of closed-loop users between requests, holding their
+	// connection idle (0 sends back to back)
+	IdleHold time.Duration
+}
+
+// Dead connections and the requests which ran into them
+type KeepAliveStats struct {
+	mutex       sync.Mutex
+	connections int64
+	dead        map[string]int64
+	lingers     []time.Duration
+
+	noticedByRequest int64
+	noticedWhileIdle int64
+
+	staleRequests int64
+	staleIdleTime []time.Duration
+}
+
+func NewKeepAliveStats() *KeepAliveStats {
+	return &KeepAliveStats{
+		dead: make(map[string]int64),
+	}
+}
+
+// Wraps a dialed connection to detect when it dies
+func (s *KeepAliveStats) track(conn net.Conn) net.Conn {
+	s.mutex.Lock()
+	s.connections++
+	s.mutex.Unlock()
+
+	return &keepAliveConn{
+		Conn:         conn,
+		stats:        s,
+		lastActivity: time.Now(),
+	}
+}
+
+func (s *KeepAliveStats) recordDead(err error, linger time.Duration, inFlight bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.dead[deadConnReason(err)]++
+	s.lingers = append(s.lingers, linger)
+
+	if inFlight {
+		s.noticedByRequest++
+	} else {
+		s.noticedWhileIdle++
+	}
+}
+
+// Requests failing on a reused connection most likely ran into a dead one
+func (s *KeepAliveStats) recordRequest(info httptrace.GotConnInfo, err error) {
+	if err == nil || !info.Reused {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.staleRequests++
+	s.staleIdleTime = append(s.staleIdleTime, info.IdleTime)
+}
+
+func (s *KeepAliveStats) report(options *Options) *KeepAliveReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	report := &KeepAliveReport{
+		Interval:         options.Dialer.KeepAlive,
+		IdleHold:         options.KeepAlive.IdleHold,
+		Connections:      s.connections,
+		Dead:             make(map[string]int64, len(s.dead)),
+		NoticedByRequest: s.noticedByRequest,
+		NoticedWhileIdle: s.noticedWhileIdle,
+		Linger:           newPercentiles(s.lingers),
+		StaleRequests:    s.staleRequests,
+		StaleIdleTime:    newPercentiles(s.staleIdleTime),
+	}
+
+	for reason, count := range s.dead {
+		report.Dead[reason] = count
+	}
+
+	return report
+}
+
+func deadConnReason(err error) string {
+	switch {
+	case errors.Is(err, io.EOF):
+		return "eof"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "reset"
+	case errors.Is(err, syscall.ETIMEDOUT):
+		// Unanswered keep-alive probes
+		return "timeout"
+	default:
+		return "other"
+	}
+}
+
+// Connection recording its last activity and the first error which is not
+// caused by a deadline or by closing it locally
+type keepAliveConn struct {
+	net.Conn
+	stats *KeepAliveStats
+
+	mutex        sync.Mutex
+	lastActivity time.Time
+	inFlight     bool
+	closed       bool
+	dead         bool
+}
+
+func (c *keepAliveConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.observe(n > 0, false, err)
+
+	return n, err
+}
+
+func (c *keepAliveConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.observe(n > 0, true, err)
+
+	return n, err
+}
+
+func (c *keepAliveConn) Close() error {
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+
+	return c.Conn.Close()
+}
+
+// A write starts a request, reading its response ends it
+func (c *keepAliveConn) observe(active, write bool, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if active {
+		c.lastActivity = time.Now()
+		c.inFlight = write
+	}
+
+	if err == nil || c.closed || c.dead || errors.Is(err, os.ErrDeadlineExceeded) {
+		return
+	}
+
+	c.dead = true
+	c.stats.recordDead(err, time.Since(c.lastActivity), c.inFlight)
+}
@@ -0,0 +1,245 @@
+// Package loadgen drives load against the PoC server, either from the
+// cmd/client binary or programmatically from Go tests:
+//
+//	report, err := loadgen.Run(ctx, loadgen.Scenario{}, loadgen.DefaultOptions())
+package loadgen
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Runs a load test until all requests were executed or ctx is done. Once
+// ctx is done no new request is sent and the ones in flight get up to
+// Options.DrainTimeout to complete, the report covering the partial run.
+// An empty scenario sends single requests to Options.RequestPath.
+func Run(ctx context.Context, scenario Scenario, options Options) (Report, error) {
+	if err := options.Validate(); err != nil {
+		return Report{}, err
+	}
+
+	loadTest := &LoadTest{
+		options: &options,
+		stats:   NewStats(),
+	}
+
+	if len(scenario.Steps) > 0 {
+		if err := scenario.Validate(); err != nil {
+			return Report{}, err
+		}
+
+		loadTest.scenario = &scenario
+		loadTest.scenarioStats = NewScenarioStats()
+	}
+
+	if options.Socket.enabled() {
+		loadTest.socketStats = NewSocketStats()
+	}
+
+	if options.KeepAlive.Enabled {
+		loadTest.keepAliveStats = NewKeepAliveStats()
+	}
+
+	if options.TLS.RecordHandshakes {
+		loadTest.tlsStats = NewTLSStats()
+	}
+
+	loadTest.dialer = newSocketDialer(&options, loadTest.socketStats, loadTest.keepAliveStats, loadTest.tlsStats)
+
+	if options.TracePool {
+		loadTest.dialer.pool = NewPoolStats()
+	}
+
+	if options.HTTP2 {
+		loadTest.http2Health = NewHTTP2Health()
+	}
+
+	if options.Retry.Enabled {
+		loadTest.retryStats = NewRetryStats()
+	}
+
+	// Shared by all transports
+	if options.Retry.Enabled && options.Retry.Budget > 0 {
+		loadTest.retryBudget = NewRetryBudget(options.Retry)
+	}
+
+	if options.Bulkhead.MaxInFlight > 0 {
+		loadTest.bulkhead = NewBulkhead(options.Bulkhead)
+	}
+
+	if options.Fallback.BaseURL != "" {
+		loadTest.fallbackStats = NewFallbackStats()
+	}
+
+	if options.Chaos.CancelRatio > 0 {
+		loadTest.chaosStats = NewChaosStats()
+	}
+
+	if options.Hedge.Enabled {
+		loadTest.hedger = NewHedger(options.Hedge)
+	}
+
+	if options.CircuitBreaker.Enabled {
+		loadTest.circuitBreaker = NewCircuitBreaker(options.CircuitBreaker)
+	}
+
+	if options.AdaptiveTimeout.Enabled {
+		loadTest.adaptiveTimeout = NewAdaptiveTimeout(options.AdaptiveTimeout, options.ClientTimeout)
+	}
+
+	if options.Range.Enabled {
+		loadTest.rangeStats = &RangeStats{}
+	}
+
+	// Users share the load test state, and the target unless each of them
+	// gets its own transport
+	workers := make([]*LoadTest, options.Users)
+
+	for user := range workers {
+		if user > 0 && !options.PerWorkerTransport {
+			workers[user] = workers[0]
+			continue
+		}
+
+		target, err := newTarget(loadTest)
+		if err != nil {
+			return Report{}, err
+		}
+
+		defer target.Close()
+
+		workers[user] = loadTest.withTarget(target)
+		loadTest.transports++
+
+		if options.Hedge.Enabled {
+			hedgeTarget, err := newTarget(loadTest)
+			if err != nil {
+				return Report{}, err
+			}
+
+			defer hedgeTarget.Close()
+
+			workers[user].hedgeTarget = hedgeTarget
+			loadTest.transports++
+		}
+	}
+
+	if len(options.Sinks) > 0 {
+		loadTest.stats.pipeline = newPipeline(options.Sinks)
+	}
+
+	var ticks <-chan time.Time
+
+	if options.Rate > 0 {
+		ticks = schedule(ctx, options.Rate, options.Users*options.RequestsPerUser, options.Users)
+	}
+
+	requestCtx, cancelRequests := drainContext(ctx, options.DrainTimeout)
+	defer cancelRequests()
+
+	var waitGroup sync.WaitGroup
+
+	for user := 0; user < options.Users; user++ {
+		waitGroup.Add(1)
+
+		contextLogger := log.WithFields(log.Fields{
+			"user": user,
+		})
+
+		go func(worker *LoadTest, logger *log.Entry) {
+			defer waitGroup.Done()
+
+			if ticks != nil {
+				worker.runOpenLoop(requestCtx, ctx.Done(), logger, ticks)
+			} else {
+				worker.runClosedLoop(requestCtx, ctx.Done(), logger)
+			}
+
+			logger.Print("All requests executed")
+		}(workers[user], contextLogger)
+	}
+
+	waitGroup.Wait()
+
+	if loadTest.stats.pipeline != nil {
+		loadTest.stats.pipeline.close()
+	}
+
+	report := loadTest.report()
+	report.Interrupted = ctx.Err() != nil
+
+	return *report, nil
+}
+
+// Builds the report of all enabled features
+func (t *LoadTest) report() *Report {
+	report := t.stats.report()
+
+	report.Transports = t.transports
+	report.Connections = t.dialer.connections()
+
+	if t.adaptiveTimeout != nil {
+		report.AdaptiveTimeout = t.adaptiveTimeout.report()
+	}
+
+	if t.rangeStats != nil {
+		report.Range = t.rangeStats.report()
+	}
+
+	if t.http2Health != nil {
+		report.HTTP2 = t.http2Health.report()
+	}
+
+	if t.scenarioStats != nil {
+		report.Scenario = t.scenarioStats.report()
+	}
+
+	if t.socketStats != nil {
+		report.Socket = t.socketStats.report()
+	}
+
+	if t.stats.pipeline != nil {
+		report.Sinks = t.stats.pipeline.report()
+	}
+
+	if t.dialer.pool != nil {
+		report.Pool = t.dialer.pool.report()
+	}
+
+	if t.chaosStats != nil {
+		report.Chaos = t.chaosStats.report()
+	}
+
+	if t.bulkhead != nil {
+		report.Bulkheads = t.bulkhead.report()
+	}
+
+	if t.fallbackStats != nil {
+		report.Fallback = t.fallbackStats.report(&t.options.Fallback)
+	}
+
+	if t.hedger != nil {
+		report.Hedge = t.hedger.report()
+	}
+
+	if t.circuitBreaker != nil {
+		report.CircuitBreaker = t.circuitBreaker.report()
+	}
+
+	if t.retryStats != nil {
+		report.Retry = t.retryStats.report()
+	}
+
+	if t.tlsStats != nil {
+		report.TLS = t.tlsStats.report()
+	}
+
+	if t.keepAliveStats != nil {
+		report.KeepAlive = t.keepAliveStats.report(t.options)
+	}
+
+	return report
+}
@@ -0,0 +1,110 @@
+package loadgen
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Decorates a RoundTripper with additional behavior
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// Adapter allowing ordinary functions to be used as RoundTrippers
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Wraps the transport with the middlewares, the first one being the outermost
+func Chain(transport http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+
+	return transport
+}
+
+// Middlewares enabled by the options, outermost first
+func newMiddlewares(options *Options, retryStats *RetryStats, retryBudget *RetryBudget, breaker *CircuitBreaker, bulkhead *Bulkhead) []Middleware {
+	// Outermost so the retries of a request share its id
+	middlewares := []Middleware{WithRequestID()}
+
+	// So every attempt is logged and signed again
+	if options.Retry.Enabled {
+		middlewares = append(middlewares, WithRetry(options.Retry, retryStats, retryBudget))
+	}
+
+	// Inside the retries, which don't retry a rejection
+	if breaker != nil {
+		middlewares = append(middlewares, WithCircuitBreaker(breaker))
+	}
+
+	// Rejections by the circuit breaker don't take a slot
+	if bulkhead != nil {
+		middlewares = append(middlewares, WithBulkhead(bulkhead))
+	}
+
+	if options.LogRoundTrips {
+		middlewares = append(middlewares, WithLogging(log.StandardLogger()))
+	}
+
+	if options.AcceptEncoding != "" {
+		middlewares = append(middlewares, WithHeader("Accept-Encoding", options.AcceptEncoding))
+	}
+
+	// Inside the retries and the bulkhead, so the time they took is deducted
+	if options.PropagateDeadline {
+		middlewares = append(middlewares, WithDeadlineHeader())
+	}
+
+	// Innermost so the signature covers the final request
+	if options.Signing.Enabled {
+		middlewares = append(middlewares, WithSigning(options.Signing))
+	}
+
+	return middlewares
+}
+
+// Logs the outcome and duration of every round trip
+func WithLogging(logger *log.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			startTime := time.Now()
+
+			resp, err := next.RoundTrip(req)
+
+			entry := logger.WithFields(log.Fields{
+				"Method":    req.Method,
+				"URL":       req.URL.String(),
+				"RequestID": req.Header.Get(RequestIDHeader),
+				"Elapsed":   time.Since(startTime),
+			})
+
+			if err != nil {
+				entry.Printf("Round trip failed with error [%v]\n", err)
+				return nil, err
+			}
+
+			entry.Printf("Round trip finished with statusCode [%v]\n", resp.StatusCode)
+
+			return resp, nil
+		})
+	}
+}
+
+// Sets a header on every request that does not already carry it
+func WithHeader(name, value string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(name) == "" {
+				// RoundTrippers must not modify the caller's request
+				req = req.Clone(req.Context())
+				req.Header.Set(name, value)
+			}
+
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Server settings
+const (
+	ServerBaseURL = "https://localhost:8443"
+	RequestPath   = "/ping"
+)
+
+// HTTP client settings
+const (
+	HTTPClientTimeout = 1000 * time.Millisecond
+)
+
+// HTTP transport settings
+const (
+	HTTPTransportTLSHandshakeTimeout    = 0 * time.Millisecond
+	HTTPTransportDisableKeepAlives      = false
+	HTTPTransportMaxIdleConns           = 0
+	HTTPTransportMaxIdleConnsPerHost    = 1000
+	HTTPTransportMaxConnsPerHost        = 0
+	HTTPTransportIdleConnTimeout        = 60 * time.Second
+	HTTPTransportResponseHeaderTimeout  = 0 * time.Millisecond
+	HTTPTransportExpectContinueTimeout  = 0 * time.Millisecond
+	HTTPTransportMaxResponseHeaderBytes = 0
+	HTTPTransportWriteBufferSize        = 0
+	HTTPTransportReadBufferSize         = 0
+)
+
+// HTTP2 transport settings
+const (
+	AllowHTTP                  = true
+	StrictMaxConcurrentStreams = false
+	ReadIdleTimeout            = 0 * time.Millisecond
+	PingTimeout                = 0 * time.Millisecond
+)
+
+// Dialer settings
+const (
+	DialerTimeout   = 0 * time.Millisecond
+	DialerKeepAlive = 0 * time.Millisecond
+)
+
+// TLS client settings
+const (
+	TLSClientInsecureSkipVerify = true
+)
+
+// Load test settings
+const (
+	ConcurrentUsers = 100
+	RequestsPerUser = 100000
+)
+
+// Load test options
+type Options struct {
+	// Target, tcp://host:port or host:port for the TCP protocol
+	BaseURL string
+
+	// Protocol of the target: http, grpc, websocket or tcp
+	Protocol string
+
+	// Path requested by every user when the scenario has no steps
+	RequestPath string
+
+	// Closed-loop users, each sending RequestsPerUser requests back to back
+	Users           int
+	RequestsPerUser int
+
+	// Open-loop request rate per second (0 runs closed-loop users)
+	Rate float64
+
+	// Open-loop requests lagging more than this are shed (0 never sheds)
+	MaxSchedulingLag time.Duration
+
+	// Longest wait for the requests in flight once ctx is done, before
+	// they are cancelled (0 cancels them right away)
+	DrainTimeout time.Duration
+
+	// Deadline of the context of every request, independent of the client
+	// timeout (0 disables it)
+	RequestTimeout time.Duration
+
+	// Send the time left before the request deadline in the
+	// X-Request-Deadline header, for the server to honor
+	PropagateDeadline bool
+
+	// HTTP client
+	ClientTimeout      time.Duration
+	InsecureSkipVerify bool
+	Transport          TransportOptions
+	Dialer             DialerOptions
+	Socket             SocketOptions
+	TLS                TLSOptions
+
+	// One transport and connection pool per user instead of one shared by
+	// all, to compare many small clients with one pooled client
+	PerWorkerTransport bool
+
+	// Report how requests got their connection: reused, dialed or raced
+	TracePool bool
+
+	// Use the golang.org/x/net/http2 transport instead of net/http
+	HTTP2          bool
+	HTTP2Transport HTTP2TransportOptions
+
+	// Record the arrival time of every response body chunk
+	RecordChunkTimings bool
+
+	// Request compressed responses (gzip, deflate or br), decompressed
+	// by the load generator itself so sizes can be reported
+	AcceptEncoding string
+
+	// Trailers every response must carry
+	ExpectedTrailers []string
+
+	// Log every round trip made by the transport
+	LogRoundTrips bool
+
+	AdaptiveTimeout AdaptiveTimeoutOptions
+	Range           RangeOptions
+	Signing         SigningOptions
+	KeepAlive       KeepAliveOptions
+	Retry           RetryOptions
+	CircuitBreaker  CircuitBreakerOptions
+	Hedge           HedgeOptions
+	Fallback        FallbackOptions
+	Bulkhead        BulkheadOptions
+	Chaos           ChaosOptions
+
+	// Destinations of the per-attempt records
+	Sinks []SinkConfig
+}
+
+// net/http transport options
+type TransportOptions struct {
+	TLSHandshakeTimeout    time.Duration
+	DisableKeepAlives      bool
+	MaxIdleConns           int
+	MaxIdleConnsPerHost    int
+	MaxConnsPerHost        int
+	IdleConnTimeout        time.Duration
+	ResponseHeaderTimeout  time.Duration
+	ExpectContinueTimeout  time.Duration
+	MaxResponseHeaderBytes int64
+	WriteBufferSize        int
+	ReadBufferSize         int
+}
+
+// golang.org/x/net/http2 transport options
+type HTTP2TransportOptions struct {
+	AllowHTTP                  bool
+	StrictMaxConcurrentStreams bool
+	ReadIdleTimeout            time.Duration
+	PingTimeout                time.Duration
+}
+
+type DialerOptions struct {
+	Timeout time.Duration
+
+	// TCP keep-alive interval, 0 uses the Go default and negative disables it
+	KeepAlive time.Duration
+}
+
+// Options matching the settings above
+func DefaultOptions() Options {
+	return Options{
+		BaseURL:            ServerBaseURL,
+		Protocol:           ProtocolHTTP,
+		RequestPath:        RequestPath,
+		Users:              ConcurrentUsers,
+		RequestsPerUser:    RequestsPerUser,
+		DrainTimeout:       DrainTimeout,
+		ClientTimeout:      HTTPClientTimeout,
+		InsecureSkipVerify: TLSClientInsecureSkipVerify,
+		Transport: TransportOptions{
+			TLSHandshakeTimeout:    HTTPTransportTLSHandshakeTimeout,
+			DisableKeepAlives:      HTTPTransportDisableKeepAlives,
+			MaxIdleConns:           HTTPTransportMaxIdleConns,
+			MaxIdleConnsPerHost:    HTTPTransportMaxIdleConnsPerHost,
+			MaxConnsPerHost:        HTTPTransportMaxConnsPerHost,
+			IdleConnTimeout:        HTTPTransportIdleConnTimeout,
+			ResponseHeaderTimeout:  HTTPTransportResponseHeaderTimeout,
+			ExpectContinueTimeout:  HTTPTransportExpectContinueTimeout,
+			MaxResponseHeaderBytes: HTTPTransportMaxResponseHeaderBytes,
+			WriteBufferSize:        HTTPTransportWriteBufferSize,
+			ReadBufferSize:         HTTPTransportReadBufferSize,
+		},
+		Dialer: DialerOptions{
+			Timeout:   DialerTimeout,
+			KeepAlive: DialerKeepAlive,
+		},
+		Socket: DefaultSocketOptions(),
+		HTTP2Transport: HTTP2TransportOptions{
+			AllowHTTP:                  AllowHTTP,
+			StrictMaxConcurrentStreams: StrictMaxConcurrentStreams,
+			ReadIdleTimeout:            ReadIdleTimeout,
+			PingTimeout:                PingTimeout,
+		},
+		AdaptiveTimeout: DefaultAdaptiveTimeoutOptions(),
+		Range:           DefaultRangeOptions(),
+		Signing:         DefaultSigningOptions(),
+		Retry:           DefaultRetryOptions(),
+		CircuitBreaker:  DefaultCircuitBreakerOptions(),
+		Hedge:           DefaultHedgeOptions(),
+		Fallback:        DefaultFallbackOptions(),
+		Bulkhead:        DefaultBulkheadOptions(),
+		Chaos:           DefaultChaosOptions(),
+	}
+}
+
+func (o *Options) Validate() error {
+	if o.BaseURL == "" {
+		return errors.New("BaseURL can not be empty")
+	}
+
+	if o.Users < 1 {
+		return errors.New("Users must be at least 1")
+	}
+
+	if o.RequestsPerUser < 1 {
+		return errors.New("RequestsPerUser must be at least 1")
+	}
+
+	if o.Rate < 0 {
+		return errors.New("Rate can not be negative")
+	}
+
+	if o.RequestTimeout < 0 || o.ClientTimeout < 0 {
+		return errors.New("RequestTimeout and ClientTimeout can not be negative")
+	}
+
+	if o.DrainTimeout < 0 {
+		return errors.New("DrainTimeout can not be negative")
+	}
+
+	if o.KeepAlive.IdleHold < 0 {
+		return errors.New("IdleHold can not be negative")
+	}
+
+	if err := validateProtocol(o.Protocol); err != nil {
+		return err
+	}
+
+	if o.Range.Enabled && o.Protocol != ProtocolHTTP {
+		return errors.New("Range requires the http protocol")
+	}
+
+	switch o.Socket.NoDelay {
+	case NoDelayDefault, NoDelayOn, NoDelayOff:
+	default:
+		return fmt.Errorf("unknown TCP_NODELAY value [%s]", o.Socket.NoDelay)
+	}
+
+	if err := validateAcceptEncoding(o.AcceptEncoding); err != nil {
+		return err
+	}
+
+	if err := o.AdaptiveTimeout.Validate(); err != nil {
+		return err
+	}
+
+	if err := o.Chaos.Validate(); err != nil {
+		return err
+	}
+
+	if err := o.Bulkhead.Validate(); err != nil {
+		return err
+	}
+
+	if err := o.validateFallback(); err != nil {
+		return err
+	}
+
+	if err := o.Hedge.Validate(); err != nil {
+		return err
+	}
+
+	if err := o.CircuitBreaker.Validate(); err != nil {
+		return err
+	}
+
+	if err := o.Retry.Validate(); err != nil {
+		return err
+	}
+
+	if err := o.TLS.Validate(); err != nil {
+		return err
+	}
+
+	if err := validateSinks(o.Sinks); err != nil {
+		return err
+	}
+
+	return o.Signing.Validate()
+}
@@ -0,0 +1,66 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Wrapped by the errors panics are turned into
+var errPanic = errors.New("panic")
+
+// Executes one logical request, turning a panic into a failed request so a
+// bug in one code path doesn't silently stop the worker
+func (t *LoadTest) executeSafely(ctx context.Context, logger *log.Entry, cursor *rangeCursor) {
+	startTime := time.Now()
+
+	defer func() {
+		if value := recover(); value != nil {
+			t.failPanicked(startTime, t.recordPanic(logger, value))
+		}
+	}()
+
+	t.execute(ctx, logger, cursor)
+}
+
+// Starts functions on new goroutines, handing their panic to recovered as
+// an error
+type spawner func(fn func(), recovered func(err error))
+
+// Goroutines of a logical request, e.g. sub-requests and hedges, recover
+// like the worker does so a panic fails the attempt instead of the process
+func (t *LoadTest) safeGo(logger *log.Entry) spawner {
+	return func(fn func(), recovered func(err error)) {
+		go func() {
+			defer func() {
+				if value := recover(); value != nil {
+					recovered(t.recordPanic(logger, value))
+				}
+			}()
+
+			fn()
+		}()
+	}
+}
+
+// Counts the panic, logs its stack trace and returns it as an error
+func (t *LoadTest) recordPanic(logger *log.Entry, value interface{}) error {
+	t.stats.recordPanic()
+
+	logger.WithFields(log.Fields{
+		"Panic": value,
+		"Stack": string(debug.Stack()),
+	}).Error("Request panicked")
+
+	return fmt.Errorf("%w: %v", errPanic, value)
+}
+
+// Counts the logical request interrupted by the panic as failed
+func (t *LoadTest) failPanicked(startTime time.Time, err error) {
+	t.stats.RecordTermination(TerminatedByPanic)
+	t.stats.recordLogical(time.Since(startTime), err)
+}
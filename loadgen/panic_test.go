@@ -0,0 +1,43 @@
+package loadgen
+
+import (
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSafeGo(t *testing.T) {
+	tests := []struct {
+		name  string
+		fn    func()
+		err   bool
+		panic int64
+	}{
+		{"returned", func() {}, false, 0},
+		{"panicked", func() { panic("bug") }, true, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTest := &LoadTest{stats: NewStats()}
+			done := make(chan error, 1)
+
+			loadTest.safeGo(log.NewEntry(log.StandardLogger()))(func() {
+				test.fn()
+				done <- nil
+			}, func(err error) {
+				done <- err
+			})
+
+			err := <-done
+			if (err != nil) != test.err || (err != nil && !errors.Is(err, errPanic)) {
+				t.Errorf("safeGo() handed error [%v], expected a panic %v", err, test.err)
+			}
+
+			if panics := loadTest.stats.report().Panics; panics != test.panic {
+				t.Errorf("safeGo() recorded %d panics, expected %d", panics, test.panic)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package loadgen
+
+import (
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+)
+
+// How requests got their connection from the transport pool. Idle
+// connections are estimated as the connections open minus the requests
+// holding one, across all transports.
+type PoolStats struct {
+	// Connections open and requests holding one
+	open  int64
+	inUse int64
+
+	mutex          sync.Mutex
+	reusedIdle     int64
+	reusedActive   int64
+	dialed         int64
+	dialedWithIdle int64
+	dialLostRace   int64
+}
+
+func NewPoolStats() *PoolStats {
+	return &PoolStats{}
+}
+
+// Wraps a dialed connection to count it as open until it is closed
+func (s *PoolStats) track(conn net.Conn) net.Conn {
+	atomic.AddInt64(&s.open, 1)
+
+	return &pooledConn{Conn: conn, stats: s}
+}
+
+func (s *PoolStats) idle() int64 {
+	return atomic.LoadInt64(&s.open) - atomic.LoadInt64(&s.inUse)
+}
+
+// Connection acquisition of one request, filled by its client trace
+type poolTrace struct {
+	stats *PoolStats
+
+	// Estimated idle connections when the request asked for one
+	idleAtGet int64
+
+	// Set from the dialing goroutine, which may outlive the request when
+	// another connection was handed over first
+	dialStarted int32
+
+	gotConn bool
+	info    httptrace.GotConnInfo
+}
+
+func (s *PoolStats) newTrace() *poolTrace {
+	return &poolTrace{stats: s}
+}
+
+func (p *poolTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			p.idleAtGet = p.stats.idle()
+		},
+		ConnectStart: func(network, addr string) {
+			atomic.StoreInt32(&p.dialStarted, 1)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			p.gotConn = true
+			p.info = info
+			atomic.AddInt64(&p.stats.inUse, 1)
+		},
+	}
+}
+
+// Records the outcome once the response was read and the connection released
+func (p *poolTrace) finish() {
+	if !p.gotConn {
+		return
+	}
+
+	atomic.AddInt64(&p.stats.inUse, -1)
+
+	dialStarted := atomic.LoadInt32(&p.dialStarted) == 1
+
+	p.stats.mutex.Lock()
+	defer p.stats.mutex.Unlock()
+
+	switch {
+	case !p.info.Reused:
+		p.stats.dialed++
+
+		if p.idleAtGet > 0 {
+			p.stats.dialedWithIdle++
+		}
+
+	case dialStarted:
+		// The transport raced a dial against the pool and the pool won,
+		// the dialed connection becomes idle
+		p.stats.dialLostRace++
+
+	case p.info.WasIdle:
+		p.stats.reusedIdle++
+
+	default:
+		// Multiplexed HTTP/2 connection
+		p.stats.reusedActive++
+	}
+}
+
+func (s *PoolStats) report() *PoolReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return &PoolReport{
+		ReusedIdle:     s.reusedIdle,
+		ReusedActive:   s.reusedActive,
+		Dialed:         s.dialed,
+		DialedWithIdle: s.dialedWithIdle,
+		DialLostRace:   s.dialLostRace,
+	}
+}
+
+type pooledConn struct {
+	net.Conn
+	stats  *PoolStats
+	closed sync.Once
+}
+
+func (c *pooledConn) Close() error {
+	c.closed.Do(func() {
+		atomic.AddInt64(&c.stats.open, -1)
+	})
+
+	return c.Conn.Close()
+}
@@ -0,0 +1,143 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+)
+
+// Range request settings
+const (
+	RangePayloadSize = 10 << 20
+	RangeLength      = 64 << 10
+)
+
+// Fetches byte ranges of /payload/:size instead of requesting RequestPath
+type RangeOptions struct {
+	Enabled     bool
+	PayloadSize int64
+	Length      int64
+
+	// Walk the payload sequentially instead of picking random offsets
+	Sequential bool
+}
+
+func DefaultRangeOptions() RangeOptions {
+	return RangeOptions{
+		PayloadSize: RangePayloadSize,
+		Length:      RangeLength,
+	}
+}
+
+// Outcome counters of range requests
+type RangeStats struct {
+	mutex sync.Mutex
+
+	requests       int64
+	partialContent int64
+	fullContent    int64
+	invalid        int64
+}
+
+func (s *RangeStats) record(statusCode int, valid bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests++
+
+	switch {
+	case !valid && statusCode == http.StatusOK:
+		s.fullContent++
+	case !valid:
+		s.invalid++
+	default:
+		s.partialContent++
+	}
+}
+
+func (s *RangeStats) report() *RangeReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return &RangeReport{
+		Requests:       s.requests,
+		PartialContent: s.partialContent,
+		FullContent:    s.fullContent,
+		Invalid:        s.invalid,
+	}
+}
+
+// Picks the byte ranges requested by a single worker
+type rangeCursor struct {
+	options *RangeOptions
+	offset  int64
+}
+
+// Returns the next inclusive byte range
+func (c *rangeCursor) next() (int64, int64) {
+	var start int64
+
+	if c.options.Sequential {
+		start = c.offset
+		c.offset = (c.offset + c.options.Length) % c.options.PayloadSize
+	} else {
+		start = rand.Int63n(c.options.PayloadSize)
+	}
+
+	end := start + c.options.Length - 1
+	if end >= c.options.PayloadSize {
+		end = c.options.PayloadSize - 1
+	}
+
+	return start, end
+}
+
+func (t *LoadTest) fetchRange(ctx context.Context, start, end int64) (*Response, error) {
+	url := fmt.Sprintf("%s/payload/%d", t.options.BaseURL, t.options.Range.PayloadSize)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	// Validate only allows ranges over HTTP
+	response, err := t.target.(*HTTPTarget).Send(req)
+	if err != nil {
+		// The server answered, so the response still counts as invalid
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			t.rangeStats.record(response.StatusCode, false)
+		}
+
+		return response, err
+	}
+
+	err = validateRange(response, start, end, t.options.Range.PayloadSize)
+
+	t.rangeStats.record(response.StatusCode, err == nil)
+
+	return response, err
+}
+
+// Checks the response is a 206 carrying exactly the requested range
+func validateRange(response *Response, start, end, size int64) error {
+	if response.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("expected status 206, got %d", response.StatusCode)
+	}
+
+	expected := fmt.Sprintf("bytes %d-%d/%d", start, end, size)
+	if contentRange := response.Header.Get("Content-Range"); contentRange != expected {
+		return fmt.Errorf("expected Content-Range [%s], got [%s]", expected, contentRange)
+	}
+
+	if length := int64(len(response.Body)); length != end-start+1 {
+		return fmt.Errorf("expected %d bytes, got %d", end-start+1, length)
+	}
+
+	return nil
+}
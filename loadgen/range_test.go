@@ -0,0 +1,87 @@
+package loadgen
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		contentRange string
+		body         string
+		valid        bool
+	}{
+		{"partial content", http.StatusPartialContent, "bytes 10-19/100", strings.Repeat("x", 10), true},
+		{"full content", http.StatusOK, "", strings.Repeat("x", 100), false},
+		{"other range", http.StatusPartialContent, "bytes 0-9/100", strings.Repeat("x", 10), false},
+		{"other size", http.StatusPartialContent, "bytes 10-19/200", strings.Repeat("x", 10), false},
+		{"short body", http.StatusPartialContent, "bytes 10-19/100", strings.Repeat("x", 9), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := &Response{
+				StatusCode: test.statusCode,
+				Header:     http.Header{},
+				Body:       test.body,
+			}
+
+			if test.contentRange != "" {
+				response.Header.Set("Content-Range", test.contentRange)
+			}
+
+			err := validateRange(response, 10, 19, 100)
+
+			if test.valid && err != nil {
+				t.Errorf("validateRange() returned error [%v], expected none", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("validateRange() returned no error, expected one")
+			}
+		})
+	}
+}
+
+func TestRangeCursorSequential(t *testing.T) {
+	cursor := &rangeCursor{options: &RangeOptions{PayloadSize: 25, Length: 10, Sequential: true}}
+
+	expected := [][2]int64{{0, 9}, {10, 19}, {20, 24}, {5, 14}}
+
+	for _, want := range expected {
+		if start, end := cursor.next(); start != want[0] || end != want[1] {
+			t.Errorf("next() returned range %d-%d, expected %d-%d", start, end, want[0], want[1])
+		}
+	}
+}
+
+func TestRangeCursorRandom(t *testing.T) {
+	options := &RangeOptions{PayloadSize: 25, Length: 10}
+	cursor := &rangeCursor{options: options}
+
+	for i := 0; i < 100; i++ {
+		start, end := cursor.next()
+
+		if start < 0 || end >= options.PayloadSize || end < start || end-start+1 > options.Length {
+			t.Fatalf("next() returned range %d-%d, out of the payload or longer than %d", start, end, options.Length)
+		}
+	}
+}
+
+func TestRangeStats(t *testing.T) {
+	stats := &RangeStats{}
+
+	stats.record(http.StatusPartialContent, true)
+	stats.record(http.StatusOK, false)
+	stats.record(http.StatusPartialContent, false)
+
+	report := stats.report()
+
+	if report.Requests != 3 || report.PartialContent != 1 || report.FullContent != 1 || report.Invalid != 1 {
+		t.Errorf("reported %d requests, %d partial, %d full and %d invalid, expected 3, 1, 1 and 1",
+			report.Requests, report.PartialContent, report.FullContent, report.Invalid)
+	}
+}
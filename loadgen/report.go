@@ -0,0 +1,672 @@
+package loadgen
+
+import (
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Current version of the Report JSON schema
+//
+// Version history:
+//   - 1: untagged Report, JSON keys are the Go field names
+//   - 2: snake_case keys and schema_version
+const ReportSchemaVersion = 2
+
+// Outcome of a load test, as returned by Run and exported as JSON.
+//
+// Durations are encoded in nanoseconds. Fields may be added in minor
+// revisions of a schema version, renaming or removing them requires a new
+// version and a migration in DecodeReport.
+type Report struct {
+	SchemaVersion int `json:"schema_version"`
+
+	// Wall-clock duration of the load test
+	Duration time.Duration `json:"duration"`
+
+	// Whether the run was stopped before all requests were sent
+	Interrupted bool `json:"interrupted"`
+
+	// Logical requests, each made of one or more attempts. Responses with a
+	// 5xx or 429 status count as failures.
+	Requests int64 `json:"requests"`
+	Failures int64 `json:"failures"`
+
+	// Scenario sub-requests cancelled by the fan-in of their step once it
+	// was met, counted neither in Requests nor in Failures
+	Cancelled int64 `json:"cancelled"`
+
+	// Individual attempts: the first one of every logical request and its
+	// retries. Hedges are only counted in the hedge report.
+	Attempts        int64 `json:"attempts"`
+	AttemptFailures int64 `json:"attempt_failures"`
+
+	// Open-loop requests dropped because they were too stale to send
+	Shed int64 `json:"shed"`
+
+	// Panics in the load generator, failing the request or scenario step
+	// they interrupted
+	Panics int64 `json:"panics"`
+
+	// Failed requests by what terminated them: client_timeout,
+	// context_deadline, cancelled, transport_timeout, panic or error
+	Terminations map[string]int64 `json:"terminations,omitempty"`
+
+	// Failed attempts by error class: timeout, reset, refused, eof, other,
+	// or the status code, e.g. 503 or 429, of the responses with a failed
+	// status
+	ErrorClasses map[string]int64 `json:"error_classes,omitempty"`
+
+	// Targets (transports and their pools) and the connections they dialed
+	Transports  int   `json:"transports"`
+	Connections int64 `json:"connections"`
+
+	// Per-attempt latency
+	Latency Percentiles `json:"latency"`
+
+	// End-to-end latency of logical requests across all their attempts
+	TimeToSuccess Percentiles `json:"time_to_success"`
+	TimeToFailure Percentiles `json:"time_to_failure"`
+
+	// Delay between the intended and actual send time of open-loop requests
+	SchedulingLag Percentiles `json:"scheduling_lag"`
+
+	// Only set when the corresponding feature was used
+	ChunkTimings    *ChunkTimingsReport    `json:"chunk_timings,omitempty"`
+	ContentEncoding *ContentEncodingReport `json:"content_encoding,omitempty"`
+	AdaptiveTimeout *AdaptiveTimeoutReport `json:"adaptive_timeout,omitempty"`
+	Range           *RangeReport           `json:"range,omitempty"`
+	HTTP2           *HTTP2Report           `json:"http2,omitempty"`
+	Scenario        *ScenarioReport        `json:"scenario,omitempty"`
+	Socket          *SocketReport          `json:"socket,omitempty"`
+	TLS             *TLSReport             `json:"tls,omitempty"`
+	Pool            *PoolReport            `json:"pool,omitempty"`
+	Retry           *RetryReport           `json:"retry,omitempty"`
+	CircuitBreaker  *CircuitBreakerReport  `json:"circuit_breaker,omitempty"`
+	Hedge           *HedgeReport           `json:"hedge,omitempty"`
+	Fallback        *FallbackReport        `json:"fallback,omitempty"`
+	KeepAlive       *KeepAliveReport       `json:"keep_alive,omitempty"`
+	Chaos           *ChaosReport           `json:"chaos,omitempty"`
+
+	// Bulkhead queueing and service times, by host
+	Bulkheads map[string]*BulkheadReport `json:"bulkheads,omitempty"`
+
+	// Records streamed to each sink, by sink name
+	Sinks map[string]*SinkReport `json:"sinks,omitempty"`
+
+	// Responses carrying each trailer, by trailer name
+	Trailers map[string]int64 `json:"trailers,omitempty"`
+}
+
+// Latency distribution
+type Percentiles struct {
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// Response body arrival times, relative to the request start
+type ChunkTimingsReport struct {
+	Chunks          int64       `json:"chunks"`
+	TimeToFirstByte Percentiles `json:"time_to_first_byte"`
+	TimeToLastByte  Percentiles `json:"time_to_last_byte"`
+	MaxChunkGap     Percentiles `json:"max_chunk_gap"`
+}
+
+// Compressed responses decoded by the load generator
+type ContentEncodingReport struct {
+	Responses         int64         `json:"responses"`
+	CompressedBytes   int64         `json:"compressed_bytes"`
+	DecompressedBytes int64         `json:"decompressed_bytes"`
+	DecompressTime    time.Duration `json:"decompress_time"`
+}
+
+// Adaptive deadlines compared with the static client timeout
+type AdaptiveTimeoutReport struct {
+	StaticTimeout     time.Duration `json:"static_timeout"`
+	FinalTimeout      time.Duration `json:"final_timeout"`
+	MinTimeout        time.Duration `json:"min_timeout"`
+	MaxTimeout        time.Duration `json:"max_timeout"`
+	Fired             int64         `json:"fired"`
+	FiredBeforeStatic int64         `json:"fired_before_static"`
+	StaticWouldFire   int64         `json:"static_would_fire"`
+
+	// Every recomputation of the timeout, in order
+	Timeline []AdaptiveTimeoutSample `json:"timeline"`
+}
+
+// Timeout recomputed from the latency percentile at some point of the run
+type AdaptiveTimeoutSample struct {
+	Elapsed time.Duration `json:"elapsed"`
+	Latency time.Duration `json:"latency"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+// Outcome of range requests
+type RangeReport struct {
+	Requests       int64 `json:"requests"`
+	PartialContent int64 `json:"partial_content"`
+	FullContent    int64 `json:"full_content"`
+	Invalid        int64 `json:"invalid"`
+}
+
+// Connection-level HTTP/2 events
+type HTTP2Report struct {
+	Connections int64       `json:"connections"`
+	PingsSent   int64       `json:"pings_sent"`
+	PingRTT     Percentiles `json:"ping_rtt"`
+	GoAways     int64       `json:"go_aways"`
+
+	// RST_STREAM frames received, by error code
+	StreamResets map[string]int64 `json:"stream_resets"`
+}
+
+// Socket options applied to, or failed on, the connections dialed
+type SocketReport struct {
+	Applied map[string]int64 `json:"applied"`
+	Failed  map[string]int64 `json:"failed"`
+}
+
+// Retries made by the retry middleware, each also counted in the attempts
+// of the load test
+type RetryReport struct {
+	Retries         int64 `json:"retries"`
+	RetriedRequests int64 `json:"retried_requests"`
+
+	// Retried requests still failing after their last attempt
+	GaveUp int64 `json:"gave_up"`
+
+	// Retries not made because the retry budget was spent
+	BudgetDenied int64 `json:"budget_denied"`
+
+	// Retries not made because the request was not idempotent
+	NotIdempotent int64 `json:"not_idempotent"`
+
+	// Retries by status code or error class
+	Reasons map[string]int64 `json:"reasons"`
+
+	// Total time spent backing off
+	Backoff time.Duration `json:"backoff"`
+
+	// Latency of the retried requests across all their attempts
+	RetriedLatency Percentiles `json:"retried_latency"`
+}
+
+// Faults injected by the client
+type ChaosReport struct {
+	// Requests picked for cancellation, and those still in flight when it
+	// happened
+	CancelScheduled int64 `json:"cancel_scheduled"`
+	CancelFired     int64 `json:"cancel_fired"`
+}
+
+// Round trips to one host through the bulkhead
+type BulkheadReport struct {
+	// Time waited for a slot, and time the slot was held
+	QueueWait   Percentiles `json:"queue_wait"`
+	ServiceTime Percentiles `json:"service_time"`
+
+	// Round trips failed after the queue timeout
+	Rejected int64 `json:"rejected"`
+}
+
+// Traffic sent to the fallback target
+type FallbackReport struct {
+	BaseURL          string  `json:"base_url"`
+	Mode             string  `json:"mode"`
+	Primary          int64   `json:"primary"`
+	Fallback         int64   `json:"fallback"`
+	FallbackFailures int64   `json:"fallback_failures"`
+	FallbackShare    float64 `json:"fallback_share"`
+}
+
+// Hedged requests and which of their attempts responded first
+type HedgeReport struct {
+	FinalDelay time.Duration `json:"final_delay"`
+	Hedged     int64         `json:"hedged"`
+	HedgeWon   int64         `json:"hedge_won"`
+	PrimaryWon int64         `json:"primary_won"`
+	BothFailed int64         `json:"both_failed"`
+}
+
+// Circuit breaker state at the end of the load test and its history
+type CircuitBreakerReport struct {
+	State string `json:"state"`
+
+	// State changes, by "from -> to"
+	Transitions map[string]int64 `json:"transitions"`
+
+	// Round trips failed fast while open
+	Rejected int64         `json:"rejected"`
+	TimeOpen time.Duration `json:"time_open"`
+}
+
+// How requests got their connection from the transport pool
+type PoolReport struct {
+	ReusedIdle int64 `json:"reused_idle"`
+
+	// Multiplexed HTTP/2 connections already serving other requests
+	ReusedActive int64 `json:"reused_active"`
+
+	Dialed int64 `json:"dialed"`
+
+	// Dialed while idle connections were estimated to exist
+	DialedWithIdle int64 `json:"dialed_with_idle"`
+
+	// Dials raced against the pool which a freed connection won
+	DialLostRace int64 `json:"dial_lost_race"`
+}
+
+// TLS handshakes of the connections dialed
+type TLSReport struct {
+	// Handshake durations by variant: full or resumed
+	Handshakes map[string]Percentiles `json:"handshakes"`
+
+	// Negotiated versions, e.g. 1.3
+	Versions map[string]int64 `json:"versions"`
+	Failures int64            `json:"failures"`
+}
+
+// Records written to, or dropped by, a sink
+type SinkReport struct {
+	Policy  string `json:"policy"`
+	Written int64  `json:"written"`
+	Dropped int64  `json:"dropped"`
+	Errors  int64  `json:"errors"`
+
+	// Time the load test waited on a full buffer (block policy only)
+	Blocked time.Duration `json:"blocked"`
+}
+
+// Dead connections observed while probing TCP keep-alive
+type KeepAliveReport struct {
+	Interval    time.Duration `json:"interval"`
+	IdleHold    time.Duration `json:"idle_hold"`
+	Connections int64         `json:"connections"`
+
+	// Dead connections by error: eof, reset, timeout or other
+	Dead map[string]int64 `json:"dead"`
+
+	// Whether a request was in flight when the connection was found dead
+	NoticedByRequest int64 `json:"noticed_by_request"`
+	NoticedWhileIdle int64 `json:"noticed_while_idle"`
+
+	// Time between the last activity and the detection of dead connections
+	Linger Percentiles `json:"linger"`
+
+	// Requests failing on a reused connection, and how long it had been idle
+	StaleRequests int64       `json:"stale_requests"`
+	StaleIdleTime Percentiles `json:"stale_idle_time"`
+}
+
+// Scenario iterations and their steps
+type ScenarioReport struct {
+	Completed int64                  `json:"completed"`
+	Failed    int64                  `json:"failed"`
+	Latency   Percentiles            `json:"latency"`
+	Steps     map[string]*StepReport `json:"steps"`
+
+	// Time a step waited on each dependency after it completed, by "from -> to"
+	Edges map[string]Percentiles `json:"edges"`
+
+	SLOBreaches int64 `json:"slo_breaches"`
+}
+
+type StepReport struct {
+	Latency   Percentiles `json:"latency"`
+	Failed    int64       `json:"failed"`
+	Cancelled int64       `json:"cancelled"`
+	Skipped   int64       `json:"skipped"`
+
+	// Share of the end-to-end latency spent in this step on the critical path
+	Share float64 `json:"share"`
+
+	// Iterations where the step was the largest contributor
+	Dominant int64 `json:"dominant"`
+
+	// SLO breaches blamed on the step
+	SLOBreaches int64 `json:"slo_breaches"`
+}
+
+func newPercentiles(samples []time.Duration) Percentiles {
+	if len(samples) == 0 {
+		return Percentiles{}
+	}
+
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return Percentiles{
+		Count: len(sorted),
+		Min:   sorted[0],
+		P50:   percentile(sorted, 50),
+		P90:   percentile(sorted, 90),
+		P99:   percentile(sorted, 99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// Returns the p-th percentile of an already sorted slice
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	index := int(float64(len(sorted)-1) * p / 100)
+
+	return sorted[index]
+}
+
+// Logs the report
+func (r *Report) Print() {
+	log.WithFields(log.Fields{
+		"Duration":        r.Duration,
+		"Interrupted":     r.Interrupted,
+		"Requests":        r.Requests,
+		"Failures":        r.Failures,
+		"Cancelled":       r.Cancelled,
+		"Attempts":        r.Attempts,
+		"AttemptFailures": r.AttemptFailures,
+		"Shed":            r.Shed,
+		"Panics":          r.Panics,
+		"Transports":      r.Transports,
+		"Connections":     r.Connections,
+	}).Print("Load test finished")
+
+	if len(r.Terminations) > 0 {
+		fields := log.Fields{}
+
+		for cause, count := range r.Terminations {
+			fields[cause] = count
+		}
+
+		log.WithFields(fields).Print("Terminations")
+	}
+
+	// Failed statuses are keyed by their code, e.g. 503, next to the
+	// transport error classes
+	if len(r.ErrorClasses) > 0 {
+		fields := log.Fields{}
+
+		for class, count := range r.ErrorClasses {
+			fields[class] = count
+		}
+
+		log.WithFields(fields).Print("Error classes")
+	}
+
+	r.Latency.print("Latency")
+	r.TimeToSuccess.print("TimeToSuccess")
+	r.TimeToFailure.print("TimeToFailure")
+	r.SchedulingLag.print("SchedulingLag")
+
+	if encoding := r.ContentEncoding; encoding != nil {
+		log.WithFields(log.Fields{
+			"Responses":         encoding.Responses,
+			"CompressedBytes":   encoding.CompressedBytes,
+			"DecompressedBytes": encoding.DecompressedBytes,
+			"Ratio":             float64(encoding.DecompressedBytes) / float64(encoding.CompressedBytes),
+			"DecompressTime":    encoding.DecompressTime,
+		}).Print("Content encoding")
+	}
+
+	if len(r.Trailers) > 0 {
+		fields := log.Fields{}
+
+		for name, count := range r.Trailers {
+			fields[name] = count
+		}
+
+		log.WithFields(fields).Print("Trailers")
+	}
+
+	if timings := r.ChunkTimings; timings != nil {
+		log.WithFields(log.Fields{
+			"Chunks": timings.Chunks,
+		}).Print("Chunk timings")
+
+		timings.TimeToFirstByte.print("TimeToFirstByte")
+		timings.TimeToLastByte.print("TimeToLastByte")
+		timings.MaxChunkGap.print("MaxChunkGap")
+	}
+
+	if adaptive := r.AdaptiveTimeout; adaptive != nil {
+		log.WithFields(log.Fields{
+			"StaticTimeout":     adaptive.StaticTimeout,
+			"FinalTimeout":      adaptive.FinalTimeout,
+			"MinTimeout":        adaptive.MinTimeout,
+			"MaxTimeout":        adaptive.MaxTimeout,
+			"Fired":             adaptive.Fired,
+			"FiredBeforeStatic": adaptive.FiredBeforeStatic,
+			"StaticWouldFire":   adaptive.StaticWouldFire,
+		}).Print("Adaptive timeout")
+
+		for _, sample := range adaptive.Timeline {
+			log.WithFields(log.Fields{
+				"Elapsed": sample.Elapsed,
+				"Latency": sample.Latency,
+				"Timeout": sample.Timeout,
+			}).Debug("Adaptive timeout recomputed")
+		}
+	}
+
+	if ranges := r.Range; ranges != nil {
+		log.WithFields(log.Fields{
+			"Requests":       ranges.Requests,
+			"PartialContent": ranges.PartialContent,
+			"FullContent":    ranges.FullContent,
+			"Invalid":        ranges.Invalid,
+		}).Print("Range requests")
+	}
+
+	if h2 := r.HTTP2; h2 != nil {
+		fields := log.Fields{
+			"Connections": h2.Connections,
+			"PingsSent":   h2.PingsSent,
+			"PingAcks":    h2.PingRTT.Count,
+			"GoAways":     h2.GoAways,
+		}
+
+		for code, count := range h2.StreamResets {
+			fields["RST_STREAM "+code] = count
+		}
+
+		log.WithFields(fields).Print("HTTP2 connection health")
+
+		h2.PingRTT.print("PingRTT")
+	}
+
+	if socket := r.Socket; socket != nil {
+		fields := log.Fields{}
+
+		for option, count := range socket.Applied {
+			fields[option] = count
+		}
+
+		for option, count := range socket.Failed {
+			fields[option+" failed"] = count
+		}
+
+		log.WithFields(fields).Print("Socket options")
+	}
+
+	if retry := r.Retry; retry != nil {
+		fields := log.Fields{
+			"Retries":         retry.Retries,
+			"RetriedRequests": retry.RetriedRequests,
+			"GaveUp":          retry.GaveUp,
+			"BudgetDenied":    retry.BudgetDenied,
+			"NotIdempotent":   retry.NotIdempotent,
+			"Backoff":         retry.Backoff,
+		}
+
+		for reason, count := range retry.Reasons {
+			fields["Retry "+reason] = count
+		}
+
+		log.WithFields(fields).Print("Retries")
+
+		retry.RetriedLatency.print("RetriedLatency")
+	}
+
+	if fallback := r.Fallback; fallback != nil {
+		log.WithFields(log.Fields{
+			"BaseURL":          fallback.BaseURL,
+			"Mode":             fallback.Mode,
+			"Primary":          fallback.Primary,
+			"Fallback":         fallback.Fallback,
+			"FallbackFailures": fallback.FallbackFailures,
+			"FallbackShare":    fallback.FallbackShare,
+		}).Print("Fallback")
+	}
+
+	if chaos := r.Chaos; chaos != nil {
+		log.WithFields(log.Fields{
+			"CancelScheduled": chaos.CancelScheduled,
+			"CancelFired":     chaos.CancelFired,
+		}).Print("Chaos")
+	}
+
+	for host, bulkhead := range r.Bulkheads {
+		log.WithFields(log.Fields{
+			"Host":     host,
+			"Rejected": bulkhead.Rejected,
+		}).Print("Bulkhead")
+
+		bulkhead.QueueWait.print(host + " QueueWait")
+		bulkhead.ServiceTime.print(host + " ServiceTime")
+	}
+
+	if hedge := r.Hedge; hedge != nil {
+		log.WithFields(log.Fields{
+			"FinalDelay": hedge.FinalDelay,
+			"Hedged":     hedge.Hedged,
+			"HedgeWon":   hedge.HedgeWon,
+			"PrimaryWon": hedge.PrimaryWon,
+			"BothFailed": hedge.BothFailed,
+		}).Print("Hedged requests")
+	}
+
+	if breaker := r.CircuitBreaker; breaker != nil {
+		fields := log.Fields{
+			"State":    breaker.State,
+			"Rejected": breaker.Rejected,
+			"TimeOpen": breaker.TimeOpen,
+		}
+
+		for transition, count := range breaker.Transitions {
+			fields[transition] = count
+		}
+
+		log.WithFields(fields).Print("Circuit breaker")
+	}
+
+	if pool := r.Pool; pool != nil {
+		log.WithFields(log.Fields{
+			"ReusedIdle":     pool.ReusedIdle,
+			"ReusedActive":   pool.ReusedActive,
+			"Dialed":         pool.Dialed,
+			"DialedWithIdle": pool.DialedWithIdle,
+			"DialLostRace":   pool.DialLostRace,
+		}).Print("Connection pool")
+	}
+
+	if tlsReport := r.TLS; tlsReport != nil {
+		fields := log.Fields{
+			"Failures": tlsReport.Failures,
+		}
+
+		for version, count := range tlsReport.Versions {
+			fields["TLS "+version] = count
+		}
+
+		log.WithFields(fields).Print("TLS handshakes")
+
+		for variant, durations := range tlsReport.Handshakes {
+			durations.print("Handshake " + variant)
+		}
+	}
+
+	if keepAlive := r.KeepAlive; keepAlive != nil {
+		fields := log.Fields{
+			"Interval":         keepAlive.Interval,
+			"IdleHold":         keepAlive.IdleHold,
+			"Connections":      keepAlive.Connections,
+			"NoticedByRequest": keepAlive.NoticedByRequest,
+			"NoticedWhileIdle": keepAlive.NoticedWhileIdle,
+			"StaleRequests":    keepAlive.StaleRequests,
+		}
+
+		for reason, count := range keepAlive.Dead {
+			fields["Dead "+reason] = count
+		}
+
+		log.WithFields(fields).Print("Keep-alive")
+
+		keepAlive.Linger.print("Linger")
+		keepAlive.StaleIdleTime.print("StaleIdleTime")
+	}
+
+	for name, sink := range r.Sinks {
+		log.WithFields(log.Fields{
+			"Sink":    name,
+			"Policy":  sink.Policy,
+			"Written": sink.Written,
+			"Dropped": sink.Dropped,
+			"Errors":  sink.Errors,
+			"Blocked": sink.Blocked,
+		}).Print("Sink")
+	}
+
+	if scenario := r.Scenario; scenario != nil {
+		scenario.print()
+	}
+}
+
+func (s *ScenarioReport) print() {
+	log.WithFields(log.Fields{
+		"Completed":   s.Completed,
+		"Failed":      s.Failed,
+		"SLOBreaches": s.SLOBreaches,
+	}).Print("Scenario")
+
+	s.Latency.print("Scenario")
+
+	for name, step := range s.Steps {
+		log.WithFields(log.Fields{
+			"Step":        name,
+			"Completed":   step.Latency.Count,
+			"Failed":      step.Failed,
+			"Cancelled":   step.Cancelled,
+			"Skipped":     step.Skipped,
+			"Share":       step.Share,
+			"Dominant":    step.Dominant,
+			"SLOBreaches": step.SLOBreaches,
+		}).Print("Scenario step")
+
+		step.Latency.print(name)
+	}
+
+	for edge, waits := range s.Edges {
+		waits.print(edge)
+	}
+}
+
+func (p Percentiles) print(name string) {
+	if p.Count == 0 {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"Min": p.Min,
+		"P50": p.P50,
+		"P90": p.P90,
+		"P99": p.P99,
+		"Max": p.Max,
+	}).Print(name)
+}
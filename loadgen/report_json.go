@@ -0,0 +1,102 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Reads a JSON report of any known schema version, migrating it to the
+// current one
+func DecodeReport(r io.Reader) (Report, error) {
+	var document map[string]interface{}
+
+	if err := json.NewDecoder(r).Decode(&document); err != nil {
+		return Report{}, err
+	}
+
+	// Version 1 reports have no schema_version
+	version := 1
+
+	if value, ok := document["schema_version"]; ok {
+		number, ok := value.(float64)
+		if !ok {
+			return Report{}, fmt.Errorf("invalid schema_version [%v]", value)
+		}
+
+		version = int(number)
+	}
+
+	switch version {
+	case 1:
+		migrateFieldNames(document, reflect.TypeOf(Report{}))
+	case ReportSchemaVersion:
+	default:
+		return Report{}, fmt.Errorf("unsupported report schema version %d", version)
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return Report{}, err
+	}
+
+	var report Report
+
+	if err := json.Unmarshal(data, &report); err != nil {
+		return Report{}, err
+	}
+
+	report.SchemaVersion = ReportSchemaVersion
+
+	return report, nil
+}
+
+// Renames the Go field names used as keys by version 1 to their JSON names,
+// leaving the keys of maps (trailer names, steps...) untouched
+func migrateFieldNames(value interface{}, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+			fieldValue, ok := object[field.Name]
+			if !ok || name == "" || name == field.Name {
+				continue
+			}
+
+			delete(object, field.Name)
+			object[name] = fieldValue
+
+			migrateFieldNames(fieldValue, field.Type)
+		}
+
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		for _, item := range object {
+			migrateFieldNames(item, t.Elem())
+		}
+	}
+}
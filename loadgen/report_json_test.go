@@ -0,0 +1,75 @@
+package loadgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeReportVersion1(t *testing.T) {
+	document := `{
+		"Duration": 5000000000,
+		"Requests": 10,
+		"AttemptFailures": 2,
+		"Latency": {"Count": 10, "P99": 7},
+		"Trailers": {"Grpc-Status": 3},
+		"Scenario": {"Steps": {"Login": {"Failed": 2}}}
+	}`
+
+	report, err := DecodeReport(strings.NewReader(document))
+	if err != nil {
+		t.Fatalf("DecodeReport() returned error [%v]", err)
+	}
+
+	if report.SchemaVersion != ReportSchemaVersion {
+		t.Errorf("schema version is %d, expected %d", report.SchemaVersion, ReportSchemaVersion)
+	}
+
+	if report.Duration != 5000000000 || report.Requests != 10 || report.AttemptFailures != 2 {
+		t.Errorf("top-level fields not migrated: %+v", report)
+	}
+
+	if report.Latency.Count != 10 || report.Latency.P99 != 7 {
+		t.Errorf("nested fields not migrated: %+v", report.Latency)
+	}
+
+	// Map keys are names, not fields
+	if report.Trailers["Grpc-Status"] != 3 {
+		t.Errorf("trailer names renamed: %v", report.Trailers)
+	}
+
+	if step, ok := report.Scenario.Steps["Login"]; !ok || step.Failed != 2 {
+		t.Errorf("steps not migrated: %v", report.Scenario.Steps)
+	}
+}
+
+func TestDecodeReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		requests int64
+		valid    bool
+	}{
+		{"version 2", `{"schema_version": 2, "requests": 10}`, 10, true},
+		{"unsupported version", `{"schema_version": 3, "requests": 10}`, 0, false},
+		{"invalid version", `{"schema_version": "2", "requests": 10}`, 0, false},
+		{"invalid JSON", `{"requests": `, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := DecodeReport(strings.NewReader(test.document))
+
+			if test.valid && err != nil {
+				t.Fatalf("DecodeReport() returned error [%v], expected none", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("DecodeReport() returned no error, expected one")
+			}
+
+			if report.Requests != test.requests {
+				t.Errorf("requests is %d, expected %d", report.Requests, test.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header identifying a request in the client and server logs
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// Context carrying the id of the logical request, sent by every attempt
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Sends the id of the request context in X-Request-Id, or a new one when
+// it carries none, unless the request already has one
+func WithRequestID() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(RequestIDHeader) != "" {
+				return next.RoundTrip(req)
+			}
+
+			id := requestIDFrom(req.Context())
+			if id == "" {
+				id = newRequestID()
+			}
+
+			// RoundTrippers must not modify the caller's request
+			req = req.Clone(req.Context())
+			req.Header.Set(RequestIDHeader, id)
+
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Retry settings
+const (
+	RetryMaxAttempts = 3
+	RetryBaseBackoff = 50 * time.Millisecond
+	RetryMaxBackoff  = 1 * time.Second
+	RetryJitter      = 0.5
+
+	// Header making requests with non-idempotent methods safe to retry
+	RetryIdempotencyKeyHeader = "Idempotency-Key"
+)
+
+// Error classes that can be retried
+const (
+	RetryOnTimeout = "timeout"
+	RetryOnReset   = "reset"
+	RetryOnRefused = "refused"
+	RetryOnEOF     = "eof"
+)
+
+var retryErrorClasses = []string{RetryOnTimeout, RetryOnReset, RetryOnRefused, RetryOnEOF}
+
+// Retries failed round trips with exponential backoff. The client timeout
+// covers all attempts of a request.
+type RetryOptions struct {
+	Enabled bool
+
+	// Attempts per request, including the first one
+	MaxAttempts int
+
+	// Backoff doubles from BaseBackoff after every attempt, up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Share of the backoff that is randomized, from 0 (none) to 1 (full jitter)
+	Jitter float64
+
+	// Response status codes and error classes (timeout, reset, refused,
+	// eof) worth another attempt
+	StatusCodes  []int
+	ErrorClasses []string
+
+	// Also retry non-idempotent methods (POST, PATCH) without an
+	// Idempotency-Key header
+	RetryNonIdempotent bool
+
+	// Retries allowed per request across all requests over BudgetWindow,
+	// e.g. 0.1 for 10%, on top of BudgetMinRetries (0 disables the budget)
+	Budget           float64
+	BudgetWindow     time.Duration
+	BudgetMinRetries int
+}
+
+func DefaultRetryOptions() RetryOptions {
+	return RetryOptions{
+		MaxAttempts:  RetryMaxAttempts,
+		BaseBackoff:  RetryBaseBackoff,
+		MaxBackoff:   RetryMaxBackoff,
+		Jitter:       RetryJitter,
+		StatusCodes:  []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		ErrorClasses: retryErrorClasses,
+
+		BudgetWindow:     RetryBudgetWindow,
+		BudgetMinRetries: RetryBudgetMinRetries,
+	}
+}
+
+func (o *RetryOptions) Validate() error {
+	if !o.Enabled {
+		return nil
+	}
+
+	if o.MaxAttempts < 1 {
+		return errors.New("retry MaxAttempts must be at least 1")
+	}
+
+	if o.BaseBackoff < 0 || o.MaxBackoff < o.BaseBackoff {
+		return errors.New("retry backoff must be positive and MaxBackoff at least BaseBackoff")
+	}
+
+	if o.Jitter < 0 || o.Jitter > 1 {
+		return errors.New("retry Jitter must be between 0 and 1")
+	}
+
+	if o.Budget < 0 || o.BudgetMinRetries < 0 {
+		return errors.New("retry Budget and BudgetMinRetries can not be negative")
+	}
+
+	// Every bucket must span at least a millisecond
+	if o.Budget > 0 && o.BudgetWindow < retryBudgetBuckets*time.Millisecond {
+		return errors.New("retry BudgetWindow is too short")
+	}
+
+	for _, class := range o.ErrorClasses {
+		if !knownErrorClass(class) {
+			return fmt.Errorf("unknown retry error class [%s]", class)
+		}
+	}
+
+	return nil
+}
+
+func knownErrorClass(class string) bool {
+	for _, known := range retryErrorClasses {
+		if class == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Backoff before the given retry, counting from 1
+func (o *RetryOptions) backoff(retry int) time.Duration {
+	backoff := o.MaxBackoff
+
+	if retry < 32 {
+		if exponential := o.BaseBackoff << uint(retry-1); exponential > 0 && exponential < backoff {
+			backoff = exponential
+		}
+	}
+
+	jitter := time.Duration(o.Jitter * rand.Float64() * float64(backoff))
+
+	return backoff - jitter
+}
+
+// Whether sending the request twice has the same effect as sending it once
+func (o *RetryOptions) idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return o.RetryNonIdempotent || req.Header.Get(RetryIdempotencyKeyHeader) != ""
+}
+
+// Why the attempt should be retried, or empty when it should not
+func (o *RetryOptions) reason(resp *http.Response, err error) string {
+	if err == nil {
+		for _, code := range o.StatusCodes {
+			if resp.StatusCode == code {
+				return strconv.Itoa(code)
+			}
+		}
+
+		return ""
+	}
+
+	class := errorClass(err)
+
+	for _, retried := range o.ErrorClasses {
+		if class == retried {
+			return class
+		}
+	}
+
+	return ""
+}
+
+func errorClass(err error) string {
+	var netErr net.Error
+	var statusErr *StatusError
+
+	switch {
+	case errors.As(err, &statusErr):
+		return strconv.Itoa(statusErr.StatusCode)
+	case errors.Is(err, syscall.ECONNRESET):
+		return RetryOnReset
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return RetryOnRefused
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return RetryOnEOF
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return RetryOnTimeout
+	default:
+		return ""
+	}
+}
+
+// Retries made by the retry middleware. The attempts retried are also
+// recorded as attempts of their logical request.
+type RetryStats struct {
+	mutex   sync.Mutex
+	retries int64
+	retried int64
+	gaveUp  int64
+	denied  int64
+	unsafe  int64
+	reasons map[string]int64
+	backoff time.Duration
+	latency []time.Duration
+}
+
+func NewRetryStats() *RetryStats {
+	return &RetryStats{
+		reasons: make(map[string]int64),
+	}
+}
+
+func (s *RetryStats) recordRetry(reason string, backoff time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.retries++
+	s.reasons[reason]++
+	s.backoff += backoff
+}
+
+// Records a retry denied by the retry budget
+func (s *RetryStats) recordDenied() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.denied++
+}
+
+// Records a retry refused because the request is not idempotent
+func (s *RetryStats) recordNotIdempotent() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.unsafe++
+}
+
+// Records a request which needed at least one retry
+func (s *RetryStats) recordRetried(elapsed time.Duration, gaveUp bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.retried++
+	s.latency = append(s.latency, elapsed)
+
+	if gaveUp {
+		s.gaveUp++
+	}
+}
+
+func (s *RetryStats) report() *RetryReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	report := &RetryReport{
+		Retries:         s.retries,
+		RetriedRequests: s.retried,
+		GaveUp:          s.gaveUp,
+		BudgetDenied:    s.denied,
+		NotIdempotent:   s.unsafe,
+		Reasons:         make(map[string]int64, len(s.reasons)),
+		Backoff:         s.backoff,
+		RetriedLatency:  newPercentiles(s.latency),
+	}
+
+	for reason, count := range s.reasons {
+		report.Reasons[reason] = count
+	}
+
+	return report
+}
+
+// Retries round trips failing with one of the configured status codes or
+// error classes, within the budget unless it is nil. Requests with a body
+// are only retried when it can be rewound through GetBody, and requests
+// with a non-idempotent method when they carry an Idempotency-Key.
+func WithRetry(options RetryOptions, stats *RetryStats, budget *RetryBudget) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			startTime := time.Now()
+			request := logicalRequestFrom(req.Context())
+
+			if budget != nil {
+				budget.request()
+			}
+
+			for attempt := 1; ; attempt++ {
+				attemptTime := time.Now()
+				resp, err := next.RoundTrip(req)
+
+				reason := options.reason(resp, err)
+
+				retry := reason != "" && req.Context().Err() == nil && (req.Body == nil || req.GetBody != nil) &&
+					attempt < options.MaxAttempts
+
+				if retry && !options.idempotent(req) {
+					stats.recordNotIdempotent()
+					retry = false
+				}
+
+				if retry && budget != nil && !budget.withdraw() {
+					stats.recordDenied()
+					retry = false
+				}
+
+				if !retry {
+					if attempt > 1 {
+						stats.recordRetried(time.Since(startTime), reason != "")
+					}
+
+					return resp, err
+				}
+
+				if resp != nil {
+					io.Copy(ioutil.Discard, resp.Body)
+					resp.Body.Close()
+				}
+
+				if request != nil {
+					// A retried status fails the attempt like target_http does
+					attemptErr := err
+					if err == nil && failedStatus(resp.StatusCode) {
+						attemptErr = &StatusError{StatusCode: resp.StatusCode}
+					}
+
+					request.retried(time.Since(attemptTime), attemptErr)
+				}
+
+				backoff := options.backoff(attempt)
+				stats.recordRetry(reason, backoff)
+
+				if err := sleep(req.Context(), backoff); err != nil {
+					return nil, err
+				}
+
+				if req, err = rewind(req); err != nil {
+					return nil, err
+				}
+
+				if request != nil {
+					request.retrying()
+				}
+			}
+		})
+	}
+}
+
+// Copy of the request with a fresh body for another attempt
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = body
+
+	return req, nil
+}
+
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
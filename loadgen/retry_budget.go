@@ -0,0 +1,90 @@
+package loadgen
+
+import (
+	"sync"
+	"time"
+)
+
+// Retry budget settings
+const (
+	RetryBudgetWindow     = 10 * time.Second
+	RetryBudgetMinRetries = 10
+
+	// Resolution of the sliding window
+	retryBudgetBuckets = 10
+)
+
+// Retries allowed across all requests over a sliding window, so retries
+// can't multiply the load on a server that starts timing out
+type RetryBudget struct {
+	ratio      float64
+	minRetries int64
+	width      time.Duration
+
+	mutex   sync.Mutex
+	buckets [retryBudgetBuckets]retryBudgetBucket
+}
+
+type retryBudgetBucket struct {
+	epoch    int64
+	requests int64
+	retries  int64
+}
+
+func NewRetryBudget(options RetryOptions) *RetryBudget {
+	return &RetryBudget{
+		ratio:      options.Budget,
+		minRetries: int64(options.BudgetMinRetries),
+		width:      options.BudgetWindow / retryBudgetBuckets,
+	}
+}
+
+// Counts a request, earning it a share of a retry
+func (b *RetryBudget) request() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.bucket(time.Now()).requests++
+}
+
+// Spends a retry when the window still allows one
+func (b *RetryBudget) withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	epoch := b.epoch(now)
+
+	var requests, retries int64
+
+	for _, bucket := range b.buckets {
+		if epoch-bucket.epoch < retryBudgetBuckets {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+
+	if float64(retries+1) > float64(b.minRetries)+b.ratio*float64(requests) {
+		return false
+	}
+
+	b.bucket(now).retries++
+
+	return true
+}
+
+func (b *RetryBudget) epoch(now time.Time) int64 {
+	return now.UnixNano() / int64(b.width)
+}
+
+// Bucket of the current epoch, reset when it was last used a window ago
+func (b *RetryBudget) bucket(now time.Time) *retryBudgetBucket {
+	epoch := b.epoch(now)
+	bucket := &b.buckets[epoch%retryBudgetBuckets]
+
+	if bucket.epoch != epoch {
+		*bucket = retryBudgetBucket{epoch: epoch}
+	}
+
+	return bucket
+}
@@ -0,0 +1,72 @@
+package loadgen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		name       string
+		ratio      float64
+		minRetries int
+		requests   int
+
+		// Retries granted out of 100 asked for
+		granted int
+	}{
+		{"ratio", 0.1, 0, 100, 10},
+		{"half", 0.5, 0, 10, 5},
+		{"min retries without requests", 0.1, 5, 0, 5},
+		{"min retries on top of ratio", 0.1, 5, 100, 15},
+		{"min retries over ratio", 0.1, 20, 100, 30},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			budget := NewRetryBudget(RetryOptions{
+				Budget:           test.ratio,
+				BudgetWindow:     time.Hour,
+				BudgetMinRetries: test.minRetries,
+			})
+
+			for i := 0; i < test.requests; i++ {
+				budget.request()
+			}
+
+			granted := 0
+
+			for i := 0; i < 100; i++ {
+				if budget.withdraw() {
+					granted++
+				}
+			}
+
+			if granted != test.granted {
+				t.Errorf("withdraw() granted %d retries, expected %d", granted, test.granted)
+			}
+		})
+	}
+}
+
+func TestRetryBudgetWindow(t *testing.T) {
+	budget := NewRetryBudget(RetryOptions{
+		Budget:           0.1,
+		BudgetWindow:     50 * time.Millisecond,
+		BudgetMinRetries: 1,
+	})
+
+	if !budget.withdraw() {
+		t.Fatal("withdraw() denied the first retry")
+	}
+
+	if budget.withdraw() {
+		t.Fatal("withdraw() granted a retry over the budget")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if !budget.withdraw() {
+		t.Error("withdraw() denied a retry once the window slid past the previous ones")
+	}
+}
@@ -0,0 +1,282 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func testRetryOptions() RetryOptions {
+	options := DefaultRetryOptions()
+	options.Enabled = true
+	options.BaseBackoff = time.Millisecond
+	options.MaxBackoff = 4 * time.Millisecond
+	options.Jitter = 0
+
+	return options
+}
+
+// Round tripper answering with the queued status codes, 0 standing for a
+// connection reset
+func statusTransport(attempts *int, statusCodes ...int) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		statusCode := statusCodes[*attempts]
+		*attempts++
+
+		if statusCode == 0 {
+			return nil, &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+		}
+
+		return &http.Response{StatusCode: statusCode, Body: http.NoBody}, nil
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	options := testRetryOptions()
+
+	for retry, expected := range []time.Duration{1, 2, 4, 4, 4} {
+		if backoff := options.backoff(retry + 1); backoff != expected*time.Millisecond {
+			t.Errorf("backoff(%d) returned %v, expected %v", retry+1, backoff, expected*time.Millisecond)
+		}
+	}
+
+	options.Jitter = 1
+
+	for i := 0; i < 100; i++ {
+		if backoff := options.backoff(3); backoff < 0 || backoff > 4*time.Millisecond {
+			t.Fatalf("backoff(3) returned %v, expected at most 4ms", backoff)
+		}
+	}
+}
+
+func TestRetryOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(options *RetryOptions)
+		valid  bool
+	}{
+		{"defaults", func(options *RetryOptions) {}, true},
+		{"budget", func(options *RetryOptions) { options.Budget = 0.1 }, true},
+		{"budget window too short", func(options *RetryOptions) {
+			options.Budget = 0.1
+			options.BudgetWindow = 5 * time.Millisecond
+		}, false},
+		{"short window without budget", func(options *RetryOptions) { options.BudgetWindow = 5 * time.Millisecond }, true},
+		{"unknown error class", func(options *RetryOptions) { options.ErrorClasses = []string{"other"} }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := testRetryOptions()
+			test.update(&options)
+
+			if err := options.Validate(); (err == nil) != test.valid {
+				t.Errorf("Validate() returned error [%v], expected valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		class string
+	}{
+		{"reset", fmt.Errorf("read: %w", syscall.ECONNRESET), RetryOnReset},
+		{"refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), RetryOnRefused},
+		{"eof", io.ErrUnexpectedEOF, RetryOnEOF},
+		{"timeout", &net.DNSError{IsTimeout: true}, RetryOnTimeout},
+		{"status", &StatusError{StatusCode: 503}, "503"},
+		{"other", errors.New("tls: bad certificate"), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if class := errorClass(test.err); class != test.class {
+				t.Errorf("errorClass() returned [%s], expected [%s]", class, test.class)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCodes []int
+		statusCode  int
+		attempts    int
+		gaveUp      int64
+	}{
+		{"no retry", []int{200}, 200, 1, 0},
+		{"retried status", []int{503, 502, 200}, 200, 3, 0},
+		{"retried reset", []int{0, 200}, 200, 2, 0},
+		{"not retried status", []int{500}, 500, 1, 0},
+		{"gave up", []int{503, 503, 503}, 503, 3, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stats := NewRetryStats()
+			attempts := 0
+
+			transport := WithRetry(testRetryOptions(), stats, nil)(statusTransport(&attempts, test.statusCodes...))
+
+			req, _ := http.NewRequest(http.MethodGet, "https://localhost:8443/", nil)
+
+			resp, err := transport.RoundTrip(req)
+
+			statusCode := 0
+			if err == nil {
+				statusCode = resp.StatusCode
+			}
+
+			if statusCode != test.statusCode {
+				t.Errorf("RoundTrip() returned status %d, expected %d", statusCode, test.statusCode)
+			}
+
+			if attempts != test.attempts {
+				t.Errorf("RoundTrip() made %d attempts, expected %d", attempts, test.attempts)
+			}
+
+			report := stats.report()
+
+			if report.Retries != int64(test.attempts-1) || report.GaveUp != test.gaveUp {
+				t.Errorf("retries %d and gave up %d, expected %d and %d", report.Retries, report.GaveUp, test.attempts-1, test.gaveUp)
+			}
+		})
+	}
+}
+
+func TestWithRetryBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		rewound  bool
+		attempts int
+	}{
+		{"rewound", true, 2},
+		{"not rewindable", false, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+
+			transport := WithRetry(testRetryOptions(), NewRetryStats(), nil)(statusTransport(&attempts, 503, 200))
+
+			req, _ := http.NewRequest(http.MethodPut, "https://localhost:8443/", strings.NewReader("body"))
+
+			if !test.rewound {
+				req.GetBody = nil
+			}
+
+			transport.RoundTrip(req)
+
+			if attempts != test.attempts {
+				t.Errorf("RoundTrip() made %d attempts, expected %d", attempts, test.attempts)
+			}
+		})
+	}
+}
+
+func TestWithRetryBudget(t *testing.T) {
+	options := testRetryOptions()
+	options.Budget = 0.1
+	options.BudgetWindow = time.Hour
+	options.BudgetMinRetries = 1
+
+	stats := NewRetryStats()
+	attempts := 0
+
+	transport := WithRetry(options, stats, NewRetryBudget(options))(statusTransport(&attempts, 503, 503, 200))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://localhost:8443/", nil)
+
+	if resp, err := transport.RoundTrip(req); err != nil || resp.StatusCode != 503 {
+		t.Errorf("RoundTrip() returned %v, expected the 503 of the denied retry", err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("RoundTrip() made %d attempts, expected 2", attempts)
+	}
+
+	if denied := stats.report().BudgetDenied; denied != 1 {
+		t.Errorf("budget denied %d retries, expected 1", denied)
+	}
+}
+
+func TestWithRetryFailedAttempts(t *testing.T) {
+	stats := NewStats()
+	attempts := 0
+
+	transport := WithRetry(testRetryOptions(), NewRetryStats(), nil)(statusTransport(&attempts, 503, 200))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://localhost:8443/", nil)
+	req = req.WithContext(withLogicalRequest(req.Context(), stats.BeginRequest()))
+
+	if resp, err := transport.RoundTrip(req); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("RoundTrip() returned %v, expected the 200 of the retry", err)
+	}
+
+	report := stats.report()
+
+	if report.Attempts != 1 || report.AttemptFailures != 1 {
+		t.Errorf("recorded %d attempts and %d failures, expected the retried one failed", report.Attempts, report.AttemptFailures)
+	}
+
+	if report.ErrorClasses["503"] != 1 {
+		t.Errorf("recorded error classes %v, expected one 503", report.ErrorClasses)
+	}
+}
+
+func TestWithRetryIdempotency(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		idempotencyKey string
+		nonIdempotent  bool
+		attempts       int
+		notIdempotent  int64
+	}{
+		{"GET", http.MethodGet, "", false, 2, 0},
+		{"DELETE", http.MethodDelete, "", false, 2, 0},
+		{"POST", http.MethodPost, "", false, 1, 1},
+		{"POST with idempotency key", http.MethodPost, "key", false, 2, 0},
+		{"POST retried anyway", http.MethodPost, "", true, 2, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := testRetryOptions()
+			options.RetryNonIdempotent = test.nonIdempotent
+
+			stats := NewRetryStats()
+			attempts := 0
+
+			transport := WithRetry(options, stats, nil)(statusTransport(&attempts, 503, 200))
+
+			req, _ := http.NewRequest(test.method, "https://localhost:8443/", nil)
+
+			if test.idempotencyKey != "" {
+				req.Header.Set(RetryIdempotencyKeyHeader, test.idempotencyKey)
+			}
+
+			transport.RoundTrip(req)
+
+			if attempts != test.attempts {
+				t.Errorf("RoundTrip() made %d attempts, expected %d", attempts, test.attempts)
+			}
+
+			if notIdempotent := stats.report().NotIdempotent; notIdempotent != test.notIdempotent {
+				t.Errorf("%d retries not made for idempotency, expected %d", notIdempotent, test.notIdempotent)
+			}
+		})
+	}
+}
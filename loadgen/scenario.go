@@ -0,0 +1,513 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Fan-in policies
+const (
+	WaitAll    = "all"
+	WaitAny    = "any"
+	WaitQuorum = "quorum"
+)
+
+// Graph of steps executed by every user
+type Scenario struct {
+	Name  string  `json:"name"`
+	Steps []*Step `json:"steps"`
+
+	// End-to-end latency objective, breaches are blamed on the step that
+	// contributed the most to the iteration latency
+	SLO Duration `json:"slo"`
+}
+
+// Scenario step issuing FanOut parallel requests to Path
+type Step struct {
+	Name string `json:"name"`
+
+	// Path requested, {variable} placeholders are replaced by values
+	// extracted from upstream steps. Absolute URLs target other hosts.
+	Path string `json:"path"`
+
+	// Steps that must complete before this one starts. When no step of the
+	// scenario declares dependencies, steps run one after the other.
+	DependsOn []string `json:"dependsOn"`
+
+	// Variables extracted from the JSON response body, as variable -> field
+	Extract map[string]string `json:"extract"`
+
+	// Number of parallel sub-requests (defaults to 1)
+	FanOut int `json:"fanOut"`
+
+	// Fan-in policy: all (default), any or quorum
+	Wait string `json:"wait"`
+
+	// Sub-requests that must succeed when Wait is quorum
+	Quorum int `json:"quorum"`
+}
+
+// Reads a JSON scenario
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var scenario Scenario
+
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return nil, err
+	}
+
+	if err := scenario.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &scenario, nil
+}
+
+func (s *Scenario) Validate() error {
+	if len(s.Steps) == 0 {
+		return errors.New("scenario has no steps")
+	}
+
+	graph := false
+
+	for i, step := range s.Steps {
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step-%d", i)
+		}
+
+		if len(step.DependsOn) > 0 {
+			graph = true
+		}
+
+		if step.Path == "" {
+			return fmt.Errorf("step [%s] has no path", step.Name)
+		}
+
+		if step.FanOut == 0 {
+			step.FanOut = 1
+		}
+
+		if step.Wait == "" {
+			step.Wait = WaitAll
+		}
+
+		switch step.Wait {
+		case WaitAll, WaitAny:
+		case WaitQuorum:
+			if step.Quorum < 1 || step.Quorum > step.FanOut {
+				return fmt.Errorf("step [%s] quorum must be between 1 and fanOut", step.Name)
+			}
+		default:
+			return fmt.Errorf("step [%s] has unknown wait policy [%s]", step.Name, step.Wait)
+		}
+	}
+
+	// Plain sequences are chains where every step depends on the previous one
+	if !graph {
+		for i := 1; i < len(s.Steps); i++ {
+			s.Steps[i].DependsOn = []string{s.Steps[i-1].Name}
+		}
+	}
+
+	return s.checkGraph()
+}
+
+// Rejects duplicated names, unknown dependencies and cycles
+func (s *Scenario) checkGraph() error {
+	steps := make(map[string]*Step, len(s.Steps))
+
+	for _, step := range s.Steps {
+		if _, ok := steps[step.Name]; ok {
+			return fmt.Errorf("duplicated step [%s]", step.Name)
+		}
+
+		steps[step.Name] = step
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(s.Steps))
+
+	var visit func(step *Step) error
+
+	visit = func(step *Step) error {
+		switch state[step.Name] {
+		case visiting:
+			return fmt.Errorf("cycle through step [%s]", step.Name)
+		case visited:
+			return nil
+		}
+
+		state[step.Name] = visiting
+
+		for _, name := range step.DependsOn {
+			dependency, ok := steps[name]
+			if !ok {
+				return fmt.Errorf("step [%s] depends on unknown step [%s]", step.Name, name)
+			}
+
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+
+		state[step.Name] = visited
+
+		return nil
+	}
+
+	for _, step := range s.Steps {
+		if err := visit(step); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sub-requests that must succeed for the step to complete
+func (s *Step) required() int {
+	switch s.Wait {
+	case WaitAny:
+		return 1
+	case WaitQuorum:
+		return s.Quorum
+	default:
+		return s.FanOut
+	}
+}
+
+// Completion latencies of scenarios, their steps and dependency edges
+type ScenarioStats struct {
+	mutex sync.Mutex
+
+	iterations []time.Duration
+	failures   int64
+
+	steps map[string]*StepStats
+
+	// Time a step waited on each dependency after it completed,
+	// zero for the dependency that was on the critical path
+	edges map[string][]time.Duration
+
+	// Latency budget attribution of the iterations, failed ones up to the
+	// step which failed
+	attributions   map[string]*StepAttribution
+	attributedTime time.Duration
+	breaches       int64
+}
+
+type StepStats struct {
+	completions []time.Duration
+	failures    int64
+
+	// Sub-requests cancelled once the fan-in policy was satisfied
+	cancelled int64
+
+	// Step not run because a dependency failed
+	skipped int64
+}
+
+func NewScenarioStats() *ScenarioStats {
+	return &ScenarioStats{
+		steps:        make(map[string]*StepStats),
+		edges:        make(map[string][]time.Duration),
+		attributions: make(map[string]*StepAttribution),
+	}
+}
+
+func (s *ScenarioStats) step(name string) *StepStats {
+	stats, ok := s.steps[name]
+	if !ok {
+		stats = &StepStats{}
+		s.steps[name] = stats
+	}
+
+	return stats
+}
+
+func (s *ScenarioStats) recordStep(name string, elapsed time.Duration, cancelled int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := s.step(name)
+	stats.cancelled += int64(cancelled)
+
+	if err != nil {
+		stats.failures++
+		return
+	}
+
+	stats.completions = append(stats.completions, elapsed)
+}
+
+func (s *ScenarioStats) recordSkipped(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.step(name).skipped++
+}
+
+func (s *ScenarioStats) recordEdge(from, to string, wait time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	edge := from + " -> " + to
+	s.edges[edge] = append(s.edges[edge], wait)
+}
+
+func (s *ScenarioStats) recordIteration(elapsed time.Duration, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		s.failures++
+		return
+	}
+
+	s.iterations = append(s.iterations, elapsed)
+}
+
+func (s *ScenarioStats) report() *ScenarioReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	report := &ScenarioReport{
+		Completed:   int64(len(s.iterations)),
+		Failed:      s.failures,
+		Latency:     newPercentiles(s.iterations),
+		Steps:       make(map[string]*StepReport, len(s.steps)),
+		Edges:       make(map[string]Percentiles, len(s.edges)),
+		SLOBreaches: s.breaches,
+	}
+
+	for name, stats := range s.steps {
+		report.Steps[name] = &StepReport{
+			Latency:   newPercentiles(stats.completions),
+			Failed:    stats.failures,
+			Cancelled: stats.cancelled,
+			Skipped:   stats.skipped,
+		}
+	}
+
+	for edge, waits := range s.edges {
+		report.Edges[edge] = newPercentiles(waits)
+	}
+
+	s.reportAttribution(report)
+
+	return report
+}
+
+// Outcome of one step within a scenario iteration
+type stepResult struct {
+	done       chan struct{}
+	startTime  time.Time
+	finishTime time.Time
+	err        error
+}
+
+// Executes the scenario graph, every step starting as soon as all its
+// dependencies completed
+func (t *LoadTest) runScenario(ctx context.Context, logger *log.Entry) {
+	startTime := time.Now()
+
+	results := make(map[string]*stepResult, len(t.scenario.Steps))
+
+	for _, step := range t.scenario.Steps {
+		results[step.Name] = &stepResult{done: make(chan struct{})}
+	}
+
+	variables := &scenarioVariables{values: make(map[string]string)}
+
+	for _, step := range t.scenario.Steps {
+		go func(step *Step) {
+			result := results[step.Name]
+			defer close(result.done)
+
+			defer func() {
+				if value := recover(); value != nil {
+					result.err = t.recordPanic(logger, value)
+					result.finishTime = time.Now()
+				}
+			}()
+
+			for _, name := range step.DependsOn {
+				<-results[name].done
+
+				if results[name].err != nil {
+					result.err = fmt.Errorf("dependency [%s] failed", name)
+					result.finishTime = time.Now()
+					t.scenarioStats.recordSkipped(step.Name)
+					return
+				}
+			}
+
+			result.startTime = time.Now()
+
+			for _, name := range step.DependsOn {
+				t.scenarioStats.recordEdge(name, step.Name, result.startTime.Sub(results[name].finishTime))
+			}
+
+			result.err = t.runStep(ctx, logger, step, variables)
+			result.finishTime = time.Now()
+		}(step)
+	}
+
+	var err error
+
+	for _, step := range t.scenario.Steps {
+		<-results[step.Name].done
+
+		if stepErr := results[step.Name].err; stepErr != nil && err == nil {
+			err = stepErr
+
+			logger.WithFields(log.Fields{
+				"Step": step.Name,
+			}).Printf("Scenario failed with error [%v]\n", err)
+		}
+	}
+
+	elapsed := time.Since(startTime)
+
+	t.scenarioStats.recordIteration(elapsed, err)
+	t.scenarioStats.recordAttribution(t.scenario, results, elapsed)
+}
+
+// Values extracted by the steps of one scenario iteration
+type scenarioVariables struct {
+	mutex  sync.Mutex
+	values map[string]string
+}
+
+func (v *scenarioVariables) expand(path string) string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	for name, value := range v.values {
+		path = strings.Replace(path, "{"+name+"}", value, -1)
+	}
+
+	return path
+}
+
+// Stores the extracted fields of a JSON response body
+func (v *scenarioVariables) extract(extract map[string]string, body string) error {
+	if len(extract) == 0 {
+		return nil
+	}
+
+	var fields map[string]interface{}
+
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return fmt.Errorf("extracting variables failed with error: %v", err)
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	for name, field := range extract {
+		value, ok := fields[field]
+		if !ok {
+			return fmt.Errorf("field [%s] not found in response", field)
+		}
+
+		v.values[name] = fmt.Sprint(value)
+	}
+
+	return nil
+}
+
+// Cause of the cancellation of the sub-requests still in flight once the
+// fan-in policy of their step is met
+var errFannedIn = errors.New("fan-in policy met")
+
+type subRequestResult struct {
+	response *Response
+	err      error
+}
+
+// Fans out the step sub-requests and waits for the fan-in policy
+func (t *LoadTest) runStep(ctx context.Context, logger *log.Entry, step *Step, variables *scenarioVariables) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	path := variables.expand(step.Path)
+
+	startTime := time.Now()
+
+	results := make(chan subRequestResult, step.FanOut)
+	spawn := t.safeGo(logger)
+
+	for i := 0; i < step.FanOut; i++ {
+		requestTime := time.Now()
+
+		spawn(func() {
+			response, err := t.subRequest(ctx, logger, path)
+			results <- subRequestResult{response: response, err: err}
+		}, func(err error) {
+			t.failPanicked(requestTime, err)
+			results <- subRequestResult{err: err}
+		})
+	}
+
+	required := step.required()
+	succeeded, failed := 0, 0
+
+	var response *Response
+	var err error
+
+	for succeeded < required && failed <= step.FanOut-required {
+		if result := <-results; result.err != nil {
+			failed++
+			err = result.err
+		} else {
+			succeeded++
+
+			if response == nil {
+				response = result.response
+			}
+		}
+	}
+
+	elapsed := time.Since(startTime)
+
+	// Waits for the stragglers, so none outlives the step and the run
+	cancel(errFannedIn)
+
+	for i := succeeded + failed; i < step.FanOut; i++ {
+		<-results
+	}
+
+	if succeeded >= required {
+		err = variables.extract(step.Extract, response.Body)
+	}
+
+	t.scenarioStats.recordStep(step.Name, elapsed, step.FanOut-succeeded-failed, err)
+
+	return err
+}
+
+// Sends a sub-request like any request of a flat run. Stragglers cancelled
+// by the fan-in are only counted as cancelled, not as failures.
+func (t *LoadTest) subRequest(ctx context.Context, logger *log.Entry, path string) (*Response, error) {
+	return t.sendRequest(ctx, logger, func(ctx context.Context) (*Response, error) {
+		return t.do(ctx, logger, path)
+	})
+}
@@ -0,0 +1,249 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Target answering each request with the next queued outcome: ok, fail,
+// panic, or block until the request is cancelled
+type outcomeTarget struct {
+	mutex    sync.Mutex
+	outcomes []string
+	paths    []string
+}
+
+func (o *outcomeTarget) Do(ctx context.Context, resource string) (*Response, error) {
+	o.mutex.Lock()
+	outcome := o.outcomes[0]
+	o.outcomes = o.outcomes[1:]
+	o.paths = append(o.paths, resource)
+	o.mutex.Unlock()
+
+	switch outcome {
+	case "fail":
+		return nil, errors.New("failed")
+	case "panic":
+		panic("bug")
+	case "block":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return &Response{StatusCode: http.StatusOK, Body: `{"id":7}`}, nil
+}
+
+func (o *outcomeTarget) Close() error {
+	return nil
+}
+
+func newScenarioLoadTest(outcomes ...string) *LoadTest {
+	return &LoadTest{
+		options:       &Options{},
+		target:        &outcomeTarget{outcomes: outcomes},
+		stats:         NewStats(),
+		scenarioStats: NewScenarioStats(),
+	}
+}
+
+func TestScenarioValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []*Step
+		err   bool
+	}{
+		{"defaults", []*Step{{Path: "/"}}, false},
+		{"no steps", nil, true},
+		{"no path", []*Step{{Name: "a"}}, true},
+		{"quorum within fan-out", []*Step{{Path: "/", FanOut: 3, Wait: WaitQuorum, Quorum: 3}}, false},
+		{"quorum zero", []*Step{{Path: "/", FanOut: 3, Wait: WaitQuorum}}, true},
+		{"quorum over fan-out", []*Step{{Path: "/", FanOut: 3, Wait: WaitQuorum, Quorum: 4}}, true},
+		{"unknown policy", []*Step{{Path: "/", Wait: "some"}}, true},
+		{"duplicated step", []*Step{{Name: "a", Path: "/"}, {Name: "a", Path: "/"}}, true},
+		{"unknown dependency", []*Step{{Name: "a", Path: "/", DependsOn: []string{"b"}}}, true},
+		{"cycle", []*Step{{Name: "a", Path: "/", DependsOn: []string{"b"}}, {Name: "b", Path: "/", DependsOn: []string{"a"}}}, true},
+		{"graph", []*Step{{Name: "a", Path: "/"}, {Name: "b", Path: "/", DependsOn: []string{"a"}}, {Name: "c", Path: "/", DependsOn: []string{"a"}}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scenario := &Scenario{Steps: test.steps}
+
+			if err := scenario.Validate(); (err != nil) != test.err {
+				t.Errorf("Validate() returned %v, expected error %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestScenarioValidateDefaults(t *testing.T) {
+	scenario := &Scenario{Steps: []*Step{{Path: "/"}}}
+
+	if err := scenario.Validate(); err != nil {
+		t.Fatalf("Validate() returned %v, expected nil", err)
+	}
+
+	step := scenario.Steps[0]
+
+	if step.Name != "step-0" || step.FanOut != 1 || step.Wait != WaitAll {
+		t.Errorf("Validate() defaulted to %+v, expected step-0 with fanOut 1 and wait all", step)
+	}
+}
+
+func TestScenarioValidateSequence(t *testing.T) {
+	scenario := &Scenario{Steps: []*Step{{Name: "a", Path: "/"}, {Name: "b", Path: "/"}, {Name: "c", Path: "/"}}}
+
+	if err := scenario.Validate(); err != nil {
+		t.Fatalf("Validate() returned %v, expected nil", err)
+	}
+
+	for i, expected := range [][]string{nil, {"a"}, {"b"}} {
+		if dependsOn := scenario.Steps[i].DependsOn; !reflect.DeepEqual(dependsOn, expected) {
+			t.Errorf("Validate() chained step %v to %v, expected %v", i, dependsOn, expected)
+		}
+	}
+}
+
+func TestStepRequired(t *testing.T) {
+	tests := []struct {
+		name     string
+		step     Step
+		required int
+	}{
+		{"all", Step{FanOut: 3, Wait: WaitAll}, 3},
+		{"any", Step{FanOut: 3, Wait: WaitAny}, 1},
+		{"quorum", Step{FanOut: 3, Wait: WaitQuorum, Quorum: 2}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if required := test.step.required(); required != test.required {
+				t.Errorf("required() returned %v, expected %v", required, test.required)
+			}
+		})
+	}
+}
+
+func TestRunStep(t *testing.T) {
+	tests := []struct {
+		name      string
+		step      Step
+		outcomes  []string
+		err       bool
+		failures  int64
+		cancelled int64
+	}{
+		{"all succeeded", Step{FanOut: 3, Wait: WaitAll}, []string{"ok", "ok", "ok"}, false, 0, 0},
+		{"all with a failure", Step{FanOut: 3, Wait: WaitAll}, []string{"fail", "block", "block"}, true, 1, 2},
+		{"any", Step{FanOut: 3, Wait: WaitAny}, []string{"ok", "block", "block"}, false, 0, 2},
+		{"quorum met", Step{FanOut: 3, Wait: WaitQuorum, Quorum: 2}, []string{"ok", "ok", "block"}, false, 0, 1},
+		{"quorum missed", Step{FanOut: 3, Wait: WaitQuorum, Quorum: 2}, []string{"fail", "fail", "block"}, true, 2, 1},
+		{"panicked", Step{FanOut: 3, Wait: WaitAll}, []string{"panic", "block", "block"}, true, 1, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTest := newScenarioLoadTest(test.outcomes...)
+
+			step := test.step
+			step.Name = "step"
+			step.Path = "/"
+
+			err := loadTest.runStep(context.Background(), log.NewEntry(log.StandardLogger()), &step, &scenarioVariables{values: make(map[string]string)})
+			if (err != nil) != test.err {
+				t.Errorf("runStep() returned %v, expected error %v", err, test.err)
+			}
+
+			stats := loadTest.scenarioStats.steps["step"]
+
+			if stats.cancelled != test.cancelled {
+				t.Errorf("runStep() cancelled %v sub-requests, expected %v", stats.cancelled, test.cancelled)
+			}
+
+			// The stragglers are done once runStep returns
+			report := loadTest.stats.report()
+
+			if report.Failures != test.failures || report.Cancelled != test.cancelled {
+				t.Errorf("Report() has %v failures and %v cancelled, expected %v and %v", report.Failures, report.Cancelled, test.failures, test.cancelled)
+			}
+		})
+	}
+}
+
+func TestScenarioVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		extract map[string]string
+		body    string
+		path    string
+		err     bool
+	}{
+		{"nothing extracted", nil, "not json", "/items/{id}", false},
+		{"extracted", map[string]string{"id": "id"}, `{"id":7}`, "/items/7", false},
+		{"missing field", map[string]string{"id": "key"}, `{"id":7}`, "/items/{id}", true},
+		{"invalid body", map[string]string{"id": "id"}, "not json", "/items/{id}", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			variables := &scenarioVariables{values: make(map[string]string)}
+
+			if err := variables.extract(test.extract, test.body); (err != nil) != test.err {
+				t.Errorf("extract() returned %v, expected error %v", err, test.err)
+			}
+
+			if path := variables.expand("/items/{id}"); path != test.path {
+				t.Errorf("expand() returned %v, expected %v", path, test.path)
+			}
+		})
+	}
+}
+
+func TestRunScenario(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []string
+		paths    []string
+		failed   int64
+		skipped  int64
+	}{
+		{"completed", []string{"ok", "ok"}, []string{"/items", "/items/7"}, 0, 0},
+		{"dependency failed", []string{"fail"}, []string{"/items"}, 1, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTest := newScenarioLoadTest(test.outcomes...)
+			loadTest.scenario = &Scenario{Steps: []*Step{
+				{Name: "list", Path: "/items", Extract: map[string]string{"id": "id"}},
+				{Name: "get", Path: "/items/{id}"},
+			}}
+
+			if err := loadTest.scenario.Validate(); err != nil {
+				t.Fatalf("Validate() returned %v, expected nil", err)
+			}
+
+			loadTest.runScenario(context.Background(), log.NewEntry(log.StandardLogger()))
+
+			target := loadTest.target.(*outcomeTarget)
+
+			if !reflect.DeepEqual(target.paths, test.paths) {
+				t.Errorf("runScenario() requested %v, expected %v", target.paths, test.paths)
+			}
+
+			if failed := loadTest.scenarioStats.failures; failed != test.failed {
+				t.Errorf("runScenario() failed %v iterations, expected %v", failed, test.failed)
+			}
+
+			if skipped := loadTest.scenarioStats.step("get").skipped; skipped != test.skipped {
+				t.Errorf("runScenario() skipped %v steps, expected %v", skipped, test.skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package loadgen
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Emits the intended send time of every open-loop request
+func schedule(ctx context.Context, rate float64, total int, pending int) <-chan time.Time {
+	// Only as many pending requests as there are workers, so a scheduler
+	// that falls behind shows up as lag instead of an unbounded queue
+	ticks := make(chan time.Time, pending)
+
+	go func() {
+		defer close(ticks)
+
+		interval := time.Duration(float64(time.Second) / rate)
+		startTime := time.Now()
+
+		for i := 0; i < total; i++ {
+			intended := startTime.Add(time.Duration(i) * interval)
+
+			select {
+			case <-time.After(time.Until(intended)):
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case ticks <- intended:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ticks
+}
+
+// Executes scheduled requests, shedding the ones that are too stale, until
+// stop is closed
+func (t *LoadTest) runOpenLoop(ctx context.Context, stop <-chan struct{}, logger *log.Entry, ticks <-chan time.Time) {
+	cursor := t.newRangeCursor()
+
+	for intended := range ticks {
+		if stopped(stop) || ctx.Err() != nil {
+			return
+		}
+
+		lag := time.Since(intended)
+
+		if t.options.MaxSchedulingLag > 0 && lag > t.options.MaxSchedulingLag {
+			t.stats.Shed(lag)
+			continue
+		}
+
+		t.stats.RecordLag(lag)
+		t.executeSafely(ctx, logger, cursor)
+	}
+}
@@ -0,0 +1,155 @@
+package loadgen
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Request signing settings
+const (
+	SigningSignatureHeader = "X-Signature"
+	SigningDateHeader      = "X-Date"
+	SigningBodyHashHeader  = "X-Content-Sha256"
+)
+
+// Signed components besides header names
+const (
+	SignMethod   = "method"
+	SignPath     = "path"
+	SignQuery    = "query"
+	SignHost     = "host"
+	SignDate     = "date"
+	SignBodyHash = "body-sha256"
+)
+
+// Signs every request with HMAC-SHA256
+type SigningOptions struct {
+	Enabled bool
+	Secret  string
+	KeyID   string
+
+	// Components covered by the signature, in order: method, path, query,
+	// host, date, body-sha256 or the name of any request header
+	Components []string
+
+	SignatureHeader string
+	DateHeader      string
+	BodyHashHeader  string
+}
+
+func DefaultSigningOptions() SigningOptions {
+	return SigningOptions{
+		Components:      []string{SignMethod, SignPath, SignQuery, SignHost, SignDate, SignBodyHash},
+		SignatureHeader: SigningSignatureHeader,
+		DateHeader:      SigningDateHeader,
+		BodyHashHeader:  SigningBodyHashHeader,
+	}
+}
+
+func (o *SigningOptions) Validate() error {
+	if !o.Enabled {
+		return nil
+	}
+
+	if o.Secret == "" {
+		return errors.New("signing secret can not be empty")
+	}
+
+	if len(o.Components) == 0 {
+		return errors.New("signing requires at least one component")
+	}
+
+	return nil
+}
+
+// Adds the date, body hash and signature headers to every request
+func WithSigning(options SigningOptions) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			// RoundTrippers must not modify the caller's request
+			req = req.Clone(req.Context())
+
+			req.Header.Set(options.DateHeader, time.Now().UTC().Format(time.RFC3339))
+
+			bodyHash, err := hashBody(req)
+			if err != nil {
+				return nil, err
+			}
+
+			req.Header.Set(options.BodyHashHeader, bodyHash)
+
+			canonical := canonicalRequest(req, options)
+
+			mac := hmac.New(sha256.New, []byte(options.Secret))
+			mac.Write([]byte(canonical))
+			signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+			req.Header.Set(options.SignatureHeader, fmt.Sprintf(`keyId="%s",algorithm="hmac-sha256",components="%s",signature="%s"`,
+				options.KeyID, strings.Join(options.Components, " "), signature))
+
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// One "component:value" line per signed component
+func canonicalRequest(req *http.Request, options SigningOptions) string {
+	var builder strings.Builder
+
+	for _, component := range options.Components {
+		var value string
+
+		switch strings.ToLower(component) {
+		case SignMethod:
+			value = req.Method
+		case SignPath:
+			value = req.URL.EscapedPath()
+		case SignQuery:
+			value = req.URL.Query().Encode()
+		case SignHost:
+			value = req.URL.Host
+		case SignDate:
+			value = req.Header.Get(options.DateHeader)
+		case SignBodyHash:
+			value = req.Header.Get(options.BodyHashHeader)
+		default:
+			value = req.Header.Get(component)
+		}
+
+		builder.WriteString(strings.ToLower(component))
+		builder.WriteString(":")
+		builder.WriteString(value)
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+// Hex SHA-256 of the body, which is replaced by a re-readable copy
+func hashBody(req *http.Request) (string, error) {
+	var body []byte
+
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+
+		body = data
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	sum := sha256.Sum256(body)
+
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,128 @@
+package loadgen
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		components []string
+		canonical  string
+	}{
+		{"method and path", []string{SignMethod, SignPath}, "method:POST\npath:/items\n"},
+		{"query and host", []string{SignQuery, SignHost}, "query:a=1&b=2\nhost:localhost:8443\n"},
+		{"header", []string{"X-Tenant"}, "x-tenant:acme\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "https://localhost:8443/items?b=2&a=1", nil)
+			req.Header.Set("X-Tenant", "acme")
+
+			options := DefaultSigningOptions()
+			options.Components = test.components
+
+			if canonical := canonicalRequest(req, options); canonical != test.canonical {
+				t.Errorf("canonicalRequest() returned %q, expected %q", canonical, test.canonical)
+			}
+		})
+	}
+}
+
+func TestHashBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		hash string
+	}{
+		{"empty", "", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"body", "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "https://localhost:8443/", strings.NewReader(test.body))
+
+			hash, err := hashBody(req)
+			if err != nil {
+				t.Fatalf("hashBody() returned %v, expected nil", err)
+			}
+
+			if hash != test.hash {
+				t.Errorf("hashBody() returned %v, expected %v", hash, test.hash)
+			}
+
+			// The body must still be readable by the next round tripper
+			if body, _ := ioutil.ReadAll(req.Body); string(body) != test.body {
+				t.Errorf("hashBody() left body %q, expected %q", body, test.body)
+			}
+		})
+	}
+}
+
+func TestWithSigning(t *testing.T) {
+	options := DefaultSigningOptions()
+	options.Enabled = true
+	options.Secret = "secret"
+	options.KeyID = "key"
+	options.Components = []string{SignMethod, SignPath, SignDate}
+
+	var signed *http.Request
+
+	transport := WithSigning(options)(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		signed = req
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://localhost:8443/items", nil)
+
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() returned %v, expected nil", err)
+	}
+
+	if req.Header.Get(options.SignatureHeader) != "" {
+		t.Errorf("RoundTrip() modified the caller's request")
+	}
+
+	mac := hmac.New(sha256.New, []byte(options.Secret))
+	mac.Write([]byte("method:GET\npath:/items\ndate:" + signed.Header.Get(options.DateHeader) + "\n"))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	expected := `keyId="key",algorithm="hmac-sha256",components="method path date",signature="` + signature + `"`
+
+	if header := signed.Header.Get(options.SignatureHeader); header != expected {
+		t.Errorf("RoundTrip() signed with %v, expected %v", header, expected)
+	}
+}
+
+func TestSigningOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		secret     string
+		components []string
+		err        bool
+	}{
+		{"disabled", false, "", nil, false},
+		{"valid", true, "secret", []string{SignMethod}, false},
+		{"no secret", true, "", []string{SignMethod}, true},
+		{"no components", true, "secret", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := SigningOptions{Enabled: test.enabled, Secret: test.secret, Components: test.components}
+
+			if err := options.Validate(); (err != nil) != test.err {
+				t.Errorf("Validate() returned %v, expected error %v", err, test.err)
+			}
+		})
+	}
+}
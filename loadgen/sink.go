@@ -0,0 +1,269 @@
+package loadgen
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sink settings
+const (
+	SinkBuffer = 1024
+)
+
+// What a sink does with records when its buffer is full
+const (
+	SinkPolicyDrop  = "drop"
+	SinkPolicyBlock = "block"
+)
+
+// One attempt, streamed from the workers to the sinks
+type Record struct {
+	Time       time.Time     `json:"time"`
+	Elapsed    time.Duration `json:"elapsed"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Bytes      int           `json:"bytes"`
+	Error      string        `json:"error,omitempty"`
+}
+
+func newRecord(elapsed time.Duration, response *Response, err error) Record {
+	record := Record{
+		Time:    time.Now().Add(-elapsed),
+		Elapsed: elapsed,
+	}
+
+	if response != nil {
+		record.StatusCode = response.StatusCode
+		record.Bytes = len(response.Body)
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	return record
+}
+
+// Destination of the records, e.g. a file or a remote metrics push.
+// Write is only called from the sink's own goroutine.
+type Sink interface {
+	Write(record Record) error
+	Close() error
+}
+
+// Sink with its own bounded buffer, so it only slows down the load test
+// when its policy is block
+type SinkConfig struct {
+	Name string
+	Sink Sink
+
+	// Records buffered for the sink (SinkBuffer when 0)
+	Buffer int
+
+	// drop or block when the buffer is full
+	Policy string
+}
+
+func (c *SinkConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("Sink name can not be empty")
+	}
+
+	if c.Sink == nil {
+		return fmt.Errorf("Sink [%s] can not be nil", c.Name)
+	}
+
+	if c.Buffer < 0 {
+		return fmt.Errorf("Sink [%s] buffer can not be negative", c.Name)
+	}
+
+	switch c.Policy {
+	case SinkPolicyDrop, SinkPolicyBlock:
+	default:
+		return fmt.Errorf("unknown sink policy [%s]", c.Policy)
+	}
+
+	return nil
+}
+
+func validateSinks(sinks []SinkConfig) error {
+	names := make(map[string]bool, len(sinks))
+
+	for i := range sinks {
+		if err := sinks[i].Validate(); err != nil {
+			return err
+		}
+
+		if names[sinks[i].Name] {
+			return fmt.Errorf("duplicate sink [%s]", sinks[i].Name)
+		}
+
+		names[sinks[i].Name] = true
+	}
+
+	return nil
+}
+
+// Streams records from the workers to the aggregator, which fans them out to
+// the sinks according to their policy. The workers never drop records, so
+// a record only goes missing in the sink that reports it as dropped.
+type pipeline struct {
+	records chan Record
+	sinks   []*sinkRunner
+	done    chan struct{}
+}
+
+type sinkRunner struct {
+	config  SinkConfig
+	records chan Record
+	done    chan struct{}
+
+	written int64
+	dropped int64
+	errors  int64
+
+	// Only updated by the aggregator
+	blocked time.Duration
+}
+
+func newPipeline(sinks []SinkConfig) *pipeline {
+	p := &pipeline{
+		records: make(chan Record, SinkBuffer),
+		done:    make(chan struct{}),
+	}
+
+	for _, config := range sinks {
+		buffer := config.Buffer
+		if buffer == 0 {
+			buffer = SinkBuffer
+		}
+
+		runner := &sinkRunner{
+			config:  config,
+			records: make(chan Record, buffer),
+			done:    make(chan struct{}),
+		}
+
+		go runner.run()
+
+		p.sinks = append(p.sinks, runner)
+	}
+
+	go p.aggregate()
+
+	return p
+}
+
+func (p *pipeline) publish(record Record) {
+	p.records <- record
+}
+
+func (p *pipeline) aggregate() {
+	defer close(p.done)
+
+	for record := range p.records {
+		for _, sink := range p.sinks {
+			sink.deliver(record)
+		}
+	}
+
+	for _, sink := range p.sinks {
+		close(sink.records)
+	}
+}
+
+// Waits until every sink wrote or dropped all records, then closes them
+func (p *pipeline) close() {
+	close(p.records)
+	<-p.done
+
+	for _, sink := range p.sinks {
+		<-sink.done
+
+		if err := sink.config.Sink.Close(); err != nil {
+			atomic.AddInt64(&sink.errors, 1)
+		}
+	}
+}
+
+func (p *pipeline) report() map[string]*SinkReport {
+	report := make(map[string]*SinkReport, len(p.sinks))
+
+	for _, sink := range p.sinks {
+		report[sink.config.Name] = &SinkReport{
+			Policy:  sink.config.Policy,
+			Written: atomic.LoadInt64(&sink.written),
+			Dropped: atomic.LoadInt64(&sink.dropped),
+			Errors:  atomic.LoadInt64(&sink.errors),
+			Blocked: sink.blocked,
+		}
+	}
+
+	return report
+}
+
+func (s *sinkRunner) deliver(record Record) {
+	select {
+	case s.records <- record:
+		return
+	default:
+	}
+
+	if s.config.Policy == SinkPolicyDrop {
+		atomic.AddInt64(&s.dropped, 1)
+		return
+	}
+
+	startTime := time.Now()
+	s.records <- record
+	s.blocked += time.Since(startTime)
+}
+
+func (s *sinkRunner) run() {
+	defer close(s.done)
+
+	for record := range s.records {
+		if err := s.config.Sink.Write(record); err != nil {
+			atomic.AddInt64(&s.errors, 1)
+			continue
+		}
+
+		atomic.AddInt64(&s.written, 1)
+	}
+}
+
+// Writes one JSON record per line
+type JSONLinesSink struct {
+	mutex   sync.Mutex
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+// The writer is flushed, but not closed, when the sink is closed
+func NewJSONLinesSink(writer io.Writer) *JSONLinesSink {
+	buffered := bufio.NewWriter(writer)
+
+	return &JSONLinesSink{
+		writer:  buffered,
+		encoder: json.NewEncoder(buffered),
+	}
+}
+
+func (s *JSONLinesSink) Write(record Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.encoder.Encode(record)
+}
+
+func (s *JSONLinesSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writer.Flush()
+}
@@ -0,0 +1,143 @@
+package loadgen
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sink whose writes wait until it is released
+type gatedSink struct {
+	release chan struct{}
+}
+
+func (s *gatedSink) Write(record Record) error {
+	<-s.release
+	return nil
+}
+
+func (s *gatedSink) Close() error {
+	return nil
+}
+
+func TestPipelineDrop(t *testing.T) {
+	sink := &gatedSink{release: make(chan struct{})}
+	p := newPipeline([]SinkConfig{{Name: "slow", Sink: sink, Buffer: 1, Policy: SinkPolicyDrop}})
+
+	for i := 0; i < 10; i++ {
+		p.publish(Record{})
+	}
+
+	closed := make(chan struct{})
+
+	go func() {
+		p.close()
+		close(closed)
+	}()
+
+	// The aggregator never waits on a dropping sink
+	<-p.done
+	close(sink.release)
+	<-closed
+
+	report := p.report()["slow"]
+
+	if report.Written+report.Dropped != 10 {
+		t.Errorf("pipeline wrote %d and dropped %d records, expected 10 in total", report.Written, report.Dropped)
+	}
+
+	// One record in the buffer and at most one being written
+	if report.Dropped < 8 {
+		t.Errorf("pipeline dropped %d records, expected at least 8", report.Dropped)
+	}
+}
+
+func TestPipelineBlock(t *testing.T) {
+	sink := &gatedSink{release: make(chan struct{})}
+	p := newPipeline([]SinkConfig{{Name: "slow", Sink: sink, Buffer: 1, Policy: SinkPolicyBlock}})
+
+	for i := 0; i < 10; i++ {
+		p.publish(Record{})
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(sink.release)
+	}()
+
+	p.close()
+
+	report := p.report()["slow"]
+
+	if report.Written != 10 || report.Dropped != 0 {
+		t.Errorf("pipeline wrote %d and dropped %d records, expected 10 and 0", report.Written, report.Dropped)
+	}
+
+	if report.Blocked <= 0 {
+		t.Errorf("pipeline blocked for %v, expected some time", report.Blocked)
+	}
+}
+
+func TestValidateSinks(t *testing.T) {
+	sink := &gatedSink{}
+
+	tests := []struct {
+		name  string
+		sinks []SinkConfig
+		valid bool
+	}{
+		{"valid", []SinkConfig{{Name: "a", Sink: sink, Policy: SinkPolicyDrop}, {Name: "b", Sink: sink, Policy: SinkPolicyBlock}}, true},
+		{"no name", []SinkConfig{{Sink: sink, Policy: SinkPolicyDrop}}, false},
+		{"no sink", []SinkConfig{{Name: "a", Policy: SinkPolicyDrop}}, false},
+		{"negative buffer", []SinkConfig{{Name: "a", Sink: sink, Buffer: -1, Policy: SinkPolicyDrop}}, false},
+		{"unknown policy", []SinkConfig{{Name: "a", Sink: sink, Policy: "retry"}}, false},
+		{"duplicated", []SinkConfig{{Name: "a", Sink: sink, Policy: SinkPolicyDrop}, {Name: "a", Sink: sink, Policy: SinkPolicyDrop}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateSinks(test.sinks)
+
+			if test.valid && err != nil {
+				t.Errorf("validateSinks() returned error [%v], expected none", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("validateSinks() returned no error, expected one")
+			}
+		})
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	var buffer bytes.Buffer
+
+	sink := NewJSONLinesSink(&buffer)
+
+	sink.Write(newRecord(time.Second, &Response{StatusCode: 200, Body: "pong"}, nil))
+	sink.Write(newRecord(time.Second, nil, errors.New("timeout")))
+
+	if buffer.Len() != 0 {
+		t.Errorf("sink wrote %d bytes before being closed, expected them buffered", buffer.Len())
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() returned %v, expected nil", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("sink wrote %d lines, expected 2", len(lines))
+	}
+
+	if !strings.Contains(lines[0], `"status_code":200`) || !strings.Contains(lines[0], `"bytes":4`) {
+		t.Errorf("sink wrote %s, expected the status code and bytes", lines[0])
+	}
+
+	if !strings.Contains(lines[1], `"error":"timeout"`) {
+		t.Errorf("sink wrote %s, expected the error", lines[1])
+	}
+}
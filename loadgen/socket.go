@@ -0,0 +1,167 @@
+package loadgen
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// TCP_NODELAY values
+const (
+	NoDelayDefault = ""
+	NoDelayOn      = "on"
+	NoDelayOff     = "off"
+)
+
+// Socket options applied to every connection, zero values keep the OS defaults
+type SocketOptions struct {
+	// TCP_NODELAY: on, off or empty to keep the Go default (on)
+	NoDelay string
+
+	// SO_SNDBUF and SO_RCVBUF in bytes
+	SendBuffer    int
+	ReceiveBuffer int
+
+	// SO_LINGER in seconds, negative keeps the default
+	Linger int
+}
+
+func DefaultSocketOptions() SocketOptions {
+	return SocketOptions{
+		Linger: -1,
+	}
+}
+
+// Counts the socket options applied, or failed to apply, per option
+type SocketStats struct {
+	mutex   sync.Mutex
+	applied map[string]int64
+	failed  map[string]int64
+}
+
+func NewSocketStats() *SocketStats {
+	return &SocketStats{
+		applied: make(map[string]int64),
+		failed:  make(map[string]int64),
+	}
+}
+
+func (s *SocketStats) record(option string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		s.failed[option]++
+		return
+	}
+
+	s.applied[option]++
+}
+
+func (s *SocketStats) report() *SocketReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	report := &SocketReport{
+		Applied: make(map[string]int64, len(s.applied)),
+		Failed:  make(map[string]int64, len(s.failed)),
+	}
+
+	for option, count := range s.applied {
+		report.Applied[option] = count
+	}
+
+	for option, count := range s.failed {
+		report.Failed[option] = count
+	}
+
+	return report
+}
+
+// Dialer applying the socket options to every connection
+type socketDialer struct {
+	dialer  *net.Dialer
+	options SocketOptions
+	stats   *SocketStats
+
+	// Only set when the corresponding feature is enabled
+	keepAlive *KeepAliveStats
+	tls       *TLSStats
+	pool      *PoolStats
+
+	// Connections established
+	dials int64
+}
+
+func newSocketDialer(options *Options, stats *SocketStats, keepAlive *KeepAliveStats, tlsStats *TLSStats) *socketDialer {
+	d := &socketDialer{
+		dialer: &net.Dialer{
+			Timeout:   options.Dialer.Timeout,
+			KeepAlive: options.Dialer.KeepAlive,
+		},
+		options:   options.Socket,
+		stats:     stats,
+		keepAlive: keepAlive,
+		tls:       tlsStats,
+	}
+
+	if stats != nil {
+		d.dialer.Control = d.control
+	}
+
+	return d
+}
+
+func (d *socketDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&d.dials, 1)
+
+	// Go enables TCP_NODELAY once connected, after the Control hook ran
+	if d.stats != nil && d.options.NoDelay != NoDelayDefault {
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			d.stats.record("TCP_NODELAY", tcpConn.SetNoDelay(d.options.NoDelay == NoDelayOn))
+		}
+	}
+
+	if d.keepAlive != nil {
+		conn = d.keepAlive.track(conn)
+	}
+
+	if d.pool != nil {
+		conn = d.pool.track(conn)
+	}
+
+	return conn, nil
+}
+
+func (d *socketDialer) connections() int64 {
+	return atomic.LoadInt64(&d.dials)
+}
+
+// Runs before connect, so buffer sizes also affect the TCP window negotiation
+func (d *socketDialer) control(network, address string, rawConn syscall.RawConn) error {
+	return rawConn.Control(func(fd uintptr) {
+		if d.options.SendBuffer > 0 {
+			d.stats.record("SO_SNDBUF", setSendBuffer(fd, d.options.SendBuffer))
+		}
+
+		if d.options.ReceiveBuffer > 0 {
+			d.stats.record("SO_RCVBUF", setReceiveBuffer(fd, d.options.ReceiveBuffer))
+		}
+
+		if d.options.Linger >= 0 {
+			d.stats.record("SO_LINGER", setLinger(fd, d.options.Linger))
+		}
+	})
+}
+
+// Whether any socket option differs from the defaults
+func (o *SocketOptions) enabled() bool {
+	return o.NoDelay != NoDelayDefault || o.SendBuffer > 0 || o.ReceiveBuffer > 0 || o.Linger >= 0
+}
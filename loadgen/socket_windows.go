@@ -0,0 +1,18 @@
+package loadgen
+
+import "syscall"
+
+func setSendBuffer(fd uintptr, size int) error {
+	return syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF, size)
+}
+
+func setReceiveBuffer(fd uintptr, size int) error {
+	return syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, size)
+}
+
+func setLinger(fd uintptr, seconds int) error {
+	return syscall.SetsockoptLinger(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_LINGER, &syscall.Linger{
+		Onoff:  1,
+		Linger: int32(seconds),
+	})
+}
@@ -0,0 +1,327 @@
+package loadgen
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Class of the errors errorClass does not recognize
+const ErrorClassOther = "other"
+
+// Request statistics
+type Stats struct {
+	mutex sync.Mutex
+
+	startTime time.Time
+
+	// Per attempt
+	attempts        int64
+	attemptFailures int64
+	latencies       []time.Duration
+
+	// Per logical request (all attempts for one intent)
+	requests      int64
+	failures      int64
+	timeToSuccess []time.Duration
+	timeToFailure []time.Duration
+
+	// Scenario sub-requests the fan-in of their step no longer needed
+	cancelled int64
+
+	// Open-loop scheduling
+	schedulingLag []time.Duration
+	shed          int64
+
+	// Chunk timings (only filled when Options.RecordChunkTimings is set)
+	timeToFirstByte []time.Duration
+	timeToLastByte  []time.Duration
+	maxChunkGaps    []time.Duration
+	chunks          int64
+
+	// Content encoding
+	compressedResponses int64
+	compressedBytes     int64
+	decompressedBytes   int64
+	decompressTime      time.Duration
+
+	// Trailers
+	responsesWithTrailers int64
+	trailers              map[string]int64
+
+	// Failed requests by what terminated them
+	terminations map[string]int64
+
+	// Panics, failing the request or scenario step they interrupted
+	panics int64
+
+	// Failed attempts by error class
+	errorClasses map[string]int64
+
+	// Only set when sinks are configured
+	pipeline *pipeline
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		startTime:    time.Now(),
+		trailers:     make(map[string]int64),
+		terminations: make(map[string]int64),
+		errorClasses: make(map[string]int64),
+	}
+}
+
+// All attempts made to fulfil one logical request
+type LogicalRequest struct {
+	stats     *Stats
+	startTime time.Time
+
+	// Retries of hedged requests record their attempts concurrently
+	mutex    sync.Mutex
+	attempts int
+
+	// Time the last retry was sent, zero until then
+	retriedAt time.Time
+}
+
+type logicalRequestKey struct{}
+
+// Context carrying the logical request, for the retry middleware to record
+// the attempts it retries
+func withLogicalRequest(ctx context.Context, request *LogicalRequest) context.Context {
+	return context.WithValue(ctx, logicalRequestKey{}, request)
+}
+
+func logicalRequestFrom(ctx context.Context) *LogicalRequest {
+	request, _ := ctx.Value(logicalRequestKey{}).(*LogicalRequest)
+	return request
+}
+
+func (s *Stats) BeginRequest() *LogicalRequest {
+	return &LogicalRequest{
+		stats:     s,
+		startTime: time.Now(),
+	}
+}
+
+// Records a single attempt of the logical request
+func (r *LogicalRequest) Attempt(elapsed time.Duration, response *Response, err error) {
+	r.mutex.Lock()
+	r.attempts++
+	r.mutex.Unlock()
+
+	r.stats.Record(elapsed, response, err)
+}
+
+// Records an attempt given up on by the retry middleware, whose response
+// was discarded
+func (r *LogicalRequest) retried(elapsed time.Duration, err error) {
+	r.Attempt(elapsed, nil, err)
+}
+
+// Records that a retry is sent now
+func (r *LogicalRequest) retrying() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.retriedAt = time.Now()
+}
+
+// Time the last attempt took until stop, the whole elapsed time unless the
+// request was retried. With hedging, the last retry of either attempt is
+// counted from.
+func (r *LogicalRequest) lastAttempt(elapsed time.Duration, stop time.Time) time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.retriedAt.IsZero() {
+		return elapsed
+	}
+
+	return stop.Sub(r.retriedAt)
+}
+
+// Records the end-to-end outcome, err being the error of the last attempt
+func (r *LogicalRequest) Finish(err error) {
+	r.stats.recordLogical(time.Since(r.startTime), err)
+}
+
+// Records a scenario sub-request cancelled by the fan-in of its step, which
+// no longer needed it, as neither a success nor a failure
+func (r *LogicalRequest) cancelledByFanIn() {
+	r.stats.mutex.Lock()
+	defer r.stats.mutex.Unlock()
+
+	r.stats.cancelled++
+}
+
+func (s *Stats) recordLogical(elapsed time.Duration, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests++
+
+	if err != nil {
+		s.failures++
+		s.timeToFailure = append(s.timeToFailure, elapsed)
+		return
+	}
+
+	s.timeToSuccess = append(s.timeToSuccess, elapsed)
+}
+
+// Records the delay between the intended and actual send time
+func (s *Stats) RecordLag(lag time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.schedulingLag = append(s.schedulingLag, lag)
+}
+
+// Records a request dropped because it was too stale to send
+func (s *Stats) Shed(lag time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.shed++
+	s.schedulingLag = append(s.schedulingLag, lag)
+}
+
+// Records what terminated a failed request
+func (s *Stats) RecordTermination(cause string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.terminations[cause]++
+}
+
+// Records a panic, the request it interrupted being recorded as failed
+// separately
+func (s *Stats) recordPanic() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.panics++
+}
+
+func (s *Stats) Record(elapsed time.Duration, response *Response, err error) {
+	if s.pipeline != nil {
+		s.pipeline.publish(newRecord(elapsed, response, err))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.attempts++
+	s.latencies = append(s.latencies, elapsed)
+
+	if err != nil {
+		s.attemptFailures++
+
+		class := errorClass(err)
+		if class == "" {
+			class = ErrorClassOther
+		}
+
+		s.errorClasses[class]++
+	}
+
+	if response == nil {
+		return
+	}
+
+	if response.ContentEncoding != "" {
+		s.compressedResponses++
+		s.compressedBytes += int64(response.CompressedBytes)
+		s.decompressedBytes += int64(len(response.Body))
+		s.decompressTime += response.DecompressTime
+	}
+
+	if len(response.Trailer) > 0 {
+		s.responsesWithTrailers++
+
+		for name := range response.Trailer {
+			s.trailers[name]++
+		}
+	}
+
+	if response.Timings == nil {
+		return
+	}
+
+	timings := response.Timings
+
+	s.timeToFirstByte = append(s.timeToFirstByte, timings.TimeToFirstByte())
+	s.chunks += int64(len(timings.Arrivals))
+
+	if len(timings.Arrivals) > 0 {
+		s.timeToLastByte = append(s.timeToLastByte, timings.TimeToLastByte())
+		s.maxChunkGaps = append(s.maxChunkGaps, timings.MaxGap())
+	}
+}
+
+// Builds the report of everything recorded so far
+func (s *Stats) report() *Report {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	report := &Report{
+		SchemaVersion:   ReportSchemaVersion,
+		Duration:        time.Since(s.startTime),
+		Requests:        s.requests,
+		Failures:        s.failures,
+		Attempts:        s.attempts,
+		AttemptFailures: s.attemptFailures,
+		Cancelled:       s.cancelled,
+		Shed:            s.shed,
+		Panics:          s.panics,
+		Latency:         newPercentiles(s.latencies),
+		TimeToSuccess:   newPercentiles(s.timeToSuccess),
+		TimeToFailure:   newPercentiles(s.timeToFailure),
+		SchedulingLag:   newPercentiles(s.schedulingLag),
+	}
+
+	if len(s.timeToFirstByte) > 0 {
+		report.ChunkTimings = &ChunkTimingsReport{
+			Chunks:          s.chunks,
+			TimeToFirstByte: newPercentiles(s.timeToFirstByte),
+			TimeToLastByte:  newPercentiles(s.timeToLastByte),
+			MaxChunkGap:     newPercentiles(s.maxChunkGaps),
+		}
+	}
+
+	if s.compressedResponses > 0 {
+		report.ContentEncoding = &ContentEncodingReport{
+			Responses:         s.compressedResponses,
+			CompressedBytes:   s.compressedBytes,
+			DecompressedBytes: s.decompressedBytes,
+			DecompressTime:    s.decompressTime,
+		}
+	}
+
+	if len(s.terminations) > 0 {
+		report.Terminations = make(map[string]int64, len(s.terminations))
+
+		for cause, count := range s.terminations {
+			report.Terminations[cause] = count
+		}
+	}
+
+	if len(s.errorClasses) > 0 {
+		report.ErrorClasses = make(map[string]int64, len(s.errorClasses))
+
+		for class, count := range s.errorClasses {
+			report.ErrorClasses[class] = count
+		}
+	}
+
+	if s.responsesWithTrailers > 0 {
+		report.Trailers = make(map[string]int64, len(s.trailers))
+
+		for name, count := range s.trailers {
+			report.Trailers[name] = count
+		}
+	}
+
+	return report
+}
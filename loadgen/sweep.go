@@ -0,0 +1,247 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Transport sweep settings
+const (
+	SweepRequestsPerUser = 100
+)
+
+// Outcome of the same workload for each client timeout
+type SweepReport struct {
+	Results []SweepResult `json:"results"`
+}
+
+type SweepResult struct {
+	ClientTimeout time.Duration `json:"client_timeout"`
+	Requests      int64         `json:"requests"`
+	Failures      int64         `json:"failures"`
+
+	// Share of the logical requests which succeeded, from 0 to 1
+	SuccessRate float64 `json:"success_rate"`
+
+	Latency Percentiles `json:"latency"`
+}
+
+// Runs the same load test once per client timeout, one after the other, in
+// place of tuning the timeout by hand between runs
+func SweepTimeouts(ctx context.Context, scenario Scenario, options Options, timeouts []time.Duration) (*SweepReport, error) {
+	if len(timeouts) == 0 {
+		return nil, errors.New("timeouts can not be empty")
+	}
+
+	for _, timeout := range timeouts {
+		if timeout <= 0 {
+			return nil, fmt.Errorf("timeout [%v] must be positive", timeout)
+		}
+	}
+
+	// Sinks are closed at the end of every run
+	options.Sinks = nil
+
+	report := &SweepReport{}
+
+	for _, timeout := range timeouts {
+		if ctx.Err() != nil {
+			break
+		}
+
+		options.ClientTimeout = timeout
+
+		run, err := Run(ctx, scenario, options)
+		if err != nil {
+			return nil, err
+		}
+
+		result := SweepResult{
+			ClientTimeout: timeout,
+			Requests:      run.Requests,
+			Failures:      run.Failures,
+			Latency:       run.Latency,
+		}
+
+		if run.Requests > 0 {
+			result.SuccessRate = float64(run.Requests-run.Failures) / float64(run.Requests)
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
+
+// Writes one row per client timeout
+func (r *SweepReport) WriteTable(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintln(table, "Timeout\tRequests\tFailures\tSuccess\tP50\tP99\t")
+
+	for _, result := range r.Results {
+		fmt.Fprintf(table, "%v\t%d\t%d\t%.2f%%\t%v\t%v\t\n",
+			result.ClientTimeout, result.Requests, result.Failures, 100*result.SuccessRate,
+			result.Latency.P50, result.Latency.P99)
+	}
+
+	return table.Flush()
+}
+
+// Values of the transport timeouts to combine, an empty axis keeping the
+// value of the options
+type TransportTimeoutGrid struct {
+	TLSHandshakeTimeouts   []time.Duration
+	ResponseHeaderTimeouts []time.Duration
+	IdleConnTimeouts       []time.Duration
+
+	// Short workload run for every cell
+	RequestsPerUser int
+}
+
+func DefaultTransportTimeoutGrid() TransportTimeoutGrid {
+	return TransportTimeoutGrid{
+		RequestsPerUser: SweepRequestsPerUser,
+	}
+}
+
+func (g *TransportTimeoutGrid) Validate() error {
+	if g.RequestsPerUser < 1 {
+		return errors.New("RequestsPerUser must be at least 1")
+	}
+
+	for _, axis := range [][]time.Duration{g.TLSHandshakeTimeouts, g.ResponseHeaderTimeouts, g.IdleConnTimeouts} {
+		for _, timeout := range axis {
+			if timeout < 0 {
+				return fmt.Errorf("timeout [%v] can not be negative", timeout)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Error classes of every combination of transport timeouts
+type TransportSweepReport struct {
+	Cells []TransportSweepCell `json:"cells"`
+}
+
+type TransportSweepCell struct {
+	TLSHandshakeTimeout   time.Duration `json:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `json:"response_header_timeout"`
+	IdleConnTimeout       time.Duration `json:"idle_conn_timeout"`
+
+	Requests int64 `json:"requests"`
+	Failures int64 `json:"failures"`
+
+	// Failed attempts by error class
+	ErrorClasses map[string]int64 `json:"error_classes"`
+}
+
+// Runs a short load test for every combination of the transport timeouts
+// of the grid, one after the other
+func SweepTransportTimeouts(ctx context.Context, scenario Scenario, options Options, grid TransportTimeoutGrid) (*TransportSweepReport, error) {
+	if err := grid.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Sinks are closed at the end of every run
+	options.Sinks = nil
+	options.RequestsPerUser = grid.RequestsPerUser
+
+	tlsHandshakeTimeouts := axis(grid.TLSHandshakeTimeouts, options.Transport.TLSHandshakeTimeout)
+	responseHeaderTimeouts := axis(grid.ResponseHeaderTimeouts, options.Transport.ResponseHeaderTimeout)
+	idleConnTimeouts := axis(grid.IdleConnTimeouts, options.Transport.IdleConnTimeout)
+
+	report := &TransportSweepReport{}
+
+	for _, tlsHandshakeTimeout := range tlsHandshakeTimeouts {
+		for _, responseHeaderTimeout := range responseHeaderTimeouts {
+			for _, idleConnTimeout := range idleConnTimeouts {
+				if ctx.Err() != nil {
+					return report, nil
+				}
+
+				options.Transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+				options.Transport.ResponseHeaderTimeout = responseHeaderTimeout
+				options.Transport.IdleConnTimeout = idleConnTimeout
+
+				run, err := Run(ctx, scenario, options)
+				if err != nil {
+					return nil, err
+				}
+
+				cell := TransportSweepCell{
+					TLSHandshakeTimeout:   tlsHandshakeTimeout,
+					ResponseHeaderTimeout: responseHeaderTimeout,
+					IdleConnTimeout:       idleConnTimeout,
+					Requests:              run.Requests,
+					Failures:              run.Failures,
+					ErrorClasses:          run.ErrorClasses,
+				}
+
+				if cell.ErrorClasses == nil {
+					cell.ErrorClasses = make(map[string]int64)
+				}
+
+				report.Cells = append(report.Cells, cell)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func axis(values []time.Duration, current time.Duration) []time.Duration {
+	if len(values) == 0 {
+		return []time.Duration{current}
+	}
+
+	return values
+}
+
+// Writes one row per cell and one column per error class seen in any cell
+func (r *TransportSweepReport) WriteTable(w io.Writer) error {
+	var classes []string
+
+	seen := make(map[string]bool)
+
+	for _, cell := range r.Cells {
+		for class := range cell.ErrorClasses {
+			if !seen[class] {
+				seen[class] = true
+				classes = append(classes, class)
+			}
+		}
+	}
+
+	sort.Strings(classes)
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprint(table, "TLSHandshake\tResponseHeader\tIdleConn\tRequests\tFailures\t")
+
+	for _, class := range classes {
+		fmt.Fprintf(table, "%s\t", class)
+	}
+
+	fmt.Fprintln(table)
+
+	for _, cell := range r.Cells {
+		fmt.Fprintf(table, "%v\t%v\t%v\t%d\t%d\t",
+			cell.TLSHandshakeTimeout, cell.ResponseHeaderTimeout, cell.IdleConnTimeout, cell.Requests, cell.Failures)
+
+		for _, class := range classes {
+			fmt.Fprintf(table, "%d\t", cell.ErrorClasses[class])
+		}
+
+		fmt.Fprintln(table)
+	}
+
+	return table.Flush()
+}
@@ -0,0 +1,93 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Protocols of the targets
+const (
+	ProtocolHTTP      = "http"
+	ProtocolGRPC      = "grpc"
+	ProtocolWebSocket = "websocket"
+	ProtocolTCP       = "tcp"
+)
+
+// Protocol-specific way of executing requests, so scheduling, stats and
+// reporting don't depend on the protocol. Implementations must be safe for
+// concurrent use by all workers.
+type Target interface {
+	// Sends one request for the resource (URL path, gRPC method, WebSocket
+	// message or TCP payload) and waits for its response. The response may be
+	// partial when an error is returned.
+	Do(ctx context.Context, resource string) (*Response, error)
+
+	// Releases the connections held by the target
+	Close() error
+}
+
+// Builds a target for the load test options, registered by protocol below
+type targetFactory func(t *LoadTest) (Target, error)
+
+var targetFactories = map[string]targetFactory{
+	ProtocolHTTP: func(t *LoadTest) (Target, error) {
+		return newHTTPTarget(t), nil
+	},
+	ProtocolGRPC: func(t *LoadTest) (Target, error) {
+		return newGRPCTarget(t.options, t.dialer)
+	},
+	ProtocolWebSocket: func(t *LoadTest) (Target, error) {
+		return newWebSocketTarget(t.options, t.dialer)
+	},
+	ProtocolTCP: func(t *LoadTest) (Target, error) {
+		return newTCPTarget(t.options, t.dialer)
+	},
+}
+
+func validateProtocol(protocol string) error {
+	if _, ok := targetFactories[protocol]; !ok {
+		return fmt.Errorf("unknown protocol [%s]", protocol)
+	}
+
+	return nil
+}
+
+func newTarget(t *LoadTest) (Target, error) {
+	options := t.options
+
+	if err := validateProtocol(options.Protocol); err != nil {
+		return nil, err
+	}
+
+	target, err := targetFactories[options.Protocol](t)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Fallback.BaseURL != "" {
+		if target, err = newFallbackTarget(t, target); err != nil {
+			return nil, err
+		}
+	}
+
+	// The HTTP client enforces the timeout itself
+	if options.Protocol != ProtocolHTTP && options.ClientTimeout > 0 && !options.AdaptiveTimeout.Enabled {
+		target = &timeoutTarget{Target: target, timeout: options.ClientTimeout}
+	}
+
+	return target, nil
+}
+
+// Applies the client timeout to targets without one of their own
+type timeoutTarget struct {
+	Target
+	timeout time.Duration
+}
+
+func (t *timeoutTarget) Do(ctx context.Context, resource string) (*Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	return t.Target.Do(ctx, resource)
+}
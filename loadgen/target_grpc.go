@@ -0,0 +1,195 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// gRPC settings
+const (
+	GRPCMethod = "/ping.Ping/Ping"
+
+	// Length-prefixed message header: compressed flag and big-endian length
+	grpcMessageHeaderLen = 5
+)
+
+// Target calling unary gRPC methods over HTTP/2, without generated stubs:
+// requests carry an empty message and responses are kept as raw bytes
+type GRPCTarget struct {
+	options   *Options
+	baseURL   *url.URL
+	transport *http2.Transport
+}
+
+func newGRPCTarget(options *Options, dialer *socketDialer) (*GRPCTarget, error) {
+	baseURL, err := url.Parse(options.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http2.Transport{
+		TLSClientConfig: newTLSClientConfig(options),
+
+		// Cleartext (h2c) when the base URL is http://
+		AllowHTTP:       true,
+		ReadIdleTimeout: options.HTTP2Transport.ReadIdleTimeout,
+		PingTimeout:     options.HTTP2Transport.PingTimeout,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			if baseURL.Scheme == "http" {
+				return dialer.DialContext(context.Background(), network, addr)
+			}
+
+			conn, err := dialer.DialTLS(context.Background(), network, addr, cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			return conn, nil
+		},
+	}
+
+	return &GRPCTarget{
+		options:   options,
+		baseURL:   baseURL,
+		transport: transport,
+	}, nil
+}
+
+// Calls the method, e.g. /ping.Ping/Ping
+func (t *GRPCTarget) Do(ctx context.Context, method string) (*Response, error) {
+	// Empty protobuf message
+	body := make([]byte, grpcMessageHeaderLen)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL.String()+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", grpcTimeout(deadline))
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	response := &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+	}
+
+	message, err := readGRPCMessage(resp.Body)
+	if err != nil {
+		return response, err
+	}
+
+	// Trailers are only complete once the body was drained
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return response, err
+	}
+
+	response.Body = string(message)
+	response.Trailer = resp.Trailer
+
+	return response, grpcStatus(resp)
+}
+
+func (t *GRPCTarget) Close() error {
+	t.transport.CloseIdleConnections()
+	return nil
+}
+
+// Reads one length-prefixed message, none for trailers-only responses
+func readGRPCMessage(reader io.Reader) ([]byte, error) {
+	header := make([]byte, grpcMessageHeaderLen)
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	message := make([]byte, binary.BigEndian.Uint32(header[1:]))
+
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// Error for a non-OK grpc-status, found in the trailers or, for
+// trailers-only responses, in the headers
+func grpcStatus(resp *http.Response) error {
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+
+	if status == "" {
+		return fmt.Errorf("missing grpc-status, HTTP status %d", resp.StatusCode)
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("invalid grpc-status [%s]", status)
+	}
+
+	if code != 0 {
+		return fmt.Errorf("grpc status %d: %s", code, message)
+	}
+
+	return nil
+}
+
+// Remaining time until the deadline in the grpc-timeout format
+func grpcTimeout(deadline time.Time) string {
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return "1n"
+	}
+
+	// At most 8 digits, coarser units for longer timeouts
+	units := []struct {
+		unit     string
+		duration time.Duration
+	}{
+		{"n", time.Nanosecond},
+		{"u", time.Microsecond},
+		{"m", time.Millisecond},
+		{"S", time.Second},
+		{"M", time.Minute},
+		{"H", time.Hour},
+	}
+
+	for _, u := range units {
+		if value := remaining / u.duration; value < 1e8 {
+			return strconv.FormatInt(int64(value), 10) + u.unit
+		}
+	}
+
+	return "99999999H"
+}
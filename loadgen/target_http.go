@@ -0,0 +1,161 @@
+package loadgen
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+// Target sending HTTP requests through the configured client and middlewares
+type HTTPTarget struct {
+	options *Options
+	client  *http.Client
+
+	// Only set when the corresponding feature is enabled
+	keepAlive *KeepAliveStats
+	pool      *PoolStats
+}
+
+func newHTTPTarget(t *LoadTest) *HTTPTarget {
+	options := t.options
+
+	target := &HTTPTarget{
+		options:   options,
+		keepAlive: t.dialer.keepAlive,
+		pool:      t.dialer.pool,
+	}
+
+	middlewares := newMiddlewares(options, t.retryStats, t.retryBudget, t.circuitBreaker, t.bulkhead)
+
+	if t.http2Health != nil {
+		target.client = newHTTP2Client(options, t.dialer, t.http2Health, middlewares)
+	} else {
+		target.client = newHTTPClient(options, t.dialer, middlewares)
+	}
+
+	if options.AdaptiveTimeout.Enabled {
+		// Replaced by per-request deadlines
+		target.client.Timeout = 0
+	}
+
+	return target
+}
+
+// Requests the path on the base URL, or the absolute URL as is so
+// scenarios can span several hosts
+func (t *HTTPTarget) Do(ctx context.Context, path string) (*Response, error) {
+	url := path
+
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		url = t.options.BaseURL + path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Send(req)
+}
+
+func (t *HTTPTarget) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// Sends the request and reads the whole response body
+func (t *HTTPTarget) Send(req *http.Request) (*Response, error) {
+	if t.keepAlive == nil && t.pool == nil {
+		return t.send(req)
+	}
+
+	var connInfo httptrace.GotConnInfo
+	var pool *poolTrace
+
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			connInfo = info
+		},
+	})
+
+	if t.pool != nil {
+		pool = t.pool.newTrace()
+		ctx = httptrace.WithClientTrace(ctx, pool.clientTrace())
+	}
+
+	response, err := t.send(req.WithContext(ctx))
+
+	if t.keepAlive != nil {
+		t.keepAlive.recordRequest(connInfo, err)
+	}
+
+	if pool != nil {
+		pool.finish()
+	}
+
+	return response, err
+}
+
+func (t *HTTPTarget) send(req *http.Request) (*Response, error) {
+	var timings *ChunkTimings
+
+	if t.options.RecordChunkTimings {
+		timings = &ChunkTimings{}
+
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			GotFirstResponseByte: func() {
+				timings.FirstResponseByte = time.Now()
+			},
+		}))
+
+		timings.Start = time.Now()
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+
+	if timings != nil {
+		reader = &timedReader{reader: resp.Body, timings: timings}
+	}
+
+	response := &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Timings:    timings,
+	}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		// Keep the partial timings, a stalled body is what we want to see
+		return response, err
+	}
+
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+		response.ContentEncoding = encoding
+		response.CompressedBytes = len(body)
+
+		body, response.DecompressTime, err = decodeBody(encoding, body)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	response.Body = string(body)
+	response.Trailer = resp.Trailer
+
+	if failedStatus(resp.StatusCode) {
+		return response, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return response, checkTrailers(resp.Trailer, t.options.ExpectedTrailers)
+}
@@ -0,0 +1,53 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestHTTPTargetStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statusCode, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.WriteHeader(statusCode)
+	}))
+	defer server.Close()
+
+	target := &HTTPTarget{
+		options: &Options{BaseURL: server.URL},
+		client:  server.Client(),
+	}
+
+	tests := []struct {
+		name       string
+		statusCode int
+		err        bool
+	}{
+		{"ok", 200, false},
+		{"client error", 404, false},
+		{"too many requests", 429, true},
+		{"server error", 503, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := target.Do(context.Background(), "/?status="+strconv.Itoa(test.statusCode))
+
+			var statusErr *StatusError
+			if failed := errors.As(err, &statusErr); failed != test.err {
+				t.Fatalf("Do() returned error [%v], expected status error %v", err, test.err)
+			}
+
+			if test.err && statusErr.StatusCode != test.statusCode {
+				t.Errorf("StatusError has status %d, expected %d", statusErr.StatusCode, test.statusCode)
+			}
+
+			if response == nil || response.StatusCode != test.statusCode {
+				t.Errorf("Do() returned response %+v, expected status %d", response, test.statusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package loadgen
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Idle connections of stateful targets, one in use per worker at most
+type connPool struct {
+	idle chan net.Conn
+	dial func(ctx context.Context) (net.Conn, error)
+}
+
+func newConnPool(size int, dial func(ctx context.Context) (net.Conn, error)) *connPool {
+	return &connPool{
+		idle: make(chan net.Conn, size),
+		dial: dial,
+	}
+}
+
+func (p *connPool) get(ctx context.Context) (net.Conn, error) {
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	default:
+		return p.dial(ctx)
+	}
+}
+
+// Returns a healthy connection to the pool, closing it when full
+func (p *connPool) put(conn net.Conn) {
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (p *connPool) close() {
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// Applies the context deadline to the connection and unblocks it when the
+// context is cancelled, until the returned function is called
+func watchContext(ctx context.Context, conn net.Conn) func() {
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	stop := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	return func() {
+		close(stop)
+	}
+}
@@ -0,0 +1,81 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Target writing one line per request over raw TCP connections and reading
+// one line back, e.g. against a line-based echo server
+type TCPTarget struct {
+	address string
+	pool    *connPool
+}
+
+// Connection with its buffered reader, kept together in the pool
+type lineConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func newTCPTarget(options *Options, dialer *socketDialer) (*TCPTarget, error) {
+	address := options.BaseURL
+
+	// Accept both tcp://host:port and host:port
+	if strings.Contains(address, "://") {
+		baseURL, err := url.Parse(address)
+		if err != nil {
+			return nil, err
+		}
+
+		address = baseURL.Host
+	}
+
+	target := &TCPTarget{address: address}
+
+	target.pool = newConnPool(options.Users, func(ctx context.Context) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, err
+		}
+
+		return &lineConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+	})
+
+	return target, nil
+}
+
+func (t *TCPTarget) Do(ctx context.Context, payload string) (*Response, error) {
+	conn, err := t.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := watchContext(ctx, conn)
+	defer stop()
+
+	lc := conn.(*lineConn)
+
+	if _, err := lc.Write([]byte(payload + "\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	line, err := lc.reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return &Response{Body: line}, err
+	}
+
+	t.pool.put(conn)
+
+	return &Response{Body: strings.TrimSuffix(line, "\n")}, nil
+}
+
+func (t *TCPTarget) Close() error {
+	t.pool.close()
+	return nil
+}
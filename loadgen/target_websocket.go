@@ -0,0 +1,92 @@
+package loadgen
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// Target sending text messages over long-lived WebSocket connections to
+// RequestPath and waiting for one message back, e.g. from an echo endpoint
+type WebSocketTarget struct {
+	options *Options
+	dialer  *socketDialer
+	baseURL *url.URL
+	pool    *connPool
+}
+
+func newWebSocketTarget(options *Options, dialer *socketDialer) (*WebSocketTarget, error) {
+	baseURL, err := url.Parse(options.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch baseURL.Scheme {
+	case "https":
+		baseURL.Scheme = "wss"
+	case "http":
+		baseURL.Scheme = "ws"
+	}
+
+	target := &WebSocketTarget{
+		options: options,
+		dialer:  dialer,
+		baseURL: baseURL,
+	}
+
+	target.pool = newConnPool(options.Users, target.dial)
+
+	return target, nil
+}
+
+// Opens a connection to the WebSocket endpoint at RequestPath
+func (t *WebSocketTarget) dial(ctx context.Context) (net.Conn, error) {
+	origin := strings.Replace(strings.Replace(t.baseURL.String(), "wss://", "https://", 1), "ws://", "http://", 1)
+
+	config, err := websocket.NewConfig(t.baseURL.String()+t.options.RequestPath, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	config.TlsConfig = newTLSClientConfig(t.options)
+	config.Dialer = t.dialer.dialer
+
+	return websocket.DialConfig(config)
+}
+
+// Sends the message and waits for the next message from the server
+func (t *WebSocketTarget) Do(ctx context.Context, message string) (*Response, error) {
+	conn, err := t.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := watchContext(ctx, conn)
+	defer stop()
+
+	ws := conn.(*websocket.Conn)
+
+	if err := websocket.Message.Send(ws, message); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	var reply string
+
+	if err := websocket.Message.Receive(ws, &reply); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t.pool.put(conn)
+
+	return &Response{Body: reply}, nil
+}
+
+func (t *WebSocketTarget) Close() error {
+	t.pool.close()
+	return nil
+}
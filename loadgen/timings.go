@@ -0,0 +1,66 @@
+package loadgen
+
+import (
+	"io"
+	"time"
+)
+
+// Arrival times of the response and its body chunks
+type ChunkTimings struct {
+	// Time the request was sent
+	Start time.Time
+
+	// Time the first response byte (status line) was received
+	FirstResponseByte time.Time
+
+	// Arrival time and size of each body chunk
+	Arrivals []time.Time
+	Sizes    []int
+}
+
+func (t *ChunkTimings) TimeToFirstByte() time.Duration {
+	return t.FirstResponseByte.Sub(t.Start)
+}
+
+func (t *ChunkTimings) TimeToLastByte() time.Duration {
+	if len(t.Arrivals) == 0 {
+		return 0
+	}
+
+	return t.Arrivals[len(t.Arrivals)-1].Sub(t.Start)
+}
+
+// Largest gap between two consecutive body chunks (or between the
+// response headers and the first chunk)
+func (t *ChunkTimings) MaxGap() time.Duration {
+	var maxGap time.Duration
+
+	previous := t.FirstResponseByte
+
+	for _, arrival := range t.Arrivals {
+		if gap := arrival.Sub(previous); gap > maxGap {
+			maxGap = gap
+		}
+
+		previous = arrival
+	}
+
+	return maxGap
+}
+
+// Reader recording the arrival time of every chunk read from the body
+type timedReader struct {
+	reader  io.Reader
+	timings *ChunkTimings
+}
+
+func (r *timedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+
+	if n > 0 {
+		r.timings.Arrivals = append(r.timings.Arrivals, time.Now())
+		r.timings.Sizes = append(r.timings.Sizes, n)
+	}
+
+	return n, err
+}
@@ -0,0 +1,80 @@
+package loadgen
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestChunkTimings(t *testing.T) {
+	start := time.Now()
+
+	at := func(ms time.Duration) time.Time {
+		return start.Add(ms * time.Millisecond)
+	}
+
+	tests := []struct {
+		name       string
+		arrivals   []time.Time
+		timeToLast time.Duration
+		maxGap     time.Duration
+	}{
+		{"no body", nil, 0, 0},
+		{"single chunk", []time.Time{at(30)}, 30 * time.Millisecond, 20 * time.Millisecond},
+		{"stalled chunk", []time.Time{at(15), at(20), at(120)}, 120 * time.Millisecond, 100 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timings := &ChunkTimings{
+				Start:             start,
+				FirstResponseByte: at(10),
+				Arrivals:          test.arrivals,
+			}
+
+			if ttfb := timings.TimeToFirstByte(); ttfb != 10*time.Millisecond {
+				t.Errorf("TimeToFirstByte() returned %v, expected %v", ttfb, 10*time.Millisecond)
+			}
+
+			if ttlb := timings.TimeToLastByte(); ttlb != test.timeToLast {
+				t.Errorf("TimeToLastByte() returned %v, expected %v", ttlb, test.timeToLast)
+			}
+
+			if gap := timings.MaxGap(); gap != test.maxGap {
+				t.Errorf("MaxGap() returned %v, expected %v", gap, test.maxGap)
+			}
+		})
+	}
+}
+
+func TestTimedReader(t *testing.T) {
+	timings := &ChunkTimings{}
+
+	// One byte per read, so every byte is a chunk
+	reader := &timedReader{reader: iotest.OneByteReader(strings.NewReader("abc")), timings: timings}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading failed with error [%v]", err)
+	}
+
+	if string(body) != "abc" {
+		t.Errorf("read [%s], expected [abc]", body)
+	}
+
+	if len(timings.Arrivals) != 3 || len(timings.Sizes) != 3 {
+		t.Fatalf("recorded %d arrivals and %d sizes, expected 3", len(timings.Arrivals), len(timings.Sizes))
+	}
+
+	for i, size := range timings.Sizes {
+		if size != 1 {
+			t.Errorf("chunk %d has size %d, expected 1", i, size)
+		}
+
+		if i > 0 && timings.Arrivals[i].Before(timings.Arrivals[i-1]) {
+			t.Errorf("chunk %d arrived before chunk %d", i, i-1)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// TLS handshake variants. crypto/tls neither sends 0-RTT early data nor
+// uses False Start, so handshakes are either full or resumed.
+const (
+	HandshakeFull    = "full"
+	HandshakeResumed = "resumed"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+type TLSOptions struct {
+	// 1.0 to 1.3, empty for the Go defaults
+	MinVersion string
+	MaxVersion string
+
+	// Keep session tickets so new connections resume earlier sessions
+	SessionResumption bool
+
+	// Session tickets kept per transport (0 for the crypto/tls default)
+	SessionCacheSize int
+
+	// Time every handshake, by variant
+	RecordHandshakes bool
+}
+
+func (o *TLSOptions) Validate() error {
+	for _, version := range []string{o.MinVersion, o.MaxVersion} {
+		if _, ok := tlsVersions[version]; version != "" && !ok {
+			return fmt.Errorf("unknown TLS version [%s]", version)
+		}
+	}
+
+	if o.SessionCacheSize < 0 {
+		return errors.New("SessionCacheSize can not be negative")
+	}
+
+	return nil
+}
+
+func tlsVersionName(version uint16) string {
+	for name, v := range tlsVersions {
+		if v == version {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// Handshake durations by variant
+type TLSStats struct {
+	mutex      sync.Mutex
+	handshakes map[string][]time.Duration
+	versions   map[string]int64
+	failures   int64
+}
+
+func NewTLSStats() *TLSStats {
+	return &TLSStats{
+		handshakes: make(map[string][]time.Duration),
+		versions:   make(map[string]int64),
+	}
+}
+
+func (s *TLSStats) record(elapsed time.Duration, state tls.ConnectionState, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		s.failures++
+		return
+	}
+
+	variant := HandshakeFull
+	if state.DidResume {
+		variant = HandshakeResumed
+	}
+
+	s.handshakes[variant] = append(s.handshakes[variant], elapsed)
+	s.versions[tlsVersionName(state.Version)]++
+}
+
+func (s *TLSStats) report() *TLSReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	report := &TLSReport{
+		Handshakes: make(map[string]Percentiles, len(s.handshakes)),
+		Versions:   make(map[string]int64, len(s.versions)),
+		Failures:   s.failures,
+	}
+
+	for variant, durations := range s.handshakes {
+		report.Handshakes[variant] = newPercentiles(durations)
+	}
+
+	for version, count := range s.versions {
+		report.Versions[version] = count
+	}
+
+	return report
+}
+
+// Dials and runs the TLS handshake within the context deadline
+func (d *socketDialer) DialTLS(ctx context.Context, network, addr string, cfg *tls.Config) (*tls.Conn, error) {
+	rawConn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		rawConn.SetDeadline(deadline)
+	}
+
+	conn := tls.Client(rawConn, cfg)
+
+	startTime := time.Now()
+	err = conn.Handshake()
+
+	if d.tls != nil {
+		d.tls.record(time.Since(startTime), conn.ConnectionState(), err)
+	}
+
+	if err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+
+	rawConn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
@@ -0,0 +1,17 @@
+package loadgen
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Fails when any of the expected trailers is missing
+func checkTrailers(trailer http.Header, expected []string) error {
+	for _, name := range expected {
+		if trailer.Get(name) == "" {
+			return fmt.Errorf("missing trailer [%s]", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// State shared by all workers of a load test
+type LoadTest struct {
+	options *Options
+	target  Target
+	stats   *Stats
+	dialer  *socketDialer
+
+	// Targets created, one per user with PerWorkerTransport and twice as
+	// many with hedging
+	transports int
+
+	// Only set when the corresponding feature is enabled
+	adaptiveTimeout *AdaptiveTimeout
+	rangeStats      *RangeStats
+	http2Health     *HTTP2Health
+	socketStats     *SocketStats
+	keepAliveStats  *KeepAliveStats
+	tlsStats        *TLSStats
+	retryStats      *RetryStats
+	retryBudget     *RetryBudget
+	circuitBreaker  *CircuitBreaker
+	hedger          *Hedger
+	fallbackStats   *FallbackStats
+	bulkhead        *Bulkhead
+	chaosStats      *ChaosStats
+	scenario        *Scenario
+	scenarioStats   *ScenarioStats
+
+	// Separate transport for hedges, so they don't share the connection of
+	// the request they back up
+	hedgeTarget Target
+}
+
+// Copy of the load test sharing all its state but the target
+func (t *LoadTest) withTarget(target Target) *LoadTest {
+	worker := *t
+	worker.target = target
+
+	return &worker
+}
+
+func (t *LoadTest) newRangeCursor() *rangeCursor {
+	return &rangeCursor{options: &t.options.Range}
+}
+
+// Runs RequestsPerUser requests back to back, until stop is closed
+func (t *LoadTest) runClosedLoop(ctx context.Context, stop <-chan struct{}, logger *log.Entry) {
+	cursor := t.newRangeCursor()
+
+	for requestCount := 0; requestCount < t.options.RequestsPerUser; requestCount++ {
+		if stopped(stop) || ctx.Err() != nil {
+			return
+		}
+
+		t.executeSafely(ctx, logger, cursor)
+
+		if t.options.KeepAlive.IdleHold > 0 {
+			select {
+			case <-time.After(t.options.KeepAlive.IdleHold):
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// Executes one logical request
+func (t *LoadTest) execute(ctx context.Context, logger *log.Entry, cursor *rangeCursor) {
+	if t.scenario != nil {
+		t.runScenario(ctx, logger)
+		return
+	}
+
+	t.sendRequest(ctx, logger, func(ctx context.Context) (*Response, error) {
+		if t.rangeStats != nil {
+			start, end := cursor.next()
+			return t.fetchRange(ctx, start, end)
+		}
+
+		return t.do(ctx, logger, t.options.RequestPath)
+	})
+}
+
+// Sends one logical request through roundTrip within the per-request
+// deadline, chaos cancellation and adaptive timeout, recording its attempts
+// and what terminated it. Flat runs and scenario sub-requests share it so
+// both measure the same thing.
+func (t *LoadTest) sendRequest(ctx context.Context, logger *log.Entry, roundTrip func(context.Context) (*Response, error)) (*Response, error) {
+	request := t.stats.BeginRequest()
+	ctx = withLogicalRequest(ctx, request)
+
+	// Logged on failure, to find the request in the server logs
+	id := newRequestID()
+	ctx = withRequestID(ctx, id)
+
+	ctx, cancelRequest := t.withRequestTimeout(ctx)
+	defer cancelRequest()
+
+	ctx, cancelChaos := t.withChaosCancel(ctx)
+	defer cancelChaos()
+
+	cancel := context.CancelFunc(func() {})
+
+	var timeout time.Duration
+
+	if t.adaptiveTimeout != nil {
+		ctx, cancel, timeout = t.adaptiveTimeout.WithTimeout(ctx)
+	}
+
+	startTime := time.Now()
+
+	response, err := roundTrip(ctx)
+
+	stopTime := time.Now()
+	elapsedTime := stopTime.Sub(startTime)
+
+	// The outcome no longer matters, and the cancellation says nothing about
+	// the server
+	if err != nil && errors.Is(context.Cause(ctx), errFannedIn) {
+		cancel()
+		request.cancelledByFanIn()
+
+		return response, err
+	}
+
+	if err != nil {
+		t.stats.RecordTermination(terminationCause(ctx, err))
+	}
+
+	cancel()
+
+	if t.adaptiveTimeout != nil {
+		t.adaptiveTimeout.Observe(ctx, elapsedTime, timeout, err)
+	}
+
+	request.Attempt(request.lastAttempt(elapsedTime, stopTime), response, err)
+	request.Finish(err)
+
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"RequestID": id,
+			"Start":     startTime,
+			"Stop":      stopTime,
+			"Elapsed":   elapsedTime,
+		}).Printf("Request failed with error [%v]\n", err)
+
+		return response, err
+	}
+
+	//logger.WithFields(log.Fields{
+	//	"Start":   startTime,
+	//	"Stop":    stopTime,
+	//	"Elapsed": elapsedTime,
+	//}).Printf("Request finished with statusCode [%v] and body [%v]\n", response.StatusCode, response.Body)
+
+	return response, nil
+}
+
+// Sends a single request, hedged when enabled
+func (t *LoadTest) do(ctx context.Context, logger *log.Entry, resource string) (*Response, error) {
+	if t.hedger != nil {
+		return t.hedger.Do(ctx, t.safeGo(logger), t.target, t.hedgeTarget, resource)
+	}
+
+	return t.target.Do(ctx, resource)
+}